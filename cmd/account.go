@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func registerAccountRoutes(r chi.Router) {
+	// The password and session pages take sessions of users who must reset
+	// their password, every other page refuses them.
+	r.Get("/settings/password", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		s, err := internal.GetSession(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/settings/password login=%v\n", s.User.Login)
+
+		io.WriteString(w, internal.RenderPasswordForm(s.User.PasswordResetRequired))
+	})
+
+	r.Post("/do_change_password", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		s, err := internal.GetSession(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		u := s.User
+		newPassword := r.Form.Get("new_password")
+
+		if internal.GetHash([]byte(r.Form.Get("password"))) != u.PasswordHash {
+			err = fmt.Errorf("Wrong current password of user %v", u.Id)
+		}
+
+		if err == nil && (newPassword == "" || newPassword != r.Form.Get("new_password_again")) {
+			err = fmt.Errorf("New passwords of user %v are empty or differ", u.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_change_password login=%v\n", u.Login)
+			err = db.SetPasswordHash(u, internal.GetHash([]byte(newPassword)))
+		}
+
+		if err == nil {
+			err = db.SetPasswordResetRequired(u, false)
+		}
+
+		// Whoever knew the old password is logged out everywhere else, and
+		// loses the tokens they may have made with it.
+		if err == nil {
+			err = db.RevokeSessions(u)
+		}
+
+		if err == nil {
+			err = db.RevokeAccessTokens(u)
+		}
+
+		if err == nil {
+			_, err = internal.StartSession(w, r, db, u)
+		}
+
+		if err != nil {
+			log.Printf("Failed to change password: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot change password")
+			return
+		}
+
+		internal.Audit(db, r, core.AuditPasswordChange, u, nil, "")
+
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	})
+
+	r.Get("/settings/sessions", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		s, err := internal.GetSession(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/settings/sessions login=%v\n", s.User.Login)
+
+		ss, err := db.GetSessions(s.User)
+		if err != nil {
+			log.Printf("Failed to list sessions: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load sessions")
+			return
+		}
+
+		io.WriteString(w, internal.RenderSessions(ss, s.Id, "/do_revoke_session"))
+		io.WriteString(w, `<form action="/do_logout" method="POST"><input type="submit" value="Log out"></input></form>`)
+	})
+
+	r.Post("/do_revoke_session", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		current, err := internal.GetSession(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		u := current.User
+		var s *core.Session
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil {
+			s, err = db.LoadSession(id)
+		}
+
+		if err == nil && s.User.Id != u.Id {
+			err = fmt.Errorf("Session %v is not of user %v", s.Id, u.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_revoke_session id=%v login=%v\n", s.Id, u.Login)
+			err = db.RevokeSession(s)
+		}
+
+		if err != nil {
+			log.Printf("Failed to revoke session: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot revoke such session")
+			return
+		}
+
+		internal.Audit(db, r, core.AuditSessionRevoke, u, u, fmt.Sprintf("session=%v", s.Id))
+
+		http.Redirect(w, r, "/settings/sessions", http.StatusSeeOther)
+	})
+
+	r.Get("/settings/tokens", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/settings/tokens login=%v\n", u.Login)
+
+		ts, err := db.GetAccessTokens(u)
+		if err != nil {
+			log.Printf("Failed to list access tokens: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load tokens")
+			return
+		}
+
+		io.WriteString(w, internal.RenderAccessTokens(ts, "/do_revoke_token"))
+		io.WriteString(w, internal.RenderAccessTokenForm())
+	})
+
+	// The secret of a new token is shown on the page answering the form,
+	// since it is not stored anywhere to be shown later.
+	r.Post("/do_create_token", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		t := &core.AccessToken{User: u, Name: strings.TrimSpace(r.Form.Get("name")), Scopes: []core.Scope{}}
+		if t.Name == "" {
+			err = fmt.Errorf("Token of user %v has no name", u.Id)
+		}
+
+		for _, name := range r.Form["scope"] {
+			if err != nil {
+				break
+			}
+
+			var s core.Scope
+			s, err = core.ParseScope(name)
+			if err == nil && !t.Allows(s) {
+				t.Scopes = append(t.Scopes, s)
+			}
+		}
+
+		if err == nil && len(t.Scopes) == 0 {
+			err = fmt.Errorf("Token of user %v has no scopes", u.Id)
+		}
+
+		days := 0
+		if err == nil {
+			days, err = strconv.Atoi(r.Form.Get("expires_in"))
+		}
+
+		if err == nil && days < 0 {
+			err = fmt.Errorf("Token of user %v expires in %v days", u.Id, days)
+		}
+
+		if err == nil && days > 0 {
+			t.ExpiresAt = time.Now().AddDate(0, 0, days)
+		}
+
+		secret := ""
+		if err == nil {
+			secret, err = internal.NewAccessTokenSecret()
+		}
+
+		if err == nil {
+			log.Printf("/do_create_token name=%q login=%v\n", t.Name, u.Login)
+			err = db.CreateAccessToken(t, internal.HashAccessToken(secret))
+		}
+
+		if err != nil {
+			log.Printf("Failed to create access token: %v\n", err)
+			internal.WriteErrorString(w, "Cannot create such token, it needs a name and at least one scope")
+			return
+		}
+
+		internal.Audit(db, r, core.AuditTokenCreate, u, u, fmt.Sprintf("token=%v name=%q scopes=%v", t.Id, t.Name, t.Scopes))
+
+		io.WriteString(w, internal.RenderNewAccessToken(t, secret))
+	})
+
+	r.Post("/do_revoke_token", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		var t *core.AccessToken
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil {
+			t, err = db.LoadAccessToken(id)
+		}
+
+		if err == nil && t.User.Id != u.Id {
+			err = fmt.Errorf("Access token %v is not of user %v", t.Id, u.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_revoke_token id=%v login=%v\n", t.Id, u.Login)
+			err = db.RevokeAccessToken(t)
+		}
+
+		if err != nil {
+			log.Printf("Failed to revoke access token: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot revoke such token")
+			return
+		}
+
+		internal.Audit(db, r, core.AuditTokenRevoke, u, u, fmt.Sprintf("token=%v", t.Id))
+
+		http.Redirect(w, r, "/settings/tokens", http.StatusSeeOther)
+	})
+
+	r.Post("/do_logout", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		s, err := internal.GetSession(r, db)
+		if err == nil {
+			log.Printf("/do_logout login=%v session=%v\n", s.User.Login, s.Id)
+			err = db.RevokeSession(s)
+		}
+
+		if err != nil {
+			log.Printf("Failed to log out: %v\n", err)
+		} else {
+			internal.Audit(db, r, core.AuditLogout, s.User, nil, fmt.Sprintf("session=%v", s.Id))
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: "socnet_token", Value: "", MaxAge: -1})
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// adminPageSize is how many users and reports admin pages list.
+	adminPageSize = 100
+	// statsDays is how many days the statistics go back.
+	statsDays = 30
+	// auditPageSize is how many events a page of the audit log shows.
+	auditPageSize = 100
+)
+
+func registerAdminRoutes(r chi.Router) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(internal.RequirePermission(core.PermissionAdminister))
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			u, err := internal.GetCurrentUser(r, db)
+			if err != nil {
+				log.Printf("Failed to verify token due to %v\n", err)
+				internal.WriteNotLoggedIn(w)
+				return
+			}
+
+			log.Printf("/admin login=%v\n", u.Login)
+
+			staff, err := db.GetStaff()
+			if err != nil {
+				log.Printf("Failed to list staff: %v\n", err)
+				internal.WriteErrorString(w, "Cannot load staff")
+				return
+			}
+
+			io.WriteString(w, internal.RenderAdmin(staff))
+		})
+
+		// The target is either ?id= from the staff list or the login field
+		// of the form giving roles.
+		r.Post("/do_set_role", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			u, err := internal.GetCurrentUser(r, db)
+			if err != nil {
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteNotLoggedIn(w)
+				return
+			}
+
+			r.ParseForm()
+			role, err := core.ParseRole(r.Form.Get("role"))
+
+			var other *core.User
+			if err == nil {
+				if login := r.Form.Get("login"); login != "" {
+					other, err = db.FindUser(login)
+				} else {
+					var id int
+					id, err = strconv.Atoi(r.URL.Query().Get("id"))
+					if err == nil {
+						other, err = db.LoadUser(id)
+					}
+				}
+			}
+
+			// Admins cannot demote themselves, so there is always one left.
+			if err == nil && other.Id == u.Id {
+				err = fmt.Errorf("User %v cannot change their own role", u.Id)
+			}
+
+			if err == nil {
+				log.Printf("/admin/do_set_role login=%v target=%v role=%v\n", u.Login, other.Id, role)
+				err = db.SetUserRole(other, role)
+			}
+
+			if err != nil {
+				log.Printf("Failed to set role: %v\n", err)
+
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteErrorString(w, "Cannot change role")
+				return
+			}
+
+			internal.Audit(db, r, core.AuditRoleChange, u, other, fmt.Sprintf("role=%v", role))
+
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		})
+
+		r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			query := r.URL.Query().Get("q")
+			log.Printf("/admin/users q=%v\n", query)
+
+			us := []core.User{}
+			if query != "" {
+				var err error
+				us, err = db.FindUsers(query, adminPageSize)
+				if err != nil {
+					log.Printf("Failed to find users: %v\n", err)
+					internal.WriteErrorString(w, "Cannot find users")
+					return
+				}
+			}
+
+			io.WriteString(w, internal.RenderAdminUserSearch(query, us))
+		})
+
+		r.Get("/user", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			var u *core.User
+			id, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err == nil {
+				u, err = db.LoadUser(id)
+			}
+
+			if err != nil {
+				log.Printf("Failed to find user: %v\n", err)
+				internal.WriteErrorString(w, "Cannot find such user")
+				return
+			}
+
+			log.Printf("/admin/user id=%v\n", u.Id)
+
+			// The owner may see all of their posts.
+			ps, err := db.GetPostsByUser(u, u)
+
+			var ss []core.Session
+			if err == nil {
+				ss, err = db.GetSessions(u)
+			}
+
+			var rs []core.Report
+			if err == nil {
+				rs, err = db.GetReportsAbout(u, adminPageSize)
+			}
+
+			if err != nil {
+				log.Printf("Failed to load user %v: %v\n", u.Id, err)
+				internal.WriteErrorString(w, "Cannot load user")
+				return
+			}
+
+			io.WriteString(w, internal.RenderAdminUser(u, ps, ss, rs))
+		})
+
+		// accountAction applies change to the account ?id=, which must not
+		// be the account of the admin, and audits it as kind.
+		accountAction := func(w http.ResponseWriter, r *http.Request, kind core.AuditEventKind, change func(db core.Database, u *core.User) error) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			admin, err := internal.GetCurrentUser(r, db)
+			if err != nil {
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteNotLoggedIn(w)
+				return
+			}
+
+			r.ParseForm()
+
+			var u *core.User
+			id, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err == nil {
+				u, err = db.LoadUser(id)
+			}
+
+			if err == nil && u.Id == admin.Id {
+				err = fmt.Errorf("User %v cannot use %v on their own account", admin.Id, r.URL.Path)
+			}
+
+			if err == nil {
+				log.Printf("%v login=%v target=%v\n", r.URL.Path, admin.Login, u.Id)
+				err = change(db, u)
+			}
+
+			if err != nil {
+				log.Printf("Failed to change account: %v\n", err)
+
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteErrorString(w, "Cannot change such account")
+				return
+			}
+
+			internal.Audit(db, r, kind, admin, u, "")
+
+			redirectUrl := fmt.Sprintf("/admin/user?id=%v", u.Id)
+			if r.URL.Path == "/admin/do_delete_user" {
+				redirectUrl = "/admin/users"
+			}
+
+			http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+		}
+
+		// Staff must be demoted before their account is suspended, reset or
+		// deleted, so that no admin locks out another one.
+		requireNotStaff := func(u *core.User) error {
+			if u.Role != core.RoleUser {
+				return fmt.Errorf("User %v is %v", u.Id, u.Role)
+			}
+
+			return nil
+		}
+
+		r.Post("/do_suspend", func(w http.ResponseWriter, r *http.Request) {
+			accountAction(w, r, core.AuditSuspend, func(db core.Database, u *core.User) error {
+				if err := requireNotStaff(u); err != nil {
+					return err
+				}
+
+				return db.SetUserSuspended(u, true)
+			})
+		})
+
+		r.Post("/do_unsuspend", func(w http.ResponseWriter, r *http.Request) {
+			accountAction(w, r, core.AuditUnsuspend, func(db core.Database, u *core.User) error {
+				return db.SetUserSuspended(u, false)
+			})
+		})
+
+		// Forcing a reset logs the user out and revokes their access tokens,
+		// and their next login leads to the password page.
+		r.Post("/do_force_password_reset", func(w http.ResponseWriter, r *http.Request) {
+			accountAction(w, r, core.AuditPasswordResetForce, func(db core.Database, u *core.User) error {
+				if err := requireNotStaff(u); err != nil {
+					return err
+				}
+
+				err := db.SetPasswordResetRequired(u, true)
+				if err != nil {
+					return err
+				}
+
+				err = db.RevokeSessions(u)
+				if err != nil {
+					return err
+				}
+
+				return db.RevokeAccessTokens(u)
+			})
+		})
+
+		// The login must be typed to confirm. The moderation history keeps
+		// the login of moderators.
+		r.Post("/do_delete_user", func(w http.ResponseWriter, r *http.Request) {
+			accountAction(w, r, core.AuditAccountDelete, func(db core.Database, u *core.User) error {
+				if r.Form.Get("login") != u.Login {
+					return fmt.Errorf("Deleting user %v is not confirmed", u.Id)
+				}
+
+				if err := requireNotStaff(u); err != nil {
+					return err
+				}
+
+				return db.DeleteUser(u)
+			})
+		})
+
+		r.Post("/do_revoke_session", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			admin, err := internal.GetCurrentUser(r, db)
+			if err != nil {
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteNotLoggedIn(w)
+				return
+			}
+
+			var s *core.Session
+			id, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err == nil {
+				s, err = db.LoadSession(id)
+			}
+
+			if err == nil {
+				log.Printf("/admin/do_revoke_session id=%v login=%v\n", s.Id, admin.Login)
+				err = db.RevokeSession(s)
+			}
+
+			if err != nil {
+				log.Printf("Failed to revoke session: %v\n", err)
+
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteErrorString(w, "Cannot revoke such session")
+				return
+			}
+
+			internal.Audit(db, r, core.AuditSessionRevoke, admin, s.User, fmt.Sprintf("session=%v", s.Id))
+
+			http.Redirect(w, r, fmt.Sprintf("/admin/user?id=%v", s.User.Id), http.StatusSeeOther)
+		})
+
+		r.Get("/stats", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			log.Printf("/admin/stats\n")
+
+			stats, err := db.GetDailyStats(statsDays)
+			if err != nil {
+				log.Printf("Failed to count statistics: %v\n", err)
+				internal.WriteErrorString(w, "Cannot load statistics")
+				return
+			}
+
+			io.WriteString(w, internal.RenderDailyStats(stats))
+		})
+
+		r.Get("/audit", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			query := r.URL.Query()
+			f := core.AuditFilter{ActorLogin: query.Get("actor"), TargetLogin: query.Get("target")}
+			f.BeforeId, _ = strconv.Atoi(query.Get("before"))
+			if s := query.Get("kind"); s != "" {
+				kind, err := core.ParseAuditEventKind(s)
+				if err != nil {
+					log.Printf("Invalid audit event kind: %v\n", err)
+					internal.WriteErrorString(w, "Cannot filter by such event")
+					return
+				}
+				f.Kind = &kind
+			}
+
+			log.Printf("/admin/audit query=%v\n", r.URL.RawQuery)
+
+			// One more event than shown tells whether there is a next page.
+			es, err := db.GetAuditEvents(f, auditPageSize+1)
+			if err != nil {
+				log.Printf("Failed to list audit events: %v\n", err)
+				internal.WriteErrorString(w, "Cannot load audit log")
+				return
+			}
+
+			io.WriteString(w, internal.RenderAuditLog(f, es, auditPageSize))
+		})
+
+		r.Get("/audit/verify", func(w http.ResponseWriter, r *http.Request) {
+			db := internal.NewDatabase()
+			defer db.Close()
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			log.Printf("/admin/audit/verify\n")
+
+			count, head, err := internal.VerifyAuditLog(db)
+			if err != nil {
+				log.Printf("Audit log verification failed: %v\n", err)
+				internal.WriteErrorString(w, html.EscapeString(fmt.Sprintf("The audit log was tampered with: %v", err)))
+				return
+			}
+
+			internal.WriteMessageString(w, fmt.Sprintf("All %v audit events are intact. %v.", count, internal.DescribeAuditHead(head)))
+		})
+
+		registerAdminWebhookRoutes(r)
+	})
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	apiDefaultPageSize = 20
+	apiMaxPageSize     = 100
+)
+
+// apiHandler serves an API request of viewer, who is nil for anonymous
+// requests.
+type apiHandler func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User)
+
+// handleApi registers h as the operation of apiOperations at method and
+// path, so that it requires what the document says of the operation.
+func handleApi(r chi.Router, method string, path string, h apiHandler) {
+	for _, op := range apiOperations {
+		if op.Method == method && op.Path == path {
+			r.Method(method, path, api(op, h))
+			return
+		}
+	}
+
+	log.Fatalf("%v %v is not in the OpenAPI document\n", method, path)
+}
+
+// api opens the database and resolves the bearer token of the request for
+// h. Endpoints of operations with Auth refuse anonymous requests, and
+// personal access tokens must have the Scope of op.
+func api(op internal.ApiOperation, h apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		b, err := internal.GetBearer(r, db)
+		if err != nil {
+			log.Printf("%v %v invalid token: %v\n", r.Method, r.URL.Path, err)
+			internal.WriteApiError(w, http.StatusUnauthorized, "unauthorized", "The bearer token is invalid, expired or revoked")
+			return
+		}
+
+		var viewer *core.User
+		if b != nil {
+			viewer = b.User
+
+			if !b.Allows(op.Scope) {
+				internal.WriteApiError(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("The access token needs the %v scope", op.Scope))
+				return
+			}
+		}
+
+		if viewer == nil && op.Auth {
+			internal.WriteApiError(w, http.StatusUnauthorized, "unauthorized", "This endpoint needs a bearer token")
+			return
+		}
+
+		login := ""
+		if viewer != nil {
+			login = viewer.Login
+		}
+		log.Printf("%v %v login=%v\n", r.Method, r.URL.Path, login)
+
+		h(w, r, db, viewer)
+	}
+}
+
+// apiPage reads the cursor and the limit query of a page request.
+func apiPage(r *http.Request) (int, int, error) {
+	query := r.URL.Query()
+
+	cursor, err := internal.DecodeCursor(query.Get("cursor"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	limit := apiDefaultPageSize
+	if s := query.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > apiMaxPageSize {
+			return 0, 0, fmt.Errorf("Limit must be 1 to %v", apiMaxPageSize)
+		}
+	}
+
+	return cursor, limit, nil
+}
+
+// apiId reads the {id} of the route.
+func apiId(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "id"))
+}
+
+func writeApiBadRequest(w http.ResponseWriter, err error) {
+	internal.WriteApiError(w, http.StatusBadRequest, "bad_request", err.Error())
+}
+
+func writeApiNotFound(w http.ResponseWriter, what string) {
+	internal.WriteApiError(w, http.StatusNotFound, "not_found", fmt.Sprintf("No such %v", what))
+}
+
+func writeApiInternalError(w http.ResponseWriter, err error) {
+	log.Printf("API request failed: %v\n", err)
+	internal.WriteApiError(w, http.StatusInternalServerError, "internal", "Something went wrong")
+}
+
+// loadApiUser loads the user {id} or writes why it cannot.
+func loadApiUser(w http.ResponseWriter, r *http.Request, db core.Database) *core.User {
+	id, err := apiId(r)
+	if err != nil {
+		writeApiBadRequest(w, fmt.Errorf("Invalid user id"))
+		return nil
+	}
+
+	u, err := db.LoadUser(id)
+	if err != nil {
+		writeApiNotFound(w, "user")
+		return nil
+	}
+
+	return u
+}
+
+// loadApiPost loads the post {id} if viewer may see it, or writes why it
+// cannot. Posts viewer may not see do not exist for viewer.
+func loadApiPost(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Post {
+	id, err := apiId(r)
+	if err != nil {
+		writeApiBadRequest(w, fmt.Errorf("Invalid post id"))
+		return nil
+	}
+
+	p, err := db.LoadPost(id)
+	if err != nil || !internal.CanViewPost(viewer, p, db) {
+		writeApiNotFound(w, "post")
+		return nil
+	}
+
+	return p
+}
+
+// loadApiComment loads the comment {id} if viewer may see its post, or
+// writes why it cannot.
+func loadApiComment(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Comment {
+	id, err := apiId(r)
+	if err != nil {
+		writeApiBadRequest(w, fmt.Errorf("Invalid comment id"))
+		return nil
+	}
+
+	c, err := db.LoadComment(id)
+	if err != nil || !internal.CanViewPost(viewer, c.CommentedPost, db) {
+		writeApiNotFound(w, "comment")
+		return nil
+	}
+
+	return c
+}
+
+// writeApiPosts writes a page of ps, which has one more post than the
+// page if there is a next one.
+func writeApiPosts(w http.ResponseWriter, db core.Database, viewer *core.User, ps []core.Post, limit int) {
+	next := ""
+	if len(ps) > limit {
+		ps = ps[:limit]
+		next = internal.EncodeCursor(ps[limit-1].Id)
+	}
+
+	aps := make([]internal.ApiPost, 0, len(ps))
+	for i := range ps {
+		ap, err := internal.NewApiPost(&ps[i], viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		aps = append(aps, ap)
+	}
+
+	internal.WriteApiPage(w, aps, next)
+}
+
+// registerApiRoutes registers the API, checking every exchange against its
+// document with report unless it is nil.
+func registerApiRoutes(r chi.Router, hub core.Hub, report internal.ApiViolationReport) {
+	doc := newApiDocument()
+	registerOpenApiRoutes(r, doc)
+
+	r.Route(apiBase, func(r chi.Router) {
+		if report != nil {
+			r.Use(doc.Validator(report))
+		}
+
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			internal.WriteApiError(w, http.StatusNotFound, "not_found", "No such endpoint")
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			internal.WriteApiError(w, http.StatusMethodNotAllowed, "method_not_allowed", "The endpoint does not take this method")
+		})
+
+		registerApiSessionRoutes(r)
+		registerApiUserRoutes(r)
+		registerApiPostRoutes(r)
+		registerApiLikeRoutes(r)
+		registerApiMessageRoutes(r, hub)
+
+		checkApiDocument(doc, r)
+	})
+}
+
+func registerApiSessionRoutes(r chi.Router) {
+	// Logging in trades a login and a password for a bearer token.
+	handleApi(r, http.MethodPost, "/sessions", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		req := internal.ApiLoginRequest{}
+		if err := internal.ReadApiRequest(w, r, &req); err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		u, err := db.VerifyUser(req.Login, internal.GetHash([]byte(req.Password)))
+		if err == nil && u != nil && u.Suspended {
+			err = fmt.Errorf("User %v is suspended", u.Id)
+		}
+
+		if err != nil || u == nil {
+			log.Printf("API login failed: %v\n", err)
+
+			attempted, _ := db.FindUser(req.Login)
+			internal.Audit(db, r, core.AuditLoginFailed, nil, attempted, fmt.Sprintf("login=%q api", req.Login))
+
+			internal.WriteApiError(w, http.StatusUnauthorized, "unauthorized", "Wrong login or password")
+			return
+		}
+
+		if u.PasswordResetRequired {
+			internal.WriteApiError(w, http.StatusForbidden, "password_reset_required", "Change the password on the website first")
+			return
+		}
+
+		s, token, err := internal.OpenSession(r, db, u)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.Audit(db, r, core.AuditLogin, u, nil, fmt.Sprintf("session=%v api", s.Id))
+
+		internal.WriteApiData(w, http.StatusCreated, internal.ApiToken{Token: token, User: internal.NewApiUser(u, u, db)})
+	})
+
+	handleApi(r, http.MethodDelete, "/sessions/current", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		b, err := internal.GetBearer(r, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		s := b.Session
+		if s == nil {
+			writeApiBadRequest(w, fmt.Errorf("Personal access tokens are revoked in the settings"))
+			return
+		}
+
+		if err := db.RevokeSession(s); err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.Audit(db, r, core.AuditLogout, viewer, nil, fmt.Sprintf("session=%v api", s.Id))
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func registerApiUserRoutes(r chi.Router) {
+	handleApi(r, http.MethodGet, "/me", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		ap, err := internal.NewApiProfile(viewer, viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.WriteApiData(w, http.StatusOK, ap)
+	})
+
+	handleApi(r, http.MethodGet, "/users/{id}", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		u := loadApiUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		ap, err := internal.NewApiProfile(u, viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.WriteApiData(w, http.StatusOK, ap)
+	})
+
+	handleApi(r, http.MethodGet, "/users/{id}/posts", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		u := loadApiUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		cursor, limit, err := apiPage(r)
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		ps, err := db.GetPostsPage(viewer, u, cursor, limit+1)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		writeApiPosts(w, db, viewer, ps, limit)
+	})
+
+	handleApi(r, http.MethodPut, "/users/{id}/follow", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		u := loadApiUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		if u.Id == viewer.Id {
+			writeApiBadRequest(w, fmt.Errorf("Cannot follow yourself"))
+			return
+		}
+
+		if internal.IsBlockedBy(viewer, u, db) {
+			internal.WriteApiError(w, http.StatusForbidden, "forbidden", "Cannot follow this user")
+			return
+		}
+
+		following, err := db.IsFollowing(viewer, u)
+		if err == nil && !following {
+			err = db.Follow(viewer, u)
+			if err == nil {
+				internal.Notify(db, &core.Notification{Recipient: u, Actor: viewer, Kind: core.NotificationFollow})
+				internal.HookFollow(db, viewer, u)
+			}
+		}
+
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handleApi(r, http.MethodDelete, "/users/{id}/follow", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		u := loadApiUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		if err := db.Unfollow(viewer, u); err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handleApi(r, http.MethodGet, "/feed", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		cursor, limit, err := apiPage(r)
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		ps, err := db.GetPostsPage(viewer, nil, cursor, limit+1)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		writeApiPosts(w, db, viewer, ps, limit)
+	})
+}
+
+func registerApiPostRoutes(r chi.Router) {
+	handleApi(r, http.MethodPost, "/posts", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		req := internal.ApiPostRequest{}
+		err := internal.ReadApiRequest(w, r, &req)
+
+		p := &core.Post{Author: viewer, Content: []byte(req.Content), Visibility: core.VisibilityPublic}
+		if err == nil && req.Visibility != "" {
+			p.Visibility, err = core.ParseVisibility(req.Visibility)
+		}
+
+		if err == nil && req.RepostOf == 0 && req.Content == "" {
+			err = fmt.Errorf("Empty posts are not allowed")
+		}
+
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		if req.RepostOf != 0 {
+			original, err := db.LoadPost(req.RepostOf)
+
+			// Sharing a plain repost shares what it reposted.
+			if err == nil && original.IsPlainRepost() {
+				original, err = db.LoadPost(original.RepostOfId)
+			}
+
+			if err != nil || !internal.CanViewPost(viewer, original, db) {
+				writeApiNotFound(w, "post to repost")
+				return
+			}
+
+			p.RepostOfId = original.Id
+		}
+
+		if err := db.CreatePost(p); err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.TagPost(db, p)
+		internal.Mention(db, viewer, p, 0, p.Content)
+		internal.HookPost(db, p)
+		internal.FederatePost(db, p)
+
+		ap, err := internal.NewApiPost(p, viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.WriteApiData(w, http.StatusCreated, ap)
+	})
+
+	handleApi(r, http.MethodGet, "/posts/{id}", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		p := loadApiPost(w, r, db, viewer)
+		if p == nil {
+			return
+		}
+
+		ap, err := internal.NewApiPost(p, viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.WriteApiData(w, http.StatusOK, ap)
+	})
+
+	handleApi(r, http.MethodDelete, "/posts/{id}", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		p := loadApiPost(w, r, db, viewer)
+		if p == nil {
+			return
+		}
+
+		if p.Author.Id != viewer.Id {
+			internal.WriteApiError(w, http.StatusForbidden, "forbidden", "Only the author can delete a post")
+			return
+		}
+
+		if err := db.DeletePost(p); err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Plain reposts show the original, so their comments are the comments
+	// of the original.
+	commentedPost := func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Post {
+		p := loadApiPost(w, r, db, viewer)
+		if p == nil || !p.IsPlainRepost() {
+			return p
+		}
+
+		original, err := db.LoadPost(p.RepostOfId)
+		if err != nil || !internal.CanViewPost(viewer, original, db) {
+			writeApiNotFound(w, "post")
+			return nil
+		}
+
+		return original
+	}
+
+	handleApi(r, http.MethodGet, "/posts/{id}/comments", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		p := commentedPost(w, r, db, viewer)
+		if p == nil {
+			return
+		}
+
+		cursor, limit, err := apiPage(r)
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		cs, err := db.GetCommentsPage(viewer, p, cursor, limit+1)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		next := ""
+		if len(cs) > limit {
+			cs = cs[:limit]
+			next = internal.EncodeCursor(cs[limit-1].Id)
+		}
+
+		acs := make([]internal.ApiComment, 0, len(cs))
+		for i := range cs {
+			ac, err := internal.NewApiComment(&cs[i], viewer, db)
+			if err != nil {
+				writeApiInternalError(w, err)
+				return
+			}
+
+			acs = append(acs, ac)
+		}
+
+		internal.WriteApiPage(w, acs, next)
+	})
+
+	handleApi(r, http.MethodPost, "/posts/{id}/comments", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		p := commentedPost(w, r, db, viewer)
+		if p == nil {
+			return
+		}
+
+		if p.Hidden {
+			internal.WriteApiError(w, http.StatusForbidden, "forbidden", "Hidden posts cannot be commented")
+			return
+		}
+
+		req := internal.ApiCommentRequest{}
+		err := internal.ReadApiRequest(w, r, &req)
+		if err == nil && req.Content == "" {
+			err = fmt.Errorf("Empty comments are not allowed")
+		}
+
+		if err == nil && req.ParentId != 0 {
+			parent, loadErr := db.LoadComment(req.ParentId)
+			if loadErr != nil || parent.CommentedPost.Id != p.Id {
+				err = fmt.Errorf("Comment %v is not a comment to post %v", req.ParentId, p.Id)
+			}
+		}
+
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		c := &core.Comment{Author: viewer, CommentedPost: p, Content: []byte(req.Content), ParentId: req.ParentId}
+		if err := db.CreateComment(c); err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.Notify(db, &core.Notification{
+			Recipient: p.Author,
+			Actor:     viewer,
+			Kind:      core.NotificationComment,
+			PostId:    p.Id,
+			CommentId: c.Id,
+		})
+		internal.Mention(db, viewer, p, c.Id, c.Content)
+		internal.HookComment(db, c)
+
+		ac, err := internal.NewApiComment(c, viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.WriteApiData(w, http.StatusCreated, ac)
+	})
+
+	handleApi(r, http.MethodGet, "/comments/{id}", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		c := loadApiComment(w, r, db, viewer)
+		if c == nil {
+			return
+		}
+
+		ac, err := internal.NewApiComment(c, viewer, db)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		internal.WriteApiData(w, http.StatusOK, ac)
+	})
+}
+
+// apiLikeTarget loads what the route likes into an empty like of viewer,
+// or writes why it cannot and returns nil.
+type apiLikeTarget func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Like
+
+func registerApiLikeRoutes(r chi.Router) {
+	targets := map[string]apiLikeTarget{
+		"/posts/{id}": func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Like {
+			p := loadApiPost(w, r, db, viewer)
+			if p == nil {
+				return nil
+			}
+
+			return &core.Like{Author: viewer, LikedPost: p}
+		},
+		"/comments/{id}": func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Like {
+			c := loadApiComment(w, r, db, viewer)
+			if c == nil {
+				return nil
+			}
+
+			return &core.Like{Author: viewer, LikedComment: c}
+		},
+	}
+
+	for prefix, target := range targets {
+		target := target
+
+		handleApi(r, http.MethodGet, prefix+"/likes", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+			l := target(w, r, db, viewer)
+			if l == nil {
+				return
+			}
+
+			ls, err := getLikes(l, db)
+			if err != nil {
+				writeApiInternalError(w, err)
+				return
+			}
+
+			als := make([]internal.ApiLike, 0, len(ls))
+			for i := range ls {
+				als = append(als, internal.ApiLike{User: internal.NewApiUser(ls[i].Author, viewer, db), Kind: ls[i].Kind})
+			}
+
+			internal.WriteApiData(w, http.StatusOK, als)
+		})
+
+		// Liking again with another kind changes the reaction.
+		handleApi(r, http.MethodPut, prefix+"/like", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+			l := target(w, r, db, viewer)
+			if l == nil {
+				return
+			}
+
+			req := internal.ApiLikeRequest{}
+			if r.ContentLength != 0 {
+				if err := internal.ReadApiRequest(w, r, &req); err != nil {
+					writeApiBadRequest(w, err)
+					return
+				}
+			}
+
+			reactions := internal.GetReactions()
+			if req.Kind == "" && len(reactions) != 0 {
+				req.Kind = reactions[0].Name
+			}
+
+			if core.FindReaction(reactions, req.Kind) == nil {
+				writeApiBadRequest(w, fmt.Errorf("Unknown like kind %v", req.Kind))
+				return
+			}
+
+			ls, err := getLikes(l, db)
+
+			previous := ""
+			for _, other := range ls {
+				if other.Author.Id == viewer.Id {
+					previous = other.Kind
+				}
+			}
+
+			l.Kind = req.Kind
+			if err == nil {
+				err = db.CreateLike(l)
+			}
+
+			if err != nil {
+				writeApiInternalError(w, err)
+				return
+			}
+
+			if previous == "" {
+				n := &core.Notification{Actor: viewer, Kind: core.NotificationLike}
+				if l.LikedComment != nil {
+					n.Recipient = l.LikedComment.Author
+					n.PostId = l.LikedComment.CommentedPost.Id
+					n.CommentId = l.LikedComment.Id
+				} else {
+					n.Recipient = l.LikedPost.Author
+					n.PostId = l.LikedPost.Id
+				}
+
+				internal.Notify(db, n)
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		handleApi(r, http.MethodDelete, prefix+"/like", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+			l := target(w, r, db, viewer)
+			if l == nil {
+				return
+			}
+
+			if err := db.DeleteLike(l); err != nil {
+				writeApiInternalError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// loadApiConversation loads the conversation {id} if viewer is one of its
+// members, or writes why it cannot.
+func loadApiConversation(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) *core.Conversation {
+	id, err := apiId(r)
+	if err != nil {
+		writeApiBadRequest(w, fmt.Errorf("Invalid conversation id"))
+		return nil
+	}
+
+	c, err := db.LoadConversation(id)
+	if err != nil || !c.IsMember(viewer) {
+		writeApiNotFound(w, "conversation")
+		return nil
+	}
+
+	return c
+}
+
+func registerApiMessageRoutes(r chi.Router, hub core.Hub) {
+	handleApi(r, http.MethodGet, "/conversations", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		cs, err := db.GetConversations(viewer)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		acs := make([]internal.ApiConversation, 0, len(cs))
+		for i := range cs {
+			acs = append(acs, internal.NewApiConversation(&cs[i], viewer, db))
+		}
+
+		internal.WriteApiData(w, http.StatusOK, acs)
+	})
+
+	// Messages are listed newest first, reading them marks the
+	// conversation read as the conversation page does.
+	handleApi(r, http.MethodGet, "/conversations/{id}/messages", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		c := loadApiConversation(w, r, db, viewer)
+		if c == nil {
+			return
+		}
+
+		cursor, limit, err := apiPage(r)
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		ms, err := db.GetMessages(c, cursor, limit+1)
+		if err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		if len(ms) > 0 {
+			if err := db.MarkConversationRead(c, viewer, ms[0].Id); err != nil {
+				log.Printf("Failed to mark conversation %v read: %v\n", c.Id, err)
+			}
+		}
+
+		next := ""
+		if len(ms) > limit {
+			ms = ms[:limit]
+			next = internal.EncodeCursor(ms[limit-1].Id)
+		}
+
+		ams := make([]internal.ApiMessage, 0, len(ms))
+		for i := range ms {
+			ams = append(ams, internal.NewApiMessage(&ms[i], viewer, db))
+		}
+
+		internal.WriteApiPage(w, ams, next)
+	})
+
+	handleApi(r, http.MethodPost, "/conversations/{id}/messages", func(w http.ResponseWriter, r *http.Request, db core.Database, viewer *core.User) {
+		c := loadApiConversation(w, r, db, viewer)
+		if c == nil {
+			return
+		}
+
+		req := internal.ApiMessageRequest{}
+		err := internal.ReadApiRequest(w, r, &req)
+		if err == nil && req.Content == "" {
+			err = fmt.Errorf("Empty messages are not allowed")
+		}
+
+		if err != nil {
+			writeApiBadRequest(w, err)
+			return
+		}
+
+		if !internal.CanWrite(viewer, c, db) {
+			internal.WriteApiError(w, http.StatusForbidden, "forbidden", "A member does not accept messages from you")
+			return
+		}
+
+		m := &core.Message{Conversation: c, Author: viewer, Content: []byte(req.Content)}
+		if err := db.CreateMessage(m); err != nil {
+			writeApiInternalError(w, err)
+			return
+		}
+
+		hub.Publish(internal.ConversationMemberIds(c, 0), internal.NewMessageEvent(m))
+		notifyAboutMessage(db, m)
+
+		internal.WriteApiData(w, http.StatusCreated, internal.NewApiMessage(m, viewer, db))
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/JouleJ/socnet/internal/testdb"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiTester sends requests to the API with validation on, and keeps which
+// operations were exercised and the violations of the document.
+type apiTester struct {
+	t          *testing.T
+	router     chi.Router
+	covered    map[string]bool
+	violations []string
+}
+
+func newApiTester(t *testing.T) *apiTester {
+	testdb.Create(t)
+
+	a := &apiTester{t: t, covered: map[string]bool{}}
+	a.router = chi.NewRouter()
+	registerApiRoutes(a.router, internal.NewHub(), func(r *http.Request, path string, problem string) {
+		a.violations = append(a.violations, problem)
+	})
+
+	return a
+}
+
+// call sends method to path under the base with body, as the owner of token
+// unless it is empty, and fails unless the answer has status and matches
+// the document. route is the pattern of the operation path belongs to. It
+// returns the data of the answer.
+func (a *apiTester) call(method string, route string, path string, token string, body string, status int) map[string]any {
+	a.t.Helper()
+	a.covered[method+" "+route] = true
+	a.violations = nil
+
+	r := httptest.NewRequest(method, apiBase+path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, r)
+
+	if w.Code != status {
+		a.t.Errorf("%v %v answered %v, not %v: %v", method, path, w.Code, status, w.Body.String())
+	}
+
+	for _, problem := range a.violations {
+		a.t.Errorf("%v %v does not match the document: %v", method, path, problem)
+	}
+
+	answer := map[string]any{}
+	if w.Body.Len() != 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+			a.t.Errorf("%v %v answered no JSON: %v", method, path, err)
+		}
+	}
+
+	data, _ := answer["data"].(map[string]any)
+	return data
+}
+
+// id reads the id in data, as JSON numbers decode to float64.
+func id(data map[string]any) int {
+	n, _ := data["id"].(float64)
+	return int(n)
+}
+
+func TestApiMatchesDocument(t *testing.T) {
+	a := newApiTester(t)
+
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+
+	db := internal.NewDatabase()
+	c := &core.Conversation{Members: []core.ConversationMember{{User: alice}, {User: bob}}}
+	if err := db.CreateConversation(c); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	session := a.call(http.MethodPost, "/sessions", "/sessions", "", `{"login": "alice", "password": "password"}`, http.StatusCreated)
+	token, _ := session["token"].(string)
+	a.call(http.MethodPost, "/sessions", "/sessions", "", `{"login": "alice", "password": "wrong"}`, http.StatusUnauthorized)
+	a.call(http.MethodPost, "/sessions", "/sessions", "", `{"login": 1}`, http.StatusBadRequest)
+
+	a.call(http.MethodGet, "/me", "/me", token, "", http.StatusOK)
+	a.call(http.MethodGet, "/me", "/me", "", "", http.StatusUnauthorized)
+	a.call(http.MethodGet, "/users/{id}", fmt.Sprintf("/users/%v", bob.Id), token, "", http.StatusOK)
+	a.call(http.MethodGet, "/users/{id}", "/users/1000", token, "", http.StatusNotFound)
+
+	bobPath := fmt.Sprintf("/users/%v", bob.Id)
+	a.call(http.MethodPut, "/users/{id}/follow", bobPath+"/follow", token, "", http.StatusNoContent)
+	a.call(http.MethodDelete, "/users/{id}/follow", bobPath+"/follow", token, "", http.StatusNoContent)
+	a.call(http.MethodPut, "/users/{id}/follow", bobPath+"/follow", token, "", http.StatusNoContent)
+
+	post := a.call(http.MethodPost, "/posts", "/posts", token, `{"content": "Hello #world", "visibility": "public"}`, http.StatusCreated)
+	postPath := fmt.Sprintf("/posts/%v", id(post))
+	a.call(http.MethodPost, "/posts", "/posts", token, `{"visibility": "everyone"}`, http.StatusBadRequest)
+	a.call(http.MethodPost, "/posts", "/posts", token, fmt.Sprintf(`{"repost_of": %v}`, id(post)), http.StatusCreated)
+	a.call(http.MethodPost, "/posts", "/posts", "", `{"content": "Anonymous"}`, http.StatusUnauthorized)
+
+	a.call(http.MethodGet, "/posts/{id}", postPath, "", "", http.StatusOK)
+	a.call(http.MethodGet, "/posts/{id}", "/posts/1000", "", "", http.StatusNotFound)
+	a.call(http.MethodGet, "/users/{id}/posts", fmt.Sprintf("/users/%v/posts?limit=1", alice.Id), "", "", http.StatusOK)
+	a.call(http.MethodGet, "/users/{id}/posts", fmt.Sprintf("/users/%v/posts?limit=0", alice.Id), "", "", http.StatusBadRequest)
+	a.call(http.MethodGet, "/feed", "/feed", token, "", http.StatusOK)
+	a.call(http.MethodGet, "/feed", "/feed?cursor=nonsense", token, "", http.StatusBadRequest)
+
+	comment := a.call(http.MethodPost, "/posts/{id}/comments", postPath+"/comments", token, `{"content": "First"}`, http.StatusCreated)
+	commentPath := fmt.Sprintf("/comments/%v", id(comment))
+	a.call(http.MethodPost, "/posts/{id}/comments", postPath+"/comments", token,
+		fmt.Sprintf(`{"content": "Reply", "parent_id": %v}`, id(comment)), http.StatusCreated)
+	a.call(http.MethodPost, "/posts/{id}/comments", postPath+"/comments", token, `{"content": ""}`, http.StatusBadRequest)
+	a.call(http.MethodGet, "/posts/{id}/comments", postPath+"/comments", "", "", http.StatusOK)
+	a.call(http.MethodGet, "/comments/{id}", commentPath, "", "", http.StatusOK)
+	a.call(http.MethodGet, "/comments/{id}", "/comments/1000", "", "", http.StatusNotFound)
+
+	a.call(http.MethodPut, "/posts/{id}/like", postPath+"/like", token, "", http.StatusNoContent)
+	a.call(http.MethodPut, "/posts/{id}/like", postPath+"/like", token, `{"kind": "nonsense"}`, http.StatusBadRequest)
+	a.call(http.MethodGet, "/posts/{id}/likes", postPath+"/likes", "", "", http.StatusOK)
+	a.call(http.MethodDelete, "/posts/{id}/like", postPath+"/like", token, "", http.StatusNoContent)
+	a.call(http.MethodPut, "/comments/{id}/like", commentPath+"/like", token, "", http.StatusNoContent)
+	a.call(http.MethodGet, "/comments/{id}/likes", commentPath+"/likes", "", "", http.StatusOK)
+	a.call(http.MethodDelete, "/comments/{id}/like", commentPath+"/like", token, "", http.StatusNoContent)
+
+	conversationPath := fmt.Sprintf("/conversations/%v", c.Id)
+	a.call(http.MethodGet, "/conversations", "/conversations", token, "", http.StatusOK)
+	a.call(http.MethodPost, "/conversations/{id}/messages", conversationPath+"/messages", token, `{"content": "Hi bob"}`, http.StatusCreated)
+	a.call(http.MethodPost, "/conversations/{id}/messages", conversationPath+"/messages", token, `{}`, http.StatusBadRequest)
+	a.call(http.MethodGet, "/conversations/{id}/messages", conversationPath+"/messages", token, "", http.StatusOK)
+	a.call(http.MethodGet, "/conversations/{id}/messages", "/conversations/1000/messages", token, "", http.StatusNotFound)
+
+	a.call(http.MethodDelete, "/posts/{id}", postPath, token, "", http.StatusNoContent)
+	a.call(http.MethodDelete, "/posts/{id}", postPath, token, "", http.StatusNotFound)
+
+	a.call(http.MethodDelete, "/sessions/current", "/sessions/current", token, "", http.StatusNoContent)
+	a.call(http.MethodGet, "/me", "/me", token, "", http.StatusUnauthorized)
+
+	for _, op := range apiOperations {
+		if !a.covered[op.Method+" "+op.Path] {
+			t.Errorf("%v %v is not tested", op.Method, op.Path)
+		}
+	}
+}
+
+// The validation the test relies on must catch answers the document does
+// not describe.
+func TestApiValidatorReportsViolations(t *testing.T) {
+	doc := newApiDocument()
+
+	problems := doc.Check(http.MethodGet, "/me", nil, http.StatusOK, []byte(`{"data": {"id": "alice"}}`))
+	if len(problems) == 0 {
+		t.Errorf("A string id was not reported")
+	}
+
+	problems = doc.Check(http.MethodPost, "/posts", []byte(`{"content": 1}`), http.StatusCreated, nil)
+	if len(problems) != 2 || !strings.Contains(problems[0], "request.content") {
+		t.Errorf("Accepting a wrong request with an empty answer reported %v", problems)
+	}
+
+	reported := []string{}
+	router := chi.NewRouter()
+	router.Route(apiBase, func(r chi.Router) {
+		r.Use(doc.Validator(func(r *http.Request, path string, problem string) {
+			reported = append(reported, r.Method+" "+path+": "+problem)
+		}))
+		r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+			internal.WriteApiData(w, http.StatusOK, map[string]any{"id": "alice"})
+		})
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, apiBase+"/me", nil))
+
+	if len(reported) == 0 || !strings.HasPrefix(reported[0], "GET /me: ") {
+		t.Errorf("The violation was not reported: %v", reported)
+	}
+}
+
+// Every route of the API must be in the document and the other way round,
+// checkApiDocument stops the server otherwise.
+func TestApiRoutesMatchDocument(t *testing.T) {
+	doc := newApiDocument()
+
+	router := chi.NewRouter()
+	router.Route(apiBase, func(r chi.Router) {
+		registerApiSessionRoutes(r)
+		registerApiUserRoutes(r)
+		registerApiPostRoutes(r)
+		registerApiLikeRoutes(r)
+		registerApiMessageRoutes(r, internal.NewHub())
+
+		routes := []string{}
+		chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			routes = append(routes, method+" "+route)
+			return nil
+		})
+
+		if err := doc.CheckRoutes(routes); err != nil {
+			t.Error(err)
+		}
+
+		checkApiDocument(doc, r)
+	})
+}
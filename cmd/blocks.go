@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func registerBlockRoutes(r chi.Router) {
+	r.Get("/settings/blocks", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/settings/blocks login=%v\n", u.Login)
+
+		lists := map[core.BlockKind][]core.User{}
+		for _, k := range core.BlockKinds {
+			lists[k], err = db.GetBlockedUsers(u, k)
+			if err != nil {
+				log.Printf("Failed to list blocked users: %v\n", err)
+				internal.WriteErrorString(w, "Cannot load blocked users")
+				return
+			}
+		}
+
+		io.WriteString(w, internal.RenderBlockSettings(lists))
+	})
+
+	// The target is either ?id= from a profile or the login field of the
+	// settings page.
+	block := func(w http.ResponseWriter, r *http.Request, on bool) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		kind, err := core.ParseBlockKind(r.URL.Query().Get("kind"))
+
+		var other *core.User
+		if err == nil {
+			if login := r.Form.Get("login"); login != "" {
+				other, err = db.FindUser(login)
+				if err == nil && other == nil {
+					err = fmt.Errorf("No user %v", login)
+				}
+			} else {
+				var id int
+				id, err = strconv.Atoi(r.URL.Query().Get("id"))
+				if err == nil {
+					other, err = db.LoadUser(id)
+				}
+			}
+		}
+
+		if err == nil && other.Id == u.Id {
+			err = fmt.Errorf("Cannot %v yourself", kind)
+		}
+
+		if err == nil {
+			log.Printf("%v kind=%v owner=%v target=%v\n", r.URL.Path, kind, u.Id, other.Id)
+			err = db.SetBlock(u, other, kind, on)
+		}
+
+		if err != nil {
+			log.Printf("Failed to change block list: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot change block list")
+			return
+		}
+
+		redirectUrl := r.Referer()
+		if redirectUrl == "" {
+			redirectUrl = "/settings/blocks"
+		}
+
+		http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+	}
+
+	r.Post("/do_block", func(w http.ResponseWriter, r *http.Request) {
+		block(w, r, true)
+	})
+
+	r.Post("/do_unblock", func(w http.ResponseWriter, r *http.Request) {
+		block(w, r, false)
+	})
+}
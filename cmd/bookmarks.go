@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	bookmarkPageSize = 100
+)
+
+// loadOwnCollection loads collection id of u, id 0 means no collection.
+func loadOwnCollection(id int, u *core.User, db core.Database) (*core.BookmarkCollection, error) {
+	if id == 0 {
+		return nil, nil
+	}
+
+	c, err := db.LoadBookmarkCollection(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Owner.Id != u.Id {
+		return nil, fmt.Errorf("User %v does not own bookmark collection %v", u.Id, c.Id)
+	}
+
+	return c, nil
+}
+
+func registerBookmarkRoutes(r chi.Router) {
+	r.Get("/bookmarks", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		id, _ := strconv.Atoi(r.URL.Query().Get("collection"))
+
+		log.Printf("/bookmarks login=%v collection=%v\n", u.Login, id)
+
+		c, err := loadOwnCollection(id, u, db)
+
+		var cs []core.BookmarkCollection
+		if err == nil {
+			cs, err = db.GetBookmarkCollections(u)
+		}
+
+		var bs []core.Bookmark
+		if err == nil {
+			bs, err = db.GetBookmarks(u, c, bookmarkPageSize)
+		}
+
+		if err != nil {
+			log.Printf("Failed to list bookmarks: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load bookmarks")
+			return
+		}
+
+		io.WriteString(w, internal.RenderBookmarkCollections(cs, c))
+
+		if len(bs) == 0 {
+			internal.WriteMessageString(w, "No bookmarks yet")
+		}
+
+		for _, b := range bs {
+			html, err := internal.RenderPost(b.Post, u, db)
+			if err != nil {
+				log.Printf("Failed to render post: id=%v, err=%v\n", b.Post.Id, err)
+			}
+
+			io.WriteString(w, html)
+		}
+	})
+
+	bookmark := func(w http.ResponseWriter, r *http.Request, remove bool) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+
+		var p *core.Post
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil {
+			p, err = db.LoadPost(id)
+		}
+
+		if err == nil && !internal.CanViewPost(u, p, db) {
+			err = fmt.Errorf("Post %v is not visible to user %v", p.Id, u.Id)
+		}
+
+		if err == nil {
+			log.Printf("%v id=%v login=%v\n", r.URL.Path, p.Id, u.Login)
+
+			if remove {
+				err = db.DeleteBookmark(u, p)
+			} else {
+				collectionId, _ := strconv.Atoi(r.Form.Get("collection"))
+
+				b := &core.Bookmark{Owner: u, Post: p}
+				b.Collection, err = loadOwnCollection(collectionId, u, db)
+				if err == nil {
+					err = db.CreateBookmark(b)
+				}
+			}
+		}
+
+		if err != nil {
+			log.Printf("Failed to change bookmark: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot bookmark such post")
+			return
+		}
+
+		redirectUrl := r.Referer()
+		if redirectUrl == "" {
+			redirectUrl = fmt.Sprintf("/post?id=%v", p.Id)
+		}
+
+		http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+	}
+
+	r.Post("/do_bookmark", func(w http.ResponseWriter, r *http.Request) {
+		bookmark(w, r, false)
+	})
+
+	r.Post("/do_unbookmark", func(w http.ResponseWriter, r *http.Request) {
+		bookmark(w, r, true)
+	})
+
+	r.Post("/do_bookmark_collection", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		name := strings.TrimSpace(r.Form.Get("name"))
+		if len(name) == 0 || len(name) > core.MaxBookmarkCollectionNameLength {
+			err = fmt.Errorf("Invalid bookmark collection name %v", name)
+		}
+
+		c := &core.BookmarkCollection{Owner: u, Name: name}
+		if err == nil {
+			log.Printf("/do_bookmark_collection login=%v name=%v\n", u.Login, name)
+			err = db.CreateBookmarkCollection(c)
+		}
+
+		if err != nil {
+			log.Printf("Failed to create bookmark collection: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot create such collection")
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/bookmarks?collection=%v", c.Id), http.StatusSeeOther)
+	})
+
+	r.Post("/do_delete_bookmark_collection", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+
+		var c *core.BookmarkCollection
+		if err == nil {
+			c, err = loadOwnCollection(id, u, db)
+		}
+
+		if err == nil && c != nil {
+			log.Printf("/do_delete_bookmark_collection id=%v login=%v\n", c.Id, u.Login)
+			err = db.DeleteBookmarkCollection(c)
+		}
+
+		if err != nil {
+			log.Printf("Failed to delete bookmark collection: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot delete such collection")
+			return
+		}
+
+		http.Redirect(w, r, "/bookmarks", http.StatusSeeOther)
+	})
+}
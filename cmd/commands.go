@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"io"
+	"os"
+	"time"
+)
+
+const commandsUsage = `Usage:
+    executable                   runs the server
+    executable make-admin LOGIN  gives LOGIN the admin role and lifts their suspension
+    executable export-audit-log  writes the audit log as JSON lines
+    executable verify-audit-log  checks the hash chain of the audit log
+
+Both audit log commands print the newest event and its hash, keep it
+elsewhere to notice events removed from the end of the log.`
+
+// auditRecord is an exported line of the audit log.
+type auditRecord struct {
+	Id          int       `json:"id"`
+	Kind        string    `json:"kind"`
+	ActorId     int       `json:"actor_id,omitempty"`
+	ActorLogin  string    `json:"actor_login,omitempty"`
+	TargetId    int       `json:"target_id,omitempty"`
+	TargetLogin string    `json:"target_login,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+// runCommand runs the administrative command args instead of the server.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "make-admin":
+		if len(args) != 2 {
+			return fmt.Errorf("make-admin takes a login\n%v", commandsUsage)
+		}
+
+		return makeAdmin(args[1])
+	case "export-audit-log":
+		return exportAuditLog(os.Stdout)
+	case "verify-audit-log":
+		return verifyAuditLog()
+	}
+
+	return fmt.Errorf("Unknown command %v\n%v", args[0], commandsUsage)
+}
+
+// makeAdmin bootstraps the first admin, who gives out the other roles at
+// /admin.
+func makeAdmin(login string) error {
+	db := internal.NewDatabase()
+	defer db.Close()
+
+	u, err := db.FindUser(login)
+	if err != nil {
+		return fmt.Errorf("Cannot find user %v: %v", login, err)
+	}
+
+	if err := db.SetUserRole(u, core.RoleAdmin); err != nil {
+		return fmt.Errorf("Cannot make %v an admin: %v", login, err)
+	}
+
+	internal.Audit(db, nil, core.AuditRoleChange, nil, u, "role=admin by make-admin")
+
+	// An admin locked out by a suspension is recovered the same way.
+	if u.Suspended {
+		if err := db.SetUserSuspended(u, false); err != nil {
+			return fmt.Errorf("Cannot unsuspend %v: %v", login, err)
+		}
+
+		internal.Audit(db, nil, core.AuditUnsuspend, nil, u, "by make-admin")
+	}
+
+	fmt.Printf("User %v (id %v) is now an admin\n", u.Login, u.Id)
+	return nil
+}
+
+// exportAuditLog writes the audit log to w oldest first, the hashes let the
+// export be verified elsewhere. The head of the log goes to stderr.
+func exportAuditLog(w io.Writer) error {
+	db := internal.NewDatabase()
+	defer db.Close()
+
+	var head *core.AuditEvent
+	encoder := json.NewEncoder(w)
+	err := db.ForEachAuditEvent(func(e *core.AuditEvent) error {
+		head = e
+		return encoder.Encode(auditRecord{
+			Id:          e.Id,
+			Kind:        e.Kind.String(),
+			ActorId:     e.ActorId,
+			ActorLogin:  e.ActorLogin,
+			TargetId:    e.TargetId,
+			TargetLogin: e.TargetLogin,
+			Address:     e.Address,
+			UserAgent:   e.UserAgent,
+			Detail:      e.Detail,
+			CreatedAt:   e.CreatedAt.UTC(),
+			PrevHash:    e.PrevHash,
+			Hash:        e.Hash,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, internal.DescribeAuditHead(head))
+	return nil
+}
+
+func verifyAuditLog() error {
+	db := internal.NewDatabase()
+	defer db.Close()
+
+	count, head, err := internal.VerifyAuditLog(db)
+	if err != nil {
+		return fmt.Errorf("The audit log was tampered with: %v", err)
+	}
+
+	fmt.Printf("All %v audit events are intact\n", count)
+	fmt.Println(internal.DescribeAuditHead(head))
+	return nil
+}
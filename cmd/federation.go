@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// loadFederatedUser returns the user with the id in the URL, writing a 404
+// unless other servers may see them.
+func loadFederatedUser(w http.ResponseWriter, r *http.Request, db core.Database) *core.User {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	u, err := db.LoadUser(id)
+	if err != nil || !internal.IsFederated(u, db) {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	return u
+}
+
+func registerFederationRoutes(r chi.Router, client internal.FederationClient) {
+	r.Get("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		resource := r.URL.Query().Get("resource")
+		log.Printf("/.well-known/webfinger resource=%v\n", resource)
+
+		wf, err := internal.FindWebFinger(resource, db)
+		if err != nil {
+			log.Printf("Failed to find %v: %v\n", resource, err)
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jrd+json")
+		json.NewEncoder(w).Encode(wf)
+	})
+
+	r.Get("/ap/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u := loadFederatedUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		log.Printf("/ap/users/%v\n", u.Id)
+
+		actor, err := internal.NewApActor(u, db)
+		if err != nil {
+			log.Printf("Failed to show actor %v: %v\n", u.Id, err)
+			http.Error(w, "Cannot show this actor", http.StatusInternalServerError)
+			return
+		}
+
+		internal.WriteActivityJson(w, actor)
+	})
+
+	r.Get("/ap/users/{id}/outbox", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u := loadFederatedUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		log.Printf("/ap/users/%v/outbox\n", u.Id)
+
+		outbox, err := internal.NewApOutbox(u, db)
+		if err != nil {
+			log.Printf("Failed to show outbox of %v: %v\n", u.Id, err)
+			http.Error(w, "Cannot show this outbox", http.StatusInternalServerError)
+			return
+		}
+
+		internal.WriteActivityJson(w, outbox)
+	})
+
+	r.Get("/ap/users/{id}/followers", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u := loadFederatedUser(w, r, db)
+		if u == nil {
+			return
+		}
+
+		log.Printf("/ap/users/%v/followers\n", u.Id)
+
+		followers, err := internal.NewApFollowers(u, db)
+		if err != nil {
+			log.Printf("Failed to show followers of %v: %v\n", u.Id, err)
+			http.Error(w, "Cannot show these followers", http.StatusInternalServerError)
+			return
+		}
+
+		internal.WriteActivityJson(w, followers)
+	})
+
+	r.Get("/ap/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		log.Printf("/ap/posts/%v\n", id)
+
+		p, err := db.LoadPost(id)
+		if err != nil || !internal.IsFederatedPost(p, db) {
+			http.NotFound(w, r)
+			return
+		}
+
+		note := internal.NewApNote(p, db)
+		note.Context = internal.ActivityStreamsContext
+		internal.WriteActivityJson(w, note)
+	})
+
+	// The inbox of every user and the shared inbox work alike, activities
+	// say themselves whom they are for.
+	inbox := func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, internal.MaxActivitySize))
+		if err != nil {
+			http.Error(w, "Cannot read the activity", http.StatusBadRequest)
+			return
+		}
+
+		actor, err := internal.VerifyInbox(db, client, r, body)
+		if err != nil {
+			log.Printf("%v: refusing activity: %v\n", r.URL.Path, err)
+			http.Error(w, "The signature cannot be verified", http.StatusUnauthorized)
+			return
+		}
+
+		log.Printf("%v actor=%v\n", r.URL.Path, actor.Uri)
+
+		err = internal.HandleActivity(db, actor, body)
+		if err != nil {
+			log.Printf("Failed to handle activity of %v: %v\n", actor.Uri, err)
+			http.Error(w, "Cannot handle the activity", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	r.Post("/ap/inbox", inbox)
+	r.Post("/ap/users/{id}/inbox", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		u := loadFederatedUser(w, r, db)
+		db.Close()
+
+		if u != nil {
+			inbox(w, r)
+		}
+	})
+}
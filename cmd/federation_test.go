@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/JouleJ/socnet/internal/testdb"
+	"github.com/go-chi/chi/v5"
+)
+
+// testSiteUrl is the SITE_URL of the server under test, which requests to
+// the router are addressed to.
+const testSiteUrl = "http://socnet.test"
+
+// remoteServer is an httptest server standing in for another server: it
+// publishes the actor mallory and keeps what is posted to its inbox,
+// answering status.
+type remoteServer struct {
+	*httptest.Server
+
+	actor      string
+	privatePem string
+
+	mutex    sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newRemoteServer(t *testing.T) *remoteServer {
+	privatePem, publicPem, err := internal.NewActorKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &remoteServer{privatePem: privatePem, status: http.StatusAccepted}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/mallory", func(w http.ResponseWriter, r *http.Request) {
+		internal.WriteActivityJson(w, &internal.ApActor{
+			Context:           internal.ActivityStreamsContext,
+			Id:                s.actor,
+			Type:              "Person",
+			PreferredUsername: "mallory",
+			Url:               s.URL + "/@mallory",
+			Inbox:             s.URL + "/inbox",
+			Outbox:            s.actor + "/outbox",
+			Followers:         s.actor + "/followers",
+			PublicKey:         &internal.ApPublicKey{Id: s.keyId(), Owner: s.actor, PublicKeyPem: publicPem},
+		})
+	})
+	mux.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mutex.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		status := s.status
+		s.mutex.Unlock()
+
+		w.WriteHeader(status)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	s.actor = s.URL + "/users/mallory"
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *remoteServer) keyId() string {
+	return s.actor + "#main-key"
+}
+
+func (s *remoteServer) setStatus(status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status = status
+}
+
+func (s *remoteServer) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.requests)
+}
+
+// activity returns the activity posted to the inbox i-th.
+func (s *remoteServer) activity(t *testing.T, i int) map[string]any {
+	t.Helper()
+
+	activity := map[string]any{}
+	if err := json.Unmarshal(s.bodies[i], &activity); err != nil {
+		t.Fatalf("Inbox got no JSON: %v", err)
+	}
+
+	return activity
+}
+
+// federationTester sends requests to the federation routes of a server at
+// testSiteUrl whose client reaches remote.
+type federationTester struct {
+	t      *testing.T
+	router chi.Router
+	remote *remoteServer
+	db     core.Database
+}
+
+func newFederationTester(t *testing.T) *federationTester {
+	testdb.Create(t)
+	t.Setenv("SITE_URL", testSiteUrl)
+
+	remote := newRemoteServer(t)
+
+	router := chi.NewRouter()
+	registerFederationRoutes(router, remote.Client())
+
+	db := internal.NewDatabase()
+	t.Cleanup(db.Close)
+
+	return &federationTester{t: t, router: router, remote: remote, db: db}
+}
+
+func (f *federationTester) get(path string, status int, v any) {
+	f.t.Helper()
+
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testSiteUrl+path, nil))
+
+	if w.Code != status {
+		f.t.Fatalf("GET %v answered %v, not %v: %v", path, w.Code, status, w.Body.String())
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			f.t.Fatalf("GET %v answered no JSON: %v", path, err)
+		}
+	}
+}
+
+// inboxRequest is a request posting body to path, signed as keyId with
+// privatePem.
+func (f *federationTester) inboxRequest(path string, body []byte, keyId string, privatePem string) *http.Request {
+	f.t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, testSiteUrl+path, bytes.NewReader(body))
+	r.Header.Set("Content-Type", internal.ActivityJsonType)
+	if err := internal.SignRequest(r, body, keyId, privatePem, time.Now()); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return r
+}
+
+func (f *federationTester) serve(r *http.Request) int {
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+
+	return w.Code
+}
+
+// send posts activity to path as mallory and fails unless it is answered
+// with status.
+func (f *federationTester) send(path string, activity map[string]any, status int) {
+	f.t.Helper()
+
+	body, err := json.Marshal(activity)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	if code := f.serve(f.inboxRequest(path, body, f.remote.keyId(), f.remote.privatePem)); code != status {
+		f.t.Fatalf("%v %v to %v answered %v, not %v", activity["type"], activity["id"], path, code, status)
+	}
+}
+
+// activity is an activity of mallory with the id id under its actor.
+func (f *federationTester) activity(kind string, id string, object any) map[string]any {
+	return map[string]any{
+		"@context": internal.ActivityStreamsContext,
+		"id":       f.remote.actor + id,
+		"type":     kind,
+		"actor":    f.remote.actor,
+		"object":   object,
+	}
+}
+
+// createTestPost stores a public post of author.
+func (f *federationTester) createTestPost(author *core.User, content string) *core.Post {
+	f.t.Helper()
+
+	p := &core.Post{Author: author, Content: []byte(content), Visibility: core.VisibilityPublic}
+	if err := f.db.CreatePost(p); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestFederationDocuments(t *testing.T) {
+	f := newFederationTester(t)
+
+	alice := createTestUser(t, "alice")
+	p := f.createTestPost(alice, "Hello #fediverse")
+
+	wf := &internal.WebFinger{}
+	f.get("/.well-known/webfinger?resource=acct:alice@socnet.test", http.StatusOK, wf)
+	if wf.Subject != "acct:alice@socnet.test" {
+		t.Errorf("WebFinger subject is %v", wf.Subject)
+	}
+
+	self := ""
+	for _, link := range wf.Links {
+		if link.Rel == "self" && link.Type == internal.ActivityJsonType {
+			self = link.Href
+		}
+	}
+	if self != internal.ActorUri(alice) {
+		t.Errorf("WebFinger links %+v, not %v", wf.Links, internal.ActorUri(alice))
+	}
+
+	f.get("/.well-known/webfinger?resource=acct:nobody@socnet.test", http.StatusNotFound, nil)
+	f.get("/.well-known/webfinger?resource=acct:alice@elsewhere.test", http.StatusNotFound, nil)
+
+	actor := &internal.ApActor{}
+	f.get(fmt.Sprintf("/ap/users/%v", alice.Id), http.StatusOK, actor)
+	if actor.Id != self || actor.PreferredUsername != "alice" || actor.Inbox != self+"/inbox" || actor.Outbox != self+"/outbox" {
+		t.Errorf("Wrong actor document: %+v", actor)
+	}
+	if actor.PublicKey == nil || actor.PublicKey.Id != self+"#main-key" || actor.PublicKey.Owner != self ||
+		!strings.Contains(actor.PublicKey.PublicKeyPem, "PUBLIC KEY") {
+		t.Errorf("Wrong public key: %+v", actor.PublicKey)
+	}
+
+	outbox := struct {
+		TotalItems   int                   `json:"totalItems"`
+		OrderedItems []internal.ApActivity `json:"orderedItems"`
+	}{}
+	f.get(fmt.Sprintf("/ap/users/%v/outbox", alice.Id), http.StatusOK, &outbox)
+	if outbox.TotalItems != 1 || len(outbox.OrderedItems) != 1 {
+		t.Fatalf("Outbox has %v items: %+v", outbox.TotalItems, outbox.OrderedItems)
+	}
+
+	create := outbox.OrderedItems[0]
+	note, _ := create.Object.(map[string]any)
+	if create.Type != "Create" || create.Actor != self || note["id"] != internal.PostUri(p) || note["type"] != "Note" {
+		t.Errorf("Wrong outbox item: %+v", create)
+	}
+
+	n := &internal.ApNote{}
+	f.get(fmt.Sprintf("/ap/posts/%v", p.Id), http.StatusOK, n)
+	if n.Id != internal.PostUri(p) || n.AttributedTo != self || !strings.Contains(n.Content, "Hello") {
+		t.Errorf("Wrong note: %+v", n)
+	}
+
+	// Neither private profiles nor private posts are published.
+	bob := createTestUser(t, "bob")
+	bob.Visibility = core.VisibilityFriends
+	if err := f.db.UpdateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+
+	hidden := &core.Post{Author: alice, Content: []byte("Friends only"), Visibility: core.VisibilityFriends}
+	if err := f.db.CreatePost(hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	f.get("/.well-known/webfinger?resource=acct:bob@socnet.test", http.StatusNotFound, nil)
+	f.get(fmt.Sprintf("/ap/users/%v", bob.Id), http.StatusNotFound, nil)
+	f.get(fmt.Sprintf("/ap/users/%v/outbox", bob.Id), http.StatusNotFound, nil)
+	f.get(fmt.Sprintf("/ap/posts/%v", hidden.Id), http.StatusNotFound, nil)
+}
+
+func TestFederationFollowIsAccepted(t *testing.T) {
+	f := newFederationTester(t)
+
+	alice := createTestUser(t, "alice")
+	inbox := fmt.Sprintf("/ap/users/%v/inbox", alice.Id)
+
+	f.send(inbox, f.activity("Follow", "/follows/1", internal.ActorUri(alice)), http.StatusAccepted)
+
+	fs, err := f.db.GetRemoteFollowers(alice)
+	if err != nil || len(fs) != 1 || fs[0].Actor.Uri != f.remote.actor || fs[0].Actor.Inbox != f.remote.URL+"/inbox" {
+		t.Fatalf("Remote followers are %+v: %v", fs, err)
+	}
+
+	followers := &internal.ApCollection{}
+	f.get(fmt.Sprintf("/ap/users/%v/followers", alice.Id), http.StatusOK, followers)
+	if followers.TotalItems != 1 {
+		t.Errorf("Followers collection has %v items", followers.TotalItems)
+	}
+
+	internal.DeliverActivities(f.db, f.remote.Client(), time.Now())
+	if f.remote.count() != 1 {
+		t.Fatalf("The remote inbox got %v requests, not 1", f.remote.count())
+	}
+
+	accept := f.remote.activity(t, 0)
+	follow, _ := accept["object"].(map[string]any)
+	if accept["type"] != "Accept" || accept["actor"] != internal.ActorUri(alice) ||
+		follow["id"] != f.remote.actor+"/follows/1" || follow["type"] != "Follow" {
+		t.Errorf("Wrong accept: %v", accept)
+	}
+
+	// The remote server checks the Accept against the published key.
+	key, err := f.db.GetActorKey(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := f.remote.requests[0]
+	sig, err := internal.ParseSignature(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.KeyId != internal.ActorUri(alice)+"#main-key" {
+		t.Errorf("Accept is signed by %v", sig.KeyId)
+	}
+	if err := internal.VerifyRequestSignature(r, f.remote.bodies[0], sig, key.PublicKeyPem, time.Now()); err != nil {
+		t.Errorf("Signature of the accept does not verify: %v", err)
+	}
+
+	// New posts of alice are delivered to her follower.
+	p := f.createTestPost(alice, "For the fediverse")
+	internal.FederatePost(f.db, p)
+	internal.DeliverActivities(f.db, f.remote.Client(), time.Now())
+
+	if f.remote.count() != 2 {
+		t.Fatalf("The remote inbox got %v requests, not 2", f.remote.count())
+	}
+
+	create := f.remote.activity(t, 1)
+	note, _ := create["object"].(map[string]any)
+	if create["type"] != "Create" || note["id"] != internal.PostUri(p) {
+		t.Errorf("Wrong create: %v", create)
+	}
+}
+
+func TestFederationLikeCreateUndo(t *testing.T) {
+	f := newFederationTester(t)
+
+	alice := createTestUser(t, "alice")
+	p := f.createTestPost(alice, "Hello")
+	postUri := internal.PostUri(p)
+
+	f.send("/ap/inbox", f.activity("Follow", "/follows/1", internal.ActorUri(alice)), http.StatusAccepted)
+	f.send("/ap/inbox", f.activity("Like", "/likes/1", postUri), http.StatusAccepted)
+
+	if likes, err := f.db.CountRemoteLikes(p); err != nil || likes != 1 {
+		t.Errorf("Post has %v remote likes: %v", likes, err)
+	}
+
+	// Likes of posts that are not published are refused.
+	f.send("/ap/inbox", f.activity("Like", "/likes/2", testSiteUrl+"/ap/posts/1000"), http.StatusBadRequest)
+
+	noteUri := f.remote.actor + "/notes/1"
+	f.send("/ap/inbox", f.activity("Create", "/notes/1/create", map[string]any{
+		"id":           noteUri,
+		"type":         "Note",
+		"attributedTo": f.remote.actor,
+		"inReplyTo":    postUri,
+		"content":      "<p>Hi <b>alice</b> &amp; all</p>",
+		"published":    "2024-01-02T03:04:05Z",
+	}), http.StatusAccepted)
+
+	// Notes replying to nothing here are ignored.
+	f.send("/ap/inbox", f.activity("Create", "/notes/2/create", map[string]any{
+		"id":           f.remote.actor + "/notes/2",
+		"type":         "Note",
+		"attributedTo": f.remote.actor,
+		"content":      "Elsewhere",
+	}), http.StatusAccepted)
+
+	ns, err := f.db.GetRemoteNotes(p)
+	if err != nil || len(ns) != 1 {
+		t.Fatalf("Post has remote notes %+v: %v", ns, err)
+	}
+	if ns[0].Uri != noteUri || ns[0].Content != "Hi alice & all" || ns[0].Actor.Uri != f.remote.actor {
+		t.Errorf("Wrong remote note: %+v", ns[0])
+	}
+
+	// Mallory cannot reply in the name of someone else.
+	f.send("/ap/inbox", f.activity("Create", "/notes/3/create", map[string]any{
+		"id":           "https://elsewhere.test/notes/3",
+		"type":         "Note",
+		"attributedTo": "https://elsewhere.test/users/eve",
+		"inReplyTo":    postUri,
+		"content":      "Forged",
+	}), http.StatusBadRequest)
+
+	f.send("/ap/inbox", f.activity("Undo", "/likes/1/undo", f.remote.actor+"/likes/1"), http.StatusAccepted)
+	if likes, err := f.db.CountRemoteLikes(p); err != nil || likes != 0 {
+		t.Errorf("Post has %v remote likes after undo: %v", likes, err)
+	}
+
+	f.send("/ap/inbox", f.activity("Undo", "/notes/1/undo", f.remote.actor+"/notes/1/create"), http.StatusAccepted)
+	if ns, err := f.db.GetRemoteNotes(p); err != nil || len(ns) != 0 {
+		t.Errorf("Post has remote notes %+v after undo: %v", ns, err)
+	}
+
+	// Follows are also undone by what they were about.
+	f.send("/ap/inbox", f.activity("Undo", "/follows/1/undo", map[string]any{
+		"type":   "Follow",
+		"actor":  f.remote.actor,
+		"object": internal.ActorUri(alice),
+	}), http.StatusAccepted)
+	if fs, err := f.db.GetRemoteFollowers(alice); err != nil || len(fs) != 0 {
+		t.Errorf("Remote followers are %+v after undo: %v", fs, err)
+	}
+}
+
+func TestFederationInboxRefusesBadSignatures(t *testing.T) {
+	f := newFederationTester(t)
+
+	alice := createTestUser(t, "alice")
+	follow, _ := json.Marshal(f.activity("Follow", "/follows/1", internal.ActorUri(alice)))
+
+	unsigned := httptest.NewRequest(http.MethodPost, testSiteUrl+"/ap/inbox", bytes.NewReader(follow))
+	unsigned.Header.Set("Content-Type", internal.ActivityJsonType)
+
+	tampered := f.inboxRequest("/ap/inbox", follow, f.remote.keyId(), f.remote.privatePem)
+	tampered.Body = io.NopCloser(bytes.NewReader(bytes.Replace(follow, []byte("follows/1"), []byte("follows/2"), 1)))
+
+	redigested := f.inboxRequest("/ap/inbox", []byte("{}"), f.remote.keyId(), f.remote.privatePem)
+	redigested.Body = io.NopCloser(bytes.NewReader(follow))
+
+	otherPem, _, err := internal.NewActorKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retargeted := f.inboxRequest("/ap/inbox", follow, f.remote.keyId(), f.remote.privatePem)
+	retargeted.URL.Path = fmt.Sprintf("/ap/users/%v/inbox", alice.Id)
+
+	requests := map[string]*http.Request{
+		"missing signature":        unsigned,
+		"tampered body":            tampered,
+		"digest of another body":   redigested,
+		"signature by another key": f.inboxRequest("/ap/inbox", follow, f.remote.keyId(), otherPem),
+		"keyId of another actor":   f.inboxRequest("/ap/inbox", follow, "https://elsewhere.test/users/eve#main-key", f.remote.privatePem),
+		"keyId not in the actor":   f.inboxRequest("/ap/inbox", follow, f.remote.actor+"#other-key", f.remote.privatePem),
+		"other request target":     retargeted,
+	}
+
+	for name, r := range requests {
+		if code := f.serve(r); code != http.StatusUnauthorized {
+			t.Errorf("Request with %v answered %v, not %v", name, code, http.StatusUnauthorized)
+		}
+	}
+
+	if fs, err := f.db.GetRemoteFollowers(alice); err != nil || len(fs) != 0 {
+		t.Errorf("Refused follows were stored: %+v %v", fs, err)
+	}
+
+	// Mallory signing an activity of someone else is refused as well.
+	spoofed := f.activity("Follow", "/follows/3", internal.ActorUri(alice))
+	spoofed["actor"] = f.remote.URL + "/users/eve"
+	f.send("/ap/inbox", spoofed, http.StatusUnauthorized)
+}
+
+func TestFederationDeliveryRetry(t *testing.T) {
+	f := newFederationTester(t)
+	f.remote.setStatus(http.StatusInternalServerError)
+
+	alice := createTestUser(t, "alice")
+	f.send("/ap/inbox", f.activity("Follow", "/follows/1", internal.ActorUri(alice)), http.StatusAccepted)
+
+	now := time.Unix(time.Now().Unix(), 0)
+	for attempt := 1; attempt <= 2; attempt++ {
+		internal.DeliverActivities(f.db, f.remote.Client(), now)
+		if f.remote.count() != attempt {
+			t.Fatalf("The remote inbox got %v requests after attempt %v", f.remote.count(), attempt)
+		}
+
+		delay := time.Minute << (attempt - 1)
+		if due, err := f.db.GetDueFederationDeliveries(now.Add(delay-time.Second), 10); err != nil || len(due) != 0 {
+			t.Fatalf("Delivery is due before its retry: %+v %v", due, err)
+		}
+
+		due, err := f.db.GetDueFederationDeliveries(now.Add(delay), 10)
+		if err != nil || len(due) != 1 {
+			t.Fatalf("Delivery is not due %v after attempt %v: %+v %v", delay, attempt, due, err)
+		}
+
+		d := due[0]
+		if d.Status != core.DeliveryPending || d.Attempts != attempt || !strings.Contains(d.Error, "500") {
+			t.Errorf("Delivery is %v after %v attempts: %v", d.Status, d.Attempts, d.Error)
+		}
+
+		now = d.NextAttemptAt
+	}
+
+	f.remote.setStatus(http.StatusAccepted)
+	internal.DeliverActivities(f.db, f.remote.Client(), now)
+
+	if f.remote.count() != 3 || f.remote.activity(t, 2)["type"] != "Accept" {
+		t.Fatalf("The remote inbox got %v requests, not 3", f.remote.count())
+	}
+
+	if due, err := f.db.GetDueFederationDeliveries(now.Add(24*time.Hour), 10); err != nil || len(due) != 0 {
+		t.Errorf("Delivered activity is still due: %+v %v", due, err)
+	}
+}
+
+func TestFederationDeliveryGivesUp(t *testing.T) {
+	f := newFederationTester(t)
+	f.remote.setStatus(http.StatusBadGateway)
+
+	alice := createTestUser(t, "alice")
+	f.send("/ap/inbox", f.activity("Follow", "/follows/1", internal.ActorUri(alice)), http.StatusAccepted)
+
+	// Eight attempts over a little more than two hours.
+	const attempts = 8
+
+	now := time.Unix(time.Now().Unix(), 0)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		due, err := f.db.GetDueFederationDeliveries(now, 10)
+		if err != nil || len(due) != 1 {
+			t.Fatalf("Delivery is not due for attempt %v: %+v %v", attempt, due, err)
+		}
+
+		internal.DeliverActivity(f.db, f.remote.Client(), &due[0], now)
+		if due[0].Status == core.DeliveryFailed && attempt != attempts {
+			t.Fatalf("Delivery failed after %v attempts", attempt)
+		}
+
+		now = due[0].NextAttemptAt
+	}
+
+	if f.remote.count() != attempts {
+		t.Errorf("The remote inbox got %v requests, not %v", f.remote.count(), attempts)
+	}
+
+	if due, err := f.db.GetDueFederationDeliveries(now.Add(24*time.Hour), 10); err != nil || len(due) != 0 {
+		t.Errorf("Failed delivery is still due: %+v %v", due, err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func registerFeedRoutes(r chi.Router) {
+	r.Get("/newsfeed.atom", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		log.Printf("/newsfeed.atom\n")
+
+		ps, err := db.GetFeedPosts(nil, "", internal.FeedPostCount)
+		if err == nil {
+			var f *internal.Feed
+			f, err = internal.BuildFeed("socnet: newest posts", "/newsfeed.atom", "/newsfeed", ps, db)
+			if err == nil {
+				internal.ServeFeed(w, r, f)
+				return
+			}
+		}
+
+		log.Printf("Failed to serve news feed: %v\n", err)
+		http.Error(w, "Cannot load newsfeed", http.StatusInternalServerError)
+	})
+
+	r.Get("/user/{id}/feed.atom", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		log.Printf("/user/%v/feed.atom\n", id)
+
+		// Feeds are anonymous, so are profiles hidden from anonymous visitors.
+		u, err := db.LoadUser(id)
+		if err != nil || !internal.CanViewProfile(nil, u, db) {
+			http.NotFound(w, r)
+			return
+		}
+
+		ps, err := db.GetFeedPosts(u, "", internal.FeedPostCount)
+		if err == nil {
+			var f *internal.Feed
+			f, err = internal.BuildFeed(
+				fmt.Sprintf("socnet: posts of %v", u.Login),
+				fmt.Sprintf("/user/%v/feed.atom", u.Id),
+				fmt.Sprintf("/user?id=%v", u.Id),
+				ps, db)
+			if err == nil {
+				internal.ServeFeed(w, r, f)
+				return
+			}
+		}
+
+		log.Printf("Failed to serve feed of user %v: %v\n", id, err)
+		http.Error(w, "Cannot load posts of this user", http.StatusInternalServerError)
+	})
+
+	r.Get("/tag/{name}/feed.atom", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		tag := core.NormalizeTag(chi.URLParam(r, "name"))
+		if tag == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		log.Printf("/tag/%v/feed.atom\n", tag)
+
+		ps, err := db.GetFeedPosts(nil, tag, internal.FeedPostCount)
+		if err == nil {
+			var f *internal.Feed
+			f, err = internal.BuildFeed(
+				fmt.Sprintf("socnet: #%v", tag),
+				internal.TagFeedUrl(tag),
+				internal.TagUrl(tag),
+				ps, db)
+			if err == nil {
+				internal.ServeFeed(w, r, f)
+				return
+			}
+		}
+
+		log.Printf("Failed to serve feed of tag %v: %v\n", tag, err)
+		http.Error(w, "Cannot load posts with this tag", http.StatusInternalServerError)
+	})
+}
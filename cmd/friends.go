@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func registerFriendRoutes(r chi.Router) {
+	renderFriendRequests := func(w http.ResponseWriter, r *http.Request, incoming bool) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("%v login=%v\n", r.URL.Path, u.Login)
+
+		var frs []core.FriendRequest
+		if incoming {
+			frs, err = db.GetIncomingFriendRequests(u)
+		} else {
+			frs, err = db.GetOutgoingFriendRequests(u)
+		}
+
+		if err != nil {
+			log.Printf("Failed to list friend requests: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load friend requests")
+			return
+		}
+
+		io.WriteString(w, `<nav>`)
+		io.WriteString(w, `<a href="/friend_requests/incoming">Incoming requests</a> `)
+		io.WriteString(w, `<a href="/friend_requests/outgoing">Outgoing requests</a>`)
+		io.WriteString(w, `</nav>`)
+
+		io.WriteString(w, internal.RenderFriendRequests(frs, incoming))
+	}
+
+	r.Get("/friend_requests/incoming", func(w http.ResponseWriter, r *http.Request) {
+		renderFriendRequests(w, r, true)
+	})
+
+	r.Get("/friend_requests/outgoing", func(w http.ResponseWriter, r *http.Request) {
+		renderFriendRequests(w, r, false)
+	})
+
+	r.Post("/do_friend_request", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil && id == u.Id {
+			err = fmt.Errorf("Cannot befriend yourself")
+		}
+
+		var other *core.User
+		if err == nil {
+			other, err = db.LoadUser(id)
+		}
+
+		if err == nil && internal.IsBlockedBy(u, other, db) {
+			err = fmt.Errorf("User %v blocked %v", other.Id, u.Id)
+		}
+
+		if err != nil {
+			log.Printf("Invalid friend request target: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot send friend request to such user")
+			return
+		}
+
+		log.Printf("/do_friend_request from=%v to=%v\n", u.Id, other.Id)
+
+		fr, err := db.FindFriendRequest(u, other)
+		if err == nil && fr == nil {
+			err = db.CreateFriendRequest(&core.FriendRequest{From: u, To: other, Status: core.FriendRequestPending})
+			if err == nil {
+				internal.Notify(db, &core.Notification{Recipient: other, Actor: u, Kind: core.NotificationFriendRequest})
+			} else if found, _ := db.FindFriendRequest(u, other); found != nil {
+				// friend_requests_by_pair refused the request because one between
+				// the two was sent meanwhile, so answer that one instead.
+				log.Printf("Friend request from=%v to=%v raced with %v\n", u.Id, other.Id, found.Id)
+				fr, err = found, nil
+			}
+		}
+
+		switch {
+		case err != nil || fr == nil:
+		case fr.Status == core.FriendRequestPending && fr.To.Id == u.Id:
+			// Both users asked each other, so the friendship is mutual.
+			err = db.UpdateFriendRequestStatus(fr, core.FriendRequestAccepted)
+			if err == nil {
+				internal.Notify(db, &core.Notification{Recipient: other, Actor: u, Kind: core.NotificationFriendAccepted})
+			}
+		}
+
+		if err != nil {
+			log.Printf("Failed to create friend request: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Failed to send friend request")
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/user?id=%v", other.Id), http.StatusSeeOther)
+	})
+
+	r.Post("/do_update_friend_request", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		status, err := core.ParseFriendRequestStatus(r.Form.Get("status"))
+
+		var fr *core.FriendRequest
+		if err == nil {
+			var id int
+			id, err = strconv.Atoi(r.URL.Query().Get("id"))
+			if err == nil {
+				fr, err = db.LoadFriendRequest(id)
+			}
+		}
+
+		if err == nil {
+			err = core.CheckFriendRequestTransition(fr, u, status)
+		}
+
+		if err == nil {
+			log.Printf("/do_update_friend_request id=%v login=%v status=%v\n", fr.Id, u.Login, status)
+			err = db.UpdateFriendRequestStatus(fr, status)
+		}
+
+		if err == nil && status == core.FriendRequestAccepted {
+			internal.Notify(db, &core.Notification{Recipient: fr.From, Actor: u, Kind: core.NotificationFriendAccepted})
+		}
+
+		if err != nil {
+			log.Printf("Failed to update friend request: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot update friend request")
+			return
+		}
+
+		redirectUrl := "/friend_requests/incoming"
+		if fr.From.Id == u.Id {
+			redirectUrl = "/friend_requests/outgoing"
+		}
+
+		http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+	})
+
+	follow := func(w http.ResponseWriter, r *http.Request, unfollow bool) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil && id == u.Id {
+			err = fmt.Errorf("Cannot follow yourself")
+		}
+
+		var other *core.User
+		if err == nil {
+			other, err = db.LoadUser(id)
+		}
+
+		if err == nil && !unfollow && internal.IsBlockedBy(u, other, db) {
+			err = fmt.Errorf("User %v blocked %v", other.Id, u.Id)
+		}
+
+		if err == nil {
+			log.Printf("%v follower=%v followee=%v\n", r.URL.Path, u.Id, other.Id)
+
+			if unfollow {
+				err = db.Unfollow(u, other)
+			} else {
+				err = db.Follow(u, other)
+				if err == nil {
+					internal.Notify(db, &core.Notification{Recipient: other, Actor: u, Kind: core.NotificationFollow})
+					internal.HookFollow(db, u, other)
+				}
+			}
+		}
+
+		if err != nil {
+			log.Printf("Failed to change following: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot follow such user")
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/user?id=%v", other.Id), http.StatusSeeOther)
+	}
+
+	r.Post("/do_follow", func(w http.ResponseWriter, r *http.Request) {
+		follow(w, r, false)
+	})
+
+	r.Post("/do_unfollow", func(w http.ResponseWriter, r *http.Request) {
+		follow(w, r, true)
+	})
+}
@@ -8,14 +8,30 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
 const (
-	newsFeedPostCount = 1000
+	// newsFeedPageSize is how many posts a page of the news feed shows.
+	newsFeedPageSize    = 50
+	digestCheckInterval = 10 * time.Minute
+	// webhookCheckInterval is how often due webhook deliveries are sent.
+	webhookCheckInterval = 10 * time.Second
+	// federationCheckInterval is how often due activities are delivered to
+	// other servers.
+	federationCheckInterval = 10 * time.Second
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	rm := internal.NewResourceManager()
 	signupHtml, err := core.GetFirstResourceByRegexp(rm, `.*signup\.html$`)
 	if err != nil {
@@ -37,11 +53,23 @@ func main() {
 		log.Fatalf("Failed to find style.css resource due to %v\n", err)
 	}
 
-	mkCommentHtml, err := core.GetFirstResourceByRegexp(rm, `.*mkcomment\.html$`)
+	chatJs, err := core.GetFirstResourceByRegexp(rm, `.*chat\.js$`)
 	if err != nil {
-		log.Fatalf("Failed to find mkcomment.html resource due to %v\n", err)
+		log.Fatalf("Failed to find chat.js resource due to %v\n", err)
 	}
 
+	hub := internal.NewHub()
+
+	if mailer := internal.NewMailer(); mailer != nil {
+		go internal.RunDigestScheduler(mailer, digestCheckInterval)
+	}
+
+	webhookClient := internal.NewWebhookClient()
+	go internal.RunWebhookDispatcher(webhookClient, webhookCheckInterval)
+
+	federationClient := internal.NewFederationClient()
+	go internal.RunFederationDispatcher(federationClient, federationCheckInterval)
+
 	r := chi.NewRouter()
 
 	r.Get("/style.css", func(w http.ResponseWriter, r *http.Request) {
@@ -50,6 +78,12 @@ func main() {
 		w.Write(styleCss.Content())
 	})
 
+	r.Get("/chat.js", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("/chat.js")
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Write(chatJs.Content())
+	})
+
 	r.Get("/signup", func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("/signup\n")
 		w.Write(signupHtml.Content())
@@ -64,27 +98,21 @@ func main() {
 		db := internal.NewDatabase()
 		defer db.Close()
 
-		internal.BeginHtml(w)
+		internal.BeginHtml(w, r, db)
 		defer internal.EndHtml(w)
 
-		var login string
-		tokenCookie, err := r.Cookie("socnet_token")
-		if err == nil && tokenCookie != nil {
-			login, err = internal.VerifyToken(tokenCookie.Value)
-		}
-
-		log.Printf("/homepage login=%v\n", login)
-
-		if len(login) == 0 || err != nil {
+		viewer, err := internal.GetCurrentUser(r, db)
+		if err != nil {
 			log.Printf("Failed to verify token due to %v", err)
-			internal.WriteErrorString(w, "You are not logged in")
-			io.WriteString(w, `<p class="error">Please visit <a href="/signup">sign up</a> or <a href="/login">log in</a> page</p>`)
+			internal.WriteNotLoggedIn(w)
 			return
 		}
 
-		html, err := internal.RenderUserByLogin(login, db)
+		log.Printf("/homepage login=%v\n", viewer.Login)
+
+		html, err := internal.RenderUser(viewer, viewer, db)
 		if err != nil {
-			log.Printf("Failed to render user %v: %v\n", login, err)
+			log.Printf("Failed to render user %v: %v\n", viewer.Login, err)
 			internal.WriteErrorString(w, "Cannot render user")
 			return
 		}
@@ -97,12 +125,14 @@ func main() {
 		db := internal.NewDatabase()
 		defer db.Close()
 
-		internal.BeginHtml(w)
+		internal.BeginHtml(w, r, db)
 		defer internal.EndHtml(w)
 
-		log.Printf("/newsfeed postCount=%v", newsFeedPostCount)
+		before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+		log.Printf("/newsfeed before=%v\n", before)
 
-		ps, err := db.GetNewestPosts(newsFeedPostCount)
+		viewer, _ := internal.GetCurrentUser(r, db)
+		ps, err := db.GetPostsPage(viewer, nil, before, newsFeedPageSize+1)
 		if err != nil {
 			log.Printf("Failed to load news feed: %v\n", err)
 
@@ -110,21 +140,33 @@ func main() {
 			return
 		}
 
+		io.WriteString(w, `<p><a href="/newsfeed.atom">Atom feed</a></p>`)
+
+		olderId := 0
+		if len(ps) > newsFeedPageSize {
+			ps = ps[:newsFeedPageSize]
+			olderId = ps[len(ps)-1].Id
+		}
+
 		for _, p := range ps {
-			html, err := internal.RenderPost(&p, db)
+			html, err := internal.RenderPost(&p, viewer, db)
 			if err != nil {
 				log.Printf("Failed to render post: id=%v, err=%v\n", p.Id, err)
 			}
 
 			io.WriteString(w, html)
 		}
+
+		if olderId != 0 {
+			fmt.Fprintf(w, `<p><a href="/newsfeed?before=%v">Older posts</a></p>`, olderId)
+		}
 	})
 
 	r.Get("/post", func(w http.ResponseWriter, r *http.Request) {
 		db := internal.NewDatabase()
 		defer db.Close()
 
-		internal.BeginHtml(w)
+		internal.BeginHtml(w, r, db)
 		defer internal.EndHtml(w)
 
 		id, err := strconv.Atoi(r.URL.Query().Get("id"))
@@ -134,8 +176,11 @@ func main() {
 			return
 		}
 
-		log.Printf("/post id=%v\n", id)
-		html, err := internal.RenderPostById(id, db)
+		viewer, _ := internal.GetCurrentUser(r, db)
+		thread, _ := strconv.Atoi(r.URL.Query().Get("thread"))
+
+		log.Printf("/post id=%v thread=%v\n", id, thread)
+		html, err := internal.RenderPostById(id, thread, viewer, db)
 		if err != nil {
 			log.Printf("Failed to render post %v: %v\n", id, err)
 			internal.WriteErrorString(w, "Cannot render post")
@@ -143,15 +188,58 @@ func main() {
 		}
 
 		io.WriteString(w, html)
-		html = string(mkCommentHtml.Content())
-		fmt.Fprintf(w, html, id)
+		if thread != 0 {
+			fmt.Fprintf(w, `<p><a href="/post?id=%v">Back to all comments</a></p>`, id)
+		}
+
+		if viewer != nil {
+			io.WriteString(w, internal.RenderCommentForm(id, 0))
+		}
+	})
+
+	r.Get("/comment", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			log.Printf("Invalid comment id: %v\n", err)
+			internal.WriteErrorString(w, "Cannot show comment with such id")
+			return
+		}
+
+		viewer, _ := internal.GetCurrentUser(r, db)
+
+		log.Printf("/comment id=%v\n", id)
+		c, err := db.LoadComment(id)
+		if err != nil {
+			log.Printf("Failed to load comment %v: %v\n", id, err)
+			internal.WriteErrorString(w, "Cannot show comment with such id")
+			return
+		}
+
+		html, err := internal.RenderPostThread(c.CommentedPost, c.Id, viewer, db)
+		if err != nil {
+			log.Printf("Failed to render comment %v: %v\n", id, err)
+			internal.WriteErrorString(w, "Cannot render comment")
+			return
+		}
+
+		io.WriteString(w, html)
+		if c.ParentId != 0 {
+			fmt.Fprintf(w, `<p><a href="/comment?id=%v">Show parent comment</a></p>`, c.ParentId)
+		}
+		fmt.Fprintf(w, `<p><a href="/post?id=%v#comment-%v">Show all comments</a></p>`, c.CommentedPost.Id, c.Id)
 	})
 
 	r.Get("/user", func(w http.ResponseWriter, r *http.Request) {
 		db := internal.NewDatabase()
 		defer db.Close()
 
-		internal.BeginHtml(w)
+		internal.BeginHtml(w, r, db)
 		defer internal.EndHtml(w)
 
 		id, err := strconv.Atoi(r.URL.Query().Get("id"))
@@ -161,8 +249,10 @@ func main() {
 			return
 		}
 
+		viewer, _ := internal.GetCurrentUser(r, db)
+
 		log.Printf("/user id=%v\n", id)
-		html, err := internal.RenderUserById(id, db)
+		html, err := internal.RenderUserById(id, viewer, db)
 		if err != nil {
 			log.Printf("Failed to render user %v: %v\n", id, err)
 			internal.WriteErrorString(w, "Cannot render user")
@@ -188,7 +278,7 @@ func main() {
 		if u != nil && err == nil {
 			log.Printf("Failed to create user: user already exists\n")
 
-			internal.BeginHtml(w)
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 			internal.WriteErrorString(w, "User already exists")
 			return
@@ -199,12 +289,14 @@ func main() {
 		if err != nil {
 			log.Printf("Failed to create user: %v\n", err)
 
-			internal.BeginHtml(w)
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 			internal.WriteErrorString(w, "User cannot be created")
 			return
 		}
 
+		internal.Audit(db, r, core.AuditSignup, u, nil, "")
+
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	})
 
@@ -220,18 +312,41 @@ func main() {
 		log.Printf("/do_login %v %v\n", login, password)
 
 		u, err := db.VerifyUser(login, h)
+		if err == nil && u != nil && u.Suspended {
+			err = fmt.Errorf("User %v is suspended", u.Id)
+		}
+
 		if u != nil && err == nil {
 			log.Printf("Login and password match, user=%v\n", *u)
 		} else {
 			log.Printf("Login and password do not match, err=%v\n", err)
 
-			internal.BeginHtml(w)
+			attempted, _ := db.FindUser(login)
+			internal.Audit(db, r, core.AuditLoginFailed, nil, attempted, fmt.Sprintf("login=%q", login))
+
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 			internal.WriteErrorString(w, "Cannot log in")
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{Name: "socnet_token", Value: internal.MakeToken(u.Login)})
+		s, err := internal.StartSession(w, r, db, u)
+		if err != nil {
+			log.Printf("Failed to start session of %v: %v\n", u.Id, err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+			internal.WriteErrorString(w, "Cannot log in")
+			return
+		}
+
+		internal.Audit(db, r, core.AuditLogin, u, nil, fmt.Sprintf("session=%v", s.Id))
+
+		if u.PasswordResetRequired {
+			http.Redirect(w, r, "/settings/password", http.StatusSeeOther)
+			return
+		}
+
 		http.Redirect(w, r, "/homepage", http.StatusSeeOther)
 	})
 
@@ -241,56 +356,96 @@ func main() {
 
 		r.ParseForm()
 		postContent := []byte(r.Form.Get("postContent"))
+		visibility, err := core.ParseVisibility(r.Form.Get("visibility"))
+		if err != nil {
+			log.Printf("Invalid post visibility: %v\n", err)
+			visibility = core.VisibilityPublic
+		}
 
 		if len(postContent) == 0 {
-			internal.BeginHtml(w)
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 
 			internal.WriteErrorString(w, "Empty posts are not allowed")
 			return
 		}
 
-		var login string
-		tokenCookie, err := r.Cookie("socnet_token")
-		if err == nil && tokenCookie != nil {
-			login, err = internal.VerifyToken(tokenCookie.Value)
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
 		}
 
-		if len(login) == 0 {
-			internal.BeginHtml(w)
+		log.Printf("/do_post login=%v postContent=%v", u.Login, postContent)
+
+		p := &core.Post{Author: u, Content: postContent, Visibility: visibility}
+		err = db.CreatePost(p)
+		if err != nil {
+			log.Printf("Failed to create post: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 
-			internal.WriteErrorString(w, "You are not logged in")
-			io.WriteString(w, `<p class="error">Please visit <a href="/signup">sign up</a> or <a href="/login">log in</a> page</p>`)
+			internal.WriteErrorString(w, "Failed to create post")
 			return
 		}
 
-		log.Printf("/do_post login=%v postContent=%v", login, postContent)
+		internal.TagPost(db, p)
+		internal.Mention(db, u, p, 0, p.Content)
+		internal.HookPost(db, p)
+		internal.FederatePost(db, p)
 
-		u, err := db.FindUser(login)
-		if err != nil {
-			log.Printf("Failed to find user: %v\n", err)
+		http.Redirect(w, r, "/homepage", http.StatusSeeOther)
+	})
 
-			internal.BeginHtml(w)
+	r.Post("/do_post_visibility", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 
-			internal.WriteErrorString(w, "You are logged in as non-existant user")
+			internal.WriteNotLoggedIn(w)
 			return
 		}
 
-		p := &core.Post{Author: u, Content: postContent}
-		err = db.CreatePost(p)
+		r.ParseForm()
+		visibility, err := core.ParseVisibility(r.Form.Get("visibility"))
+
+		var p *core.Post
+		if err == nil {
+			var id int
+			id, err = strconv.Atoi(r.URL.Query().Get("id"))
+			if err == nil {
+				p, err = db.LoadPost(id)
+			}
+		}
+
+		if err == nil && p.Author.Id != u.Id {
+			err = fmt.Errorf("User %v is not the author of post %v", u.Id, p.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_post_visibility id=%v visibility=%v\n", p.Id, visibility)
+			err = db.UpdatePostVisibility(p, visibility)
+		}
+
 		if err != nil {
-			log.Printf("Failed to create post: %v\n", err)
+			log.Printf("Failed to change post visibility: %v\n", err)
 
-			internal.BeginHtml(w)
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 
-			internal.WriteErrorString(w, "Failed to create post")
+			internal.WriteErrorString(w, "Cannot change post visibility")
 			return
 		}
 
-		http.Redirect(w, r, "/homepage", http.StatusSeeOther)
+		http.Redirect(w, r, fmt.Sprintf("/post?id=%v", p.Id), http.StatusSeeOther)
 	})
 
 	r.Post("/do_comment", func(w http.ResponseWriter, r *http.Request) {
@@ -301,25 +456,19 @@ func main() {
 		commentContent := []byte(r.Form.Get("commentContent"))
 
 		if len(commentContent) == 0 {
-			internal.BeginHtml(w)
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 
 			internal.WriteErrorString(w, "Empty comments are not allowed")
 			return
 		}
 
-		var login string
-		tokenCookie, err := r.Cookie("socnet_token")
-		if err == nil && tokenCookie != nil {
-			login, err = internal.VerifyToken(tokenCookie.Value)
-		}
-
-		if len(login) == 0 {
-			internal.BeginHtml(w)
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
 			defer internal.EndHtml(w)
 
-			internal.WriteErrorString(w, "You are not logged in")
-			io.WriteString(w, `<p class="error">Please visit <a href="/signup">sign up</a> or <a href="/login">log in</a> page</p>`)
+			internal.WriteNotLoggedIn(w)
 			return
 		}
 
@@ -330,23 +479,37 @@ func main() {
 			return
 		}
 
-		log.Printf("/do_comment user.login=%v post.id=%v comment.content=%v\n", login, id, commentContent)
+		log.Printf("/do_comment user.login=%v post.id=%v comment.content=%v\n", u.Login, id, commentContent)
 
-		u, err := db.FindUser(login)
-		if err != nil {
-			log.Printf("Failed to find user %v: %v\n", login, err)
-			internal.WriteErrorString(w, "You are logged in as non-existant user\n")
-			return
+		p, err := db.LoadPost(id)
+		if err == nil && p.IsPlainRepost() {
+			// Plain reposts show the original, so are commented there.
+			p, err = db.LoadPost(p.RepostOfId)
 		}
 
-		p, err := db.LoadPost(id)
-		if err != nil {
+		if err != nil || !internal.CanViewPost(u, p, db) {
 			log.Printf("Failed to find post %v: %v\n", id, err)
 			internal.WriteErrorString(w, "You are trying to comment non-existant post\n")
 			return
 		}
 
-		c := &core.Comment{Author: u, CommentedPost: p, Content: commentContent}
+		if p.Hidden {
+			log.Printf("Refusing comment to hidden post %v\n", p.Id)
+			internal.WriteErrorString(w, "Hidden posts cannot be commented\n")
+			return
+		}
+
+		parentId, _ := strconv.Atoi(r.URL.Query().Get("parent"))
+		if parentId != 0 {
+			parent, err := db.LoadComment(parentId)
+			if err != nil || parent.CommentedPost.Id != p.Id {
+				log.Printf("Failed to find parent comment %v of post %v: %v\n", parentId, id, err)
+				internal.WriteErrorString(w, "You are trying to reply to non-existant comment\n")
+				return
+			}
+		}
+
+		c := &core.Comment{Author: u, CommentedPost: p, Content: commentContent, ParentId: parentId}
 		err = db.CreateComment(c)
 
 		if err != nil {
@@ -355,9 +518,37 @@ func main() {
 			return
 		}
 
-		redirectUrl := fmt.Sprintf("/post?id=%v", id)
+		internal.Notify(db, &core.Notification{
+			Recipient: p.Author,
+			Actor:     u,
+			Kind:      core.NotificationComment,
+			PostId:    p.Id,
+			CommentId: c.Id,
+		})
+		internal.Mention(db, u, p, c.Id, c.Content)
+		internal.HookComment(db, c)
+
+		redirectUrl := fmt.Sprintf("/post?id=%v#comment-%v", p.Id, c.Id)
 		http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
 	})
 
+	registerFriendRoutes(r)
+	registerSettingsRoutes(r)
+	registerAccountRoutes(r)
+	registerMessageRoutes(r, hub)
+	registerNotificationRoutes(r)
+	registerReactionRoutes(r)
+	registerPostRoutes(r)
+	registerSearchRoutes(r)
+	registerTagRoutes(r)
+	registerFeedRoutes(r)
+	registerBookmarkRoutes(r)
+	registerBlockRoutes(r)
+	registerModerationRoutes(r)
+	registerAdminRoutes(r)
+	registerApiRoutes(r, hub, apiViolationReport())
+	registerWebhookRoutes(r, webhookClient)
+	registerFederationRoutes(r, federationClient)
+
 	http.ListenAndServe(":80", r)
 }
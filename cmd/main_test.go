@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/JouleJ/socnet/internal/testdb"
+)
+
+// createTestUser signs up login with testdb.Password in the database of
+// testdb.Create.
+func createTestUser(t *testing.T, login string) *core.User {
+	t.Helper()
+
+	db := internal.NewDatabase()
+	defer db.Close()
+
+	return testdb.CreateUser(t, db, login, internal.GetHash([]byte(testdb.Password)))
+}
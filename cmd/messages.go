@@ -0,0 +1,449 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	conversationPageSize = 20
+	eventReplayLimit     = 100
+	heartbeatInterval    = 15 * time.Second
+)
+
+func notifyAboutMessage(db core.Database, m *core.Message) {
+	recipients := []*core.User{}
+	for _, member := range m.Conversation.Members {
+		recipients = append(recipients, member.User)
+	}
+
+	internal.NotifyMany(db, recipients, core.Notification{
+		Actor:          m.Author,
+		Kind:           core.NotificationMessage,
+		ConversationId: m.Conversation.Id,
+	})
+	internal.HookMessage(db, m)
+}
+
+func registerMessageRoutes(r chi.Router, hub core.Hub) {
+	r.Get("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/inbox login=%v\n", u.Login)
+
+		cs, err := db.GetConversations(u)
+		if err != nil {
+			log.Printf("Failed to list conversations: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load conversations")
+			return
+		}
+
+		io.WriteString(w, internal.RenderConversations(cs, u))
+	})
+
+	r.Get("/conversation", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			log.Printf("Invalid conversation id: %v\n", err)
+			internal.WriteErrorString(w, "Cannot show conversation with such id")
+			return
+		}
+
+		before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+
+		log.Printf("/conversation id=%v before=%v login=%v\n", id, before, u.Login)
+
+		c, err := db.LoadConversation(id)
+		if err != nil || !c.IsMember(u) {
+			log.Printf("Failed to load conversation %v: %v\n", id, err)
+			internal.WriteErrorString(w, "Cannot show conversation with such id")
+			return
+		}
+
+		ms, err := db.GetMessages(c, before, conversationPageSize)
+		if err != nil {
+			log.Printf("Failed to load messages: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load messages")
+			return
+		}
+
+		if len(ms) > 0 {
+			err = db.MarkConversationRead(c, u, ms[0].Id)
+			if err != nil {
+				log.Printf("Failed to mark conversation %v read: %v\n", c.Id, err)
+			}
+		}
+
+		olderId := 0
+		if len(ms) == conversationPageSize {
+			olderId = ms[len(ms)-1].Id
+		}
+
+		io.WriteString(w, internal.RenderConversation(c, ms, olderId, u))
+	})
+
+	r.Post("/do_new_conversation", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		title := strings.TrimSpace(r.Form.Get("title"))
+		content := []byte(r.Form.Get("content"))
+
+		log.Printf("/do_new_conversation login=%v logins=%v\n", u.Login, r.Form.Get("logins"))
+
+		c := &core.Conversation{Title: title, Members: []core.ConversationMember{{User: u}}}
+		for _, login := range strings.Split(r.Form.Get("logins"), ",") {
+			login = strings.TrimSpace(login)
+			if len(login) == 0 || login == u.Login {
+				continue
+			}
+
+			other, err := db.FindUser(login)
+			if err == nil && !internal.CanMessage(u, other, db) {
+				err = fmt.Errorf("%v does not accept messages from %v", other.Id, u.Id)
+			}
+
+			if err != nil {
+				log.Printf("Cannot add %v to conversation: %v\n", login, err)
+
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteErrorString(w, fmt.Sprintf("You cannot message %v", html.EscapeString(login)))
+				return
+			}
+
+			if !c.IsMember(other) {
+				c.Members = append(c.Members, core.ConversationMember{User: other})
+			}
+		}
+
+		// Members who blocked one another are never put together.
+		for i := range c.Members {
+			for j := i + 1; j < len(c.Members); j++ {
+				a, b := c.Members[i].User, c.Members[j].User
+				if internal.IsBlockedBetween(a, b, db) {
+					log.Printf("Cannot put %v and %v in one conversation: blocked\n", a.Id, b.Id)
+
+					internal.BeginHtml(w, r, db)
+					defer internal.EndHtml(w)
+
+					internal.WriteErrorString(w, fmt.Sprintf("You cannot put %v and %v in one conversation",
+						html.EscapeString(a.Login), html.EscapeString(b.Login)))
+					return
+				}
+			}
+		}
+
+		if len(c.Members) < 2 || len(c.Members) > core.MaxConversationMembers {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, fmt.Sprintf("A conversation needs from 2 to %v members", core.MaxConversationMembers))
+			return
+		}
+
+		if c.IsDirect() && len(title) == 0 {
+			direct, err := db.FindDirectConversation(c.Members[0].User, c.Members[1].User)
+			if err != nil {
+				log.Printf("Failed to find direct conversation: %v\n", err)
+			} else if direct != nil {
+				c = direct
+			}
+		}
+
+		if c.Id == 0 {
+			err = db.CreateConversation(c)
+		}
+
+		if err == nil && len(content) > 0 {
+			m := &core.Message{Conversation: c, Author: u, Content: content}
+			err = db.CreateMessage(m)
+			if err == nil {
+				hub.Publish(internal.ConversationMemberIds(c, 0), internal.NewMessageEvent(m))
+				notifyAboutMessage(db, m)
+			}
+		}
+
+		if err != nil {
+			log.Printf("Failed to create conversation: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Failed to create conversation")
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/conversation?id=%v", c.Id), http.StatusSeeOther)
+	})
+
+	r.Post("/do_message", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		content := []byte(r.Form.Get("content"))
+		if len(content) == 0 {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Empty messages are not allowed")
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+
+		var c *core.Conversation
+		if err == nil {
+			c, err = db.LoadConversation(id)
+		}
+
+		if err == nil && !c.IsMember(u) {
+			err = fmt.Errorf("User %v is not a member of conversation %v", u.Id, c.Id)
+		}
+
+		if err == nil && !internal.CanWrite(u, c, db) {
+			err = fmt.Errorf("User %v may not write to conversation %v", u.Id, c.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_message conversation=%v login=%v\n", c.Id, u.Login)
+
+			m := &core.Message{Conversation: c, Author: u, Content: content}
+			err = db.CreateMessage(m)
+			if err == nil {
+				hub.Publish(internal.ConversationMemberIds(c, 0), internal.NewMessageEvent(m))
+				notifyAboutMessage(db, m)
+			}
+		}
+
+		if err != nil {
+			log.Printf("Failed to send message: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Failed to send message")
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/conversation?id=%v", c.Id), http.StatusSeeOther)
+	})
+
+	r.Post("/do_typing", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			http.Error(w, "You are not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+
+		var c *core.Conversation
+		if err == nil {
+			c, err = db.LoadConversation(id)
+		}
+
+		if err != nil || !c.IsMember(u) {
+			http.Error(w, "Cannot find conversation", http.StatusNotFound)
+			return
+		}
+
+		hub.Publish(internal.ConversationMemberIds(c, u.Id), internal.NewTypingEvent(c, u))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Post("/do_read_conversation", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			http.Error(w, "You are not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+
+		var messageId int
+		if err == nil {
+			messageId, err = strconv.Atoi(r.URL.Query().Get("message"))
+		}
+
+		var c *core.Conversation
+		if err == nil {
+			c, err = db.LoadConversation(id)
+		}
+
+		if err == nil && c.IsMember(u) {
+			err = db.MarkConversationRead(c, u, messageId)
+		}
+
+		if err != nil {
+			log.Printf("Failed to mark conversation read: %v\n", err)
+			http.Error(w, "Cannot mark conversation read", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// /events streams messages and typing indicators as Server-Sent Events.
+	// A reconnecting client passes the last message id it has seen in the
+	// Last-Event-ID header (or the last query parameter on first connect)
+	// and gets the messages it missed replayed first.
+	r.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		db := internal.NewDatabase()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			db.Close()
+			http.Error(w, "You are not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		lastId, err := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+		if err != nil {
+			lastId, _ = strconv.Atoi(r.URL.Query().Get("last"))
+		}
+
+		log.Printf("/events login=%v lastId=%v\n", u.Login, lastId)
+
+		// Subscribe before replaying so that nothing sent in between is lost.
+		sub := hub.Subscribe(u)
+		defer sub.Close()
+
+		var missed []core.Message
+		if lastId > 0 {
+			missed, err = db.GetMessagesSince(u, lastId, eventReplayLimit)
+			if err != nil {
+				log.Printf("Failed to replay messages: %v\n", err)
+			}
+		}
+		db.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		io.WriteString(w, "retry: 3000\n\n")
+
+		for i := range missed {
+			internal.WriteEvent(w, internal.NewMessageEvent(&missed[i]))
+			lastId = missed[i].Id
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+
+				if e.Id != 0 && e.Id <= lastId {
+					continue
+				}
+
+				if e.Id != 0 {
+					lastId = e.Id
+				}
+
+				internal.WriteEvent(w, e)
+				flusher.Flush()
+			case <-heartbeat.C:
+				io.WriteString(w, ": heartbeat\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	// /events/poll is the fallback for clients that cannot stream.
+	r.Get("/events/poll", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			http.Error(w, "You are not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+
+		ms, err := db.GetMessagesSince(u, after, eventReplayLimit)
+		if err != nil {
+			log.Printf("Failed to poll messages: %v\n", err)
+			http.Error(w, "Cannot load messages", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		internal.WriteMessagesJson(w, ms)
+	})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// moderationPageSize is how many reports and log entries the moderation
+// pages show.
+const moderationPageSize = 100
+
+func registerModerationRoutes(r chi.Router) {
+	r.Post("/do_report", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		report := &core.Report{Reporter: u, Reason: r.Form.Get("reason"), Status: core.ReportOpen}
+
+		query := r.URL.Query()
+		var id int
+		switch {
+		case query.Has("post"):
+			id, err = strconv.Atoi(query.Get("post"))
+			if err == nil {
+				report.Post, err = db.LoadPost(id)
+			}
+			if err == nil && !internal.CanViewPost(u, report.Post, db) {
+				err = fmt.Errorf("Post %v is not visible to user %v", id, u.Id)
+			}
+		case query.Has("comment"):
+			id, err = strconv.Atoi(query.Get("comment"))
+			if err == nil {
+				report.Comment, err = db.LoadComment(id)
+			}
+			if err == nil && !internal.CanViewPost(u, report.Comment.CommentedPost, db) {
+				err = fmt.Errorf("Comment %v is not visible to user %v", id, u.Id)
+			}
+		case query.Has("user"):
+			id, err = strconv.Atoi(query.Get("user"))
+			if err == nil {
+				report.User, err = db.LoadUser(id)
+			}
+			if err == nil && report.User.Id == u.Id {
+				err = fmt.Errorf("User %v cannot report themselves", u.Id)
+			}
+		default:
+			err = fmt.Errorf("Nothing to report")
+		}
+
+		if err == nil && (report.Reason == "" || len(report.Reason) > core.MaxReportReasonLength) {
+			err = fmt.Errorf("Report reason must be 1 to %v bytes long", core.MaxReportReasonLength)
+		}
+
+		if err == nil {
+			log.Printf("/do_report login=%v query=%v\n", u.Login, r.URL.RawQuery)
+			err = db.CreateReport(report)
+		}
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		if err != nil {
+			log.Printf("Failed to report: %v\n", err)
+			internal.WriteErrorString(w, "Cannot report this")
+			return
+		}
+
+		io.WriteString(w, `<p>Thank you, moderators will look at your report.</p>`)
+	})
+
+	moderation := r.With(internal.RequirePermission(core.PermissionModerate))
+
+	moderation.Get("/moderation", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/moderation login=%v\n", u.Login)
+
+		rs, err := db.GetOpenReports(moderationPageSize)
+		if err != nil {
+			log.Printf("Failed to list reports: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load reports")
+			return
+		}
+
+		io.WriteString(w, internal.RenderModerationQueue(rs))
+	})
+
+	moderation.Get("/moderation/log", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/moderation/log login=%v\n", u.Login)
+
+		as, err := db.GetModerationActions(moderationPageSize)
+		if err != nil {
+			log.Printf("Failed to list moderation actions: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load moderation log")
+			return
+		}
+
+		io.WriteString(w, internal.RenderModerationLog(as))
+	})
+
+	moderation.Post("/do_moderate", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		action := &core.ModerationAction{Moderator: u, Reason: r.Form.Get("reason")}
+
+		var report *core.Report
+		action.ReportId, err = strconv.Atoi(r.URL.Query().Get("report"))
+		if err == nil {
+			report, err = db.LoadReport(action.ReportId)
+		}
+		if err == nil && report.Status != core.ReportOpen {
+			err = fmt.Errorf("Report %v is already %v", report.Id, report.Status)
+		}
+		if err == nil {
+			action.Kind, err = core.ParseModerationActionKind(r.Form.Get("action"))
+		}
+		if err == nil && (action.Reason == "" || len(action.Reason) > core.MaxReportReasonLength) {
+			err = fmt.Errorf("Moderation reason must be 1 to %v bytes long", core.MaxReportReasonLength)
+		}
+
+		// target is whom the report is about, the author of reported content.
+		var target *core.User
+		if err == nil {
+			target = report.User
+			switch {
+			case report.Post != nil:
+				target = report.Post.Author
+			case report.Comment != nil:
+				target = report.Comment.Author
+			}
+		}
+		if err == nil && action.Kind != core.ModerationDismiss && target != nil && !internal.CanModerateUser(u, target) {
+			err = fmt.Errorf("User %v cannot moderate user %v, who is %v", u.Id, target.Id, target.Role)
+		}
+
+		if err == nil {
+			switch {
+			case report.Post != nil:
+				action.PostId = report.Post.Id
+			case report.Comment != nil:
+				action.CommentId = report.Comment.Id
+			case report.User != nil:
+				action.UserId = report.User.Id
+			}
+
+			switch action.Kind {
+			case core.ModerationHide:
+				switch {
+				case report.Post != nil:
+					err = db.SetPostHidden(report.Post, true)
+				case report.Comment != nil:
+					err = db.SetCommentHidden(report.Comment, true)
+				default:
+					err = fmt.Errorf("Report %v has no content to hide", report.Id)
+				}
+			case core.ModerationSuspend:
+				// Suspending over content suspends its author.
+				switch {
+				case report.Post != nil:
+					action.UserId = report.Post.Author.Id
+					err = db.SetUserSuspended(report.Post.Author, true)
+				case report.Comment != nil:
+					action.UserId = report.Comment.Author.Id
+					err = db.SetUserSuspended(report.Comment.Author, true)
+				case report.User != nil:
+					err = db.SetUserSuspended(report.User, true)
+				default:
+					err = fmt.Errorf("Report %v has nobody to suspend", report.Id)
+				}
+			}
+		}
+
+		if err == nil {
+			log.Printf("/do_moderate login=%v report=%v action=%v\n", u.Login, report.Id, action.Kind)
+
+			status := core.ReportResolved
+			if action.Kind == core.ModerationDismiss {
+				status = core.ReportDismissed
+			}
+
+			err = db.ResolveReports(report, status, u)
+		}
+
+		if err == nil {
+			err = db.CreateModerationAction(action)
+		}
+
+		if err != nil {
+			log.Printf("Failed to moderate: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot apply moderation action")
+			return
+		}
+
+		internal.Audit(db, r, core.AuditModeration, u, target, fmt.Sprintf("action=%v report=%v post=%v comment=%v reason=%q",
+			action.Kind, action.ReportId, action.PostId, action.CommentId, action.Reason))
+
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	notificationPageSize = 100
+	mentionPageSize      = 100
+)
+
+func registerNotificationRoutes(r chi.Router) {
+	r.Get("/notifications", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/notifications login=%v\n", u.Login)
+
+		ns, err := db.GetNotifications(u, notificationPageSize)
+		if err != nil {
+			log.Printf("Failed to list notifications: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load notifications")
+			return
+		}
+
+		io.WriteString(w, `<p><a href="/mentions">Where you were mentioned</a></p>`)
+		io.WriteString(w, internal.RenderNotifications(ns))
+	})
+
+	r.Get("/mentions", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/mentions login=%v\n", u.Login)
+
+		ms, err := db.GetMentionsOf(u, mentionPageSize)
+		if err != nil {
+			log.Printf("Failed to list mentions: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load mentions")
+			return
+		}
+
+		io.WriteString(w, internal.RenderMentions(ms))
+	})
+
+	r.Post("/do_read_notifications", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		// Without an id every notification is marked read.
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+		log.Printf("/do_read_notifications login=%v id=%v\n", u.Login, id)
+
+		err = db.MarkNotificationsRead(u, id)
+		if err != nil {
+			log.Printf("Failed to mark notifications read: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot mark notifications read")
+			return
+		}
+
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	})
+
+	r.Post("/do_notification_settings", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		enabled := map[core.NotificationKind]bool{}
+		for _, s := range r.Form["notify"] {
+			k, err := core.ParseNotificationKind(s)
+			if err != nil {
+				log.Printf("Ignoring notification kind: %v\n", err)
+				continue
+			}
+
+			enabled[k] = true
+		}
+
+		log.Printf("/do_notification_settings login=%v enabled=%v\n", u.Login, enabled)
+
+		for _, k := range core.NotificationKinds {
+			err = db.SetNotificationOptOut(u, k, !enabled[k])
+			if err != nil {
+				log.Printf("Failed to save notification settings: %v\n", err)
+
+				internal.BeginHtml(w, r, db)
+				defer internal.EndHtml(w)
+
+				internal.WriteErrorString(w, "Cannot save notification settings")
+				return
+			}
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	})
+}
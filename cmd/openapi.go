@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"os"
+)
+
+const apiBase = "/api/v1"
+
+// apiOperations is what the OpenAPI document says of the routes of
+// registerApiRoutes, whose handlers take Auth and Scope from here. The
+// server does not start while the two disagree.
+var apiOperations = []internal.ApiOperation{
+	{
+		Method: http.MethodPost, Path: "/sessions", Summary: "Log in for a bearer token",
+		Request: internal.ApiLoginRequest{}, Status: http.StatusCreated, Response: internal.ApiToken{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/sessions/current", Summary: "Log out the session token",
+		Auth: true, Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest},
+	},
+
+	{Method: http.MethodGet, Path: "/me", Summary: "Show the viewer", Auth: true, Response: internal.ApiProfile{}},
+	{Method: http.MethodGet, Path: "/users/{id}", Summary: "Show a user", Response: internal.ApiProfile{}},
+	{Method: http.MethodGet, Path: "/users/{id}/posts", Summary: "List the posts of a user", Response: internal.ApiPost{}, Paged: true},
+	{
+		Method: http.MethodPut, Path: "/users/{id}/follow", Summary: "Follow a user",
+		Auth: true, Scope: core.ScopeWritePosts, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodDelete, Path: "/users/{id}/follow", Summary: "Unfollow a user",
+		Auth: true, Scope: core.ScopeWritePosts, Status: http.StatusNoContent,
+	},
+	{Method: http.MethodGet, Path: "/feed", Summary: "List the posts of the news feed", Response: internal.ApiPost{}, Paged: true},
+
+	{
+		Method: http.MethodPost, Path: "/posts", Summary: "Write or repost a post", Auth: true, Scope: core.ScopeWritePosts,
+		Request: internal.ApiPostRequest{}, Status: http.StatusCreated, Response: internal.ApiPost{},
+		Errors: []int{http.StatusNotFound},
+	},
+	{Method: http.MethodGet, Path: "/posts/{id}", Summary: "Show a post", Response: internal.ApiPost{}},
+	{
+		Method: http.MethodDelete, Path: "/posts/{id}", Summary: "Delete a post of the viewer",
+		Auth: true, Scope: core.ScopeWritePosts, Status: http.StatusNoContent,
+	},
+	{Method: http.MethodGet, Path: "/posts/{id}/comments", Summary: "List the comments of a post", Response: internal.ApiComment{}, Paged: true},
+	{
+		Method: http.MethodPost, Path: "/posts/{id}/comments", Summary: "Comment a post", Auth: true, Scope: core.ScopeWritePosts,
+		Request: internal.ApiCommentRequest{}, Status: http.StatusCreated, Response: internal.ApiComment{},
+	},
+	{Method: http.MethodGet, Path: "/comments/{id}", Summary: "Show a comment", Response: internal.ApiComment{}},
+
+	{Method: http.MethodGet, Path: "/posts/{id}/likes", Summary: "List the likes of a post", Response: []internal.ApiLike{}},
+	{
+		Method: http.MethodPut, Path: "/posts/{id}/like", Summary: "Like a post, with the first reaction by default",
+		Auth: true, Scope: core.ScopeWritePosts,
+		Request: internal.ApiLikeRequest{}, RequestOptional: true, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodDelete, Path: "/posts/{id}/like", Summary: "Take back the like of a post",
+		Auth: true, Scope: core.ScopeWritePosts, Status: http.StatusNoContent,
+	},
+	{Method: http.MethodGet, Path: "/comments/{id}/likes", Summary: "List the likes of a comment", Response: []internal.ApiLike{}},
+	{
+		Method: http.MethodPut, Path: "/comments/{id}/like", Summary: "Like a comment, with the first reaction by default",
+		Auth: true, Scope: core.ScopeWritePosts,
+		Request: internal.ApiLikeRequest{}, RequestOptional: true, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodDelete, Path: "/comments/{id}/like", Summary: "Take back the like of a comment",
+		Auth: true, Scope: core.ScopeWritePosts, Status: http.StatusNoContent,
+	},
+
+	{
+		Method: http.MethodGet, Path: "/conversations", Summary: "List the conversations of the viewer",
+		Auth: true, Scope: core.ScopeMessages, Response: []internal.ApiConversation{},
+	},
+	{
+		Method: http.MethodGet, Path: "/conversations/{id}/messages", Summary: "List the messages of a conversation, newest first",
+		Auth: true, Scope: core.ScopeMessages, Response: internal.ApiMessage{}, Paged: true,
+	},
+	{
+		Method: http.MethodPost, Path: "/conversations/{id}/messages", Summary: "Send a message to a conversation",
+		Auth: true, Scope: core.ScopeMessages,
+		Request: internal.ApiMessageRequest{}, Status: http.StatusCreated, Response: internal.ApiMessage{},
+	},
+}
+
+// newApiDocument generates the OpenAPI document of the API.
+func newApiDocument() *internal.OpenApi {
+	doc, err := internal.NewOpenApi("socnet", "1", apiBase, apiOperations)
+	if err != nil {
+		log.Fatalf("Failed to generate the OpenAPI document due to %v\n", err)
+	}
+
+	return doc
+}
+
+func checkApiDocument(doc *internal.OpenApi, r chi.Routes) {
+	routes := []string{}
+	err := chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+
+	if err == nil {
+		err = doc.CheckRoutes(routes)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func registerOpenApiRoutes(r chi.Router, doc *internal.OpenApi) {
+	r.Get("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("/api/openapi.json\n")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc.Document())
+	})
+}
+
+// apiViolationReport is how violations of the document are reported: they
+// are logged if API_VALIDATE asks to check every exchange with the API,
+// which costs a copy of each, and not checked otherwise.
+func apiViolationReport() internal.ApiViolationReport {
+	if os.Getenv("API_VALIDATE") == "" {
+		return nil
+	}
+
+	return internal.LogApiViolation
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func registerPostRoutes(r chi.Router) {
+	r.Post("/do_repost", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		quoteContent := []byte(r.Form.Get("quoteContent"))
+		visibility, err := core.ParseVisibility(r.Form.Get("visibility"))
+		if err != nil {
+			log.Printf("Invalid repost visibility: %v\n", err)
+			visibility = core.VisibilityPublic
+		}
+
+		var original *core.Post
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil {
+			original, err = db.LoadPost(id)
+		}
+
+		// Sharing a plain repost shares what it reposted.
+		if err == nil && original.IsPlainRepost() {
+			original, err = db.LoadPost(original.RepostOfId)
+		}
+
+		if err == nil && !internal.CanViewPost(u, original, db) {
+			err = fmt.Errorf("Post %v is not visible to user %v", original.Id, u.Id)
+		}
+
+		p := &core.Post{Author: u, Content: quoteContent, Visibility: visibility}
+		if err == nil {
+			log.Printf("/do_repost login=%v original=%v quote=%v\n", u.Login, original.Id, len(quoteContent) != 0)
+
+			p.RepostOfId = original.Id
+			err = db.CreatePost(p)
+		}
+
+		if err != nil {
+			log.Printf("Failed to repost: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot repost such post")
+			return
+		}
+
+		internal.TagPost(db, p)
+		internal.Mention(db, u, p, 0, p.Content)
+		internal.HookPost(db, p)
+		internal.FederatePost(db, p)
+
+		http.Redirect(w, r, fmt.Sprintf("/post?id=%v", p.Id), http.StatusSeeOther)
+	})
+
+	r.Post("/do_edit_post", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		postContent := []byte(r.Form.Get("postContent"))
+
+		var p *core.Post
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil {
+			p, err = db.LoadPost(id)
+		}
+
+		if err == nil && p.Author.Id != u.Id {
+			err = fmt.Errorf("User %v is not the author of post %v", u.Id, p.Id)
+		}
+
+		// Emptying a quote would silently turn it into a plain repost.
+		if err == nil && len(postContent) == 0 {
+			err = fmt.Errorf("Post %v cannot become empty", p.Id)
+		}
+
+		if err == nil && p.IsPlainRepost() {
+			err = fmt.Errorf("Plain repost %v has no content to edit", p.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_edit_post id=%v login=%v\n", p.Id, u.Login)
+			err = db.UpdatePostContent(p, postContent)
+		}
+
+		if err != nil {
+			log.Printf("Failed to edit post: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot edit such post")
+			return
+		}
+
+		internal.TagPost(db, p)
+		internal.Mention(db, u, p, 0, p.Content)
+
+		http.Redirect(w, r, fmt.Sprintf("/post?id=%v", p.Id), http.StatusSeeOther)
+	})
+
+	r.Post("/do_delete_post", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		var p *core.Post
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err == nil {
+			p, err = db.LoadPost(id)
+		}
+
+		if err == nil && p.Author.Id != u.Id {
+			err = fmt.Errorf("User %v is not the author of post %v", u.Id, p.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_delete_post id=%v login=%v\n", p.Id, u.Login)
+			err = db.DeletePost(p)
+		}
+
+		if err != nil {
+			log.Printf("Failed to delete post: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot delete such post")
+			return
+		}
+
+		http.Redirect(w, r, "/homepage", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// loadLikeTarget resolves the post= or comment= query of r into an empty
+// like of viewer, failing if viewer may not see the item.
+func loadLikeTarget(r *http.Request, viewer *core.User, db core.Database) (*core.Like, error) {
+	l := &core.Like{Author: viewer}
+
+	if commentId := r.URL.Query().Get("comment"); commentId != "" {
+		id, err := strconv.Atoi(commentId)
+		if err != nil {
+			return nil, err
+		}
+
+		l.LikedComment, err = db.LoadComment(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !internal.CanViewPost(viewer, l.LikedComment.CommentedPost, db) {
+			return nil, fmt.Errorf("Comment %v is not visible", id)
+		}
+
+		return l, nil
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("post"))
+	if err != nil {
+		return nil, err
+	}
+
+	l.LikedPost, err = db.LoadPost(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !internal.CanViewPost(viewer, l.LikedPost, db) {
+		return nil, fmt.Errorf("Post %v is not visible", id)
+	}
+
+	return l, nil
+}
+
+func getLikes(l *core.Like, db core.Database) ([]core.Like, error) {
+	if l.LikedComment != nil {
+		return db.GetCommentLikes(l.LikedComment)
+	}
+
+	return db.GetPostLikes(l.LikedPost)
+}
+
+func registerReactionRoutes(r chi.Router) {
+	r.Get("/reactions", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		viewer, _ := internal.GetCurrentUser(r, db)
+
+		log.Printf("/reactions %v\n", r.URL.RawQuery)
+
+		l, err := loadLikeTarget(r, viewer, db)
+
+		var ls []core.Like
+		if err == nil {
+			ls, err = getLikes(l, db)
+		}
+
+		if err != nil {
+			log.Printf("Failed to list reactions: %v\n", err)
+			internal.WriteErrorString(w, "Cannot show reactions")
+			return
+		}
+
+		io.WriteString(w, internal.RenderReactionList(ls))
+	})
+
+	r.Post("/do_react", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		kind := r.Form.Get("kind")
+		if core.FindReaction(internal.GetReactions(), kind) == nil {
+			err = fmt.Errorf("Unknown reaction %v", kind)
+		}
+
+		var l *core.Like
+		if err == nil {
+			l, err = loadLikeTarget(r, u, db)
+		}
+
+		var ls []core.Like
+		if err == nil {
+			ls, err = getLikes(l, db)
+		}
+
+		if err == nil {
+			l.Kind = kind
+
+			// Choosing the current reaction again takes it back.
+			previous := ""
+			for _, other := range ls {
+				if other.Author.Id == u.Id {
+					previous = other.Kind
+				}
+			}
+
+			log.Printf("/do_react login=%v %v kind=%v previous=%v\n", u.Login, r.URL.RawQuery, kind, previous)
+
+			if previous == kind {
+				err = db.DeleteLike(l)
+			} else {
+				err = db.CreateLike(l)
+			}
+
+			if err == nil && previous == "" {
+				n := &core.Notification{Actor: u, Kind: core.NotificationLike}
+				if l.LikedComment != nil {
+					n.Recipient = l.LikedComment.Author
+					n.PostId = l.LikedComment.CommentedPost.Id
+					n.CommentId = l.LikedComment.Id
+				} else {
+					n.Recipient = l.LikedPost.Author
+					n.PostId = l.LikedPost.Id
+				}
+
+				internal.Notify(db, n)
+			}
+		}
+
+		if err != nil {
+			log.Printf("Failed to react: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot react")
+			return
+		}
+
+		redirectUrl := r.Referer()
+		if redirectUrl == "" {
+			if l.LikedComment != nil {
+				redirectUrl = fmt.Sprintf("/comment?id=%v", l.LikedComment.Id)
+			} else {
+				redirectUrl = fmt.Sprintf("/post?id=%v", l.LikedPost.Id)
+			}
+		}
+
+		http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+	})
+}
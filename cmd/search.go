@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	searchPageSize = 20
+)
+
+func registerSearchRoutes(r chi.Router) {
+	r.Get("/search", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		viewer, _ := internal.GetCurrentUser(r, db)
+
+		query := r.URL.Query().Get("q")
+		kind, err := core.ParseSearchKind(r.URL.Query().Get("kind"))
+		if err != nil {
+			kind = core.SearchUsers
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset < 0 {
+			offset = 0
+		}
+
+		log.Printf("/search q=%v kind=%v offset=%v\n", query, kind, offset)
+
+		hits, next, err := db.Search(viewer, kind, query, offset, searchPageSize)
+		if err != nil {
+			log.Printf("Failed to search: %v\n", err)
+			internal.WriteErrorString(w, "Cannot search")
+			return
+		}
+
+		io.WriteString(w, internal.RenderSearch(query, kind, hits, offset, next))
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+func registerSettingsRoutes(r chi.Router) {
+	r.Get("/settings", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/settings login=%v\n", u.Login)
+
+		io.WriteString(w, internal.RenderSettings(u))
+
+		optOuts, err := db.GetNotificationOptOuts(u)
+		if err != nil {
+			log.Printf("Failed to load notification opt-outs: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load notification settings")
+			return
+		}
+
+		io.WriteString(w, internal.RenderNotificationSettings(optOuts))
+		io.WriteString(w, `<p><a href="/settings/blocks">Blocked and muted users</a></p>`)
+		io.WriteString(w, `<p><a href="/settings/password">Change password</a></p>`)
+		io.WriteString(w, `<p><a href="/settings/sessions">Sessions</a></p>`)
+		io.WriteString(w, `<p><a href="/settings/tokens">API tokens</a></p>`)
+		io.WriteString(w, `<p><a href="/settings/webhooks">Webhooks</a></p>`)
+		if internal.Can(u, core.PermissionModerate) {
+			io.WriteString(w, `<p><a href="/moderation">Moderation queue</a></p>`)
+		}
+		if internal.Can(u, core.PermissionAdminister) {
+			io.WriteString(w, `<p><a href="/admin">Administration</a></p>`)
+		}
+	})
+
+	r.Post("/do_settings", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		visibility, err := core.ParseVisibility(r.Form.Get("visibility"))
+
+		var messageVisibility core.Visibility
+		if err == nil {
+			messageVisibility, err = core.ParseVisibility(r.Form.Get("message_visibility"))
+		}
+
+		var digestFrequency core.DigestFrequency
+		if err == nil {
+			digestFrequency, err = core.ParseDigestFrequency(r.Form.Get("digest_frequency"))
+		}
+
+		email := strings.TrimSpace(r.Form.Get("email"))
+		if err == nil && email != "" {
+			_, err = mail.ParseAddress(email)
+		}
+
+		if err == nil {
+			u.Visibility = visibility
+			u.MessageVisibility = messageVisibility
+			u.Email = email
+			u.DigestFrequency = digestFrequency
+			u.Bio = []byte(r.Form.Get("bio"))
+
+			log.Printf("/do_settings login=%v visibility=%v\n", u.Login, u.Visibility)
+			err = db.UpdateUser(u)
+		}
+
+		if err != nil {
+			log.Printf("Failed to update settings: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot save settings")
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	})
+
+	r.Get("/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		log.Printf("/unsubscribe user=%v\n", r.URL.Query().Get("user"))
+
+		// The link is opened from a mail client, so nothing changes until the
+		// user confirms; scanners prefetching links must not unsubscribe anyone.
+		fmt.Fprintf(w, `<form action="/do_unsubscribe?%v" method="POST">`, html.EscapeString(r.URL.RawQuery))
+		io.WriteString(w, `<h2>Stop mailing me notification digests</h2>`)
+		io.WriteString(w, `<input type="submit" value="Unsubscribe"></input>`)
+		io.WriteString(w, `</form>`)
+	})
+
+	r.Post("/do_unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		id, err := strconv.Atoi(r.URL.Query().Get("user"))
+
+		var u *core.User
+		if err == nil {
+			u, err = db.LoadUser(id)
+		}
+
+		if err == nil && !internal.VerifyUnsubscribeSignature(u, r.URL.Query().Get("sig")) {
+			err = fmt.Errorf("Bad unsubscribe signature for user %v", u.Id)
+		}
+
+		if err == nil {
+			log.Printf("/do_unsubscribe user=%v\n", u.Id)
+
+			u.DigestFrequency = core.DigestNever
+			err = db.UpdateUser(u)
+		}
+
+		if err != nil {
+			log.Printf("Failed to unsubscribe: %v\n", err)
+			internal.WriteErrorString(w, "Cannot unsubscribe")
+			return
+		}
+
+		internal.WriteMessageString(w, "You will not get notification digests anymore")
+	})
+}
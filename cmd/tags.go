@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	tagPostCount     = 50
+	trendingTagCount = 20
+	trendingWindow   = 7 * 24 * time.Hour
+	trendingHalfLife = 24 * time.Hour
+)
+
+func registerTagRoutes(r chi.Router) {
+	r.Get("/tag", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		tag := core.NormalizeTag(r.URL.Query().Get("name"))
+		if tag == "" {
+			internal.WriteErrorString(w, "No such tag")
+			return
+		}
+
+		log.Printf("/tag name=%v\n", tag)
+
+		viewer, _ := internal.GetCurrentUser(r, db)
+		ps, err := db.GetPostsByTag(viewer, tag, tagPostCount)
+		if err != nil {
+			log.Printf("Failed to load posts tagged %v: %v\n", tag, err)
+			internal.WriteErrorString(w, "Cannot load posts with this tag")
+			return
+		}
+
+		fmt.Fprintf(w, `<h2>#%v</h2>`, html.EscapeString(tag))
+		fmt.Fprintf(w, `<p><a href="/trending">Trending tags</a> | <a href="%v">Atom feed</a></p>`, html.EscapeString(internal.TagFeedUrl(tag)))
+
+		if len(ps) == 0 {
+			internal.WriteMessageString(w, "No posts with this tag yet")
+		}
+
+		for _, p := range ps {
+			postHtml, err := internal.RenderPost(&p, viewer, db)
+			if err != nil {
+				log.Printf("Failed to render post: id=%v, err=%v\n", p.Id, err)
+			}
+
+			io.WriteString(w, postHtml)
+		}
+	})
+
+	r.Get("/trending", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		log.Printf("/trending\n")
+
+		ts, err := db.GetTrendingTags(time.Now().Add(-trendingWindow), trendingHalfLife, trendingTagCount)
+		if err != nil {
+			log.Printf("Failed to load trending tags: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load trending tags")
+			return
+		}
+
+		io.WriteString(w, `<h2>Trending tags</h2>`)
+		io.WriteString(w, internal.RenderTrendingTags(ts))
+	})
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// webhookLogSize is how many deliveries the delivery log shows.
+const webhookLogSize = 50
+
+// loadOwnWebhook loads the webhook ?id= of r if u owns it, or may administer
+// it when admin is set.
+func loadOwnWebhook(r *http.Request, db core.Database, u *core.User, admin bool) (*core.Webhook, error) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+
+	var h *core.Webhook
+	if err == nil {
+		h, err = db.LoadWebhook(id)
+	}
+
+	if err == nil && h.Owner.Id != u.Id && !(admin && internal.Can(u, core.PermissionAdminister)) {
+		err = fmt.Errorf("Webhook %v is not of user %v", h.Id, u.Id)
+	}
+
+	return h, err
+}
+
+// setWebhookEnabled handles the buttons enabling and disabling webhooks,
+// which go back to redirectUrl. Enabling forgives the failures so far.
+// Admins changing the webhooks of others is audited.
+func setWebhookEnabled(admin bool, redirectUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		h, err := loadOwnWebhook(r, db, u, admin)
+		if err == nil {
+			h.Disabled = r.URL.Query().Get("enabled") != "1"
+			if !h.Disabled {
+				h.Failures = 0
+			}
+
+			log.Printf("%v id=%v disabled=%v login=%v\n", r.URL.Path, h.Id, h.Disabled, u.Login)
+			err = db.SetWebhookState(h)
+		}
+
+		if err == nil && h.Owner.Id != u.Id {
+			kind := core.AuditWebhookEnable
+			if h.Disabled {
+				kind = core.AuditWebhookDisable
+			}
+
+			internal.Audit(db, r, kind, u, h.Owner, fmt.Sprintf("webhook=%v", h.Id))
+		}
+
+		if err != nil {
+			log.Printf("Failed to change webhook: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot change such webhook")
+			return
+		}
+
+		http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+	}
+}
+
+func registerWebhookRoutes(r chi.Router, client internal.WebhookClient) {
+	r.Get("/settings/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/settings/webhooks login=%v\n", u.Login)
+
+		hs, err := db.GetWebhooks(u)
+		if err != nil {
+			log.Printf("Failed to list webhooks: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load webhooks")
+			return
+		}
+
+		io.WriteString(w, internal.RenderWebhooks(hs, false))
+		io.WriteString(w, internal.RenderWebhookForm())
+	})
+
+	// Admins may look at the deliveries of every webhook.
+	r.Get("/settings/webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		h, err := loadOwnWebhook(r, db, u, true)
+		if err != nil {
+			log.Printf("Failed to load webhook: %v\n", err)
+			internal.WriteErrorString(w, "Cannot show such webhook")
+			return
+		}
+
+		log.Printf("/settings/webhooks/deliveries id=%v login=%v\n", h.Id, u.Login)
+
+		ds, err := db.GetWebhookDeliveries(h, webhookLogSize)
+		if err != nil {
+			log.Printf("Failed to list deliveries: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load deliveries")
+			return
+		}
+
+		io.WriteString(w, internal.RenderWebhookDeliveries(h, ds))
+	})
+
+	r.Post("/do_create_webhook", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		r.ParseForm()
+		h := &core.Webhook{Owner: u, Url: strings.TrimSpace(r.Form.Get("url")), Events: []core.WebhookEvent{}}
+		err = internal.ValidateWebhookUrl(h.Url)
+
+		for _, name := range r.Form["event"] {
+			if err != nil {
+				break
+			}
+
+			var e core.WebhookEvent
+			e, err = core.ParseWebhookEvent(name)
+			if err == nil && !h.SubscribesTo(e) {
+				h.Events = append(h.Events, e)
+			}
+		}
+
+		if err == nil && len(h.Events) == 0 {
+			err = fmt.Errorf("Webhook of user %v has no events", u.Id)
+		}
+
+		if err == nil {
+			h.Secret, err = internal.NewWebhookSecret()
+		}
+
+		if err == nil {
+			log.Printf("/do_create_webhook url=%q login=%v\n", h.Url, u.Login)
+			err = db.CreateWebhook(h)
+		}
+
+		if err != nil {
+			log.Printf("Failed to create webhook: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot create such webhook, it needs an http or https URL and at least one event")
+			return
+		}
+
+		http.Redirect(w, r, "/settings/webhooks", http.StatusSeeOther)
+	})
+
+	r.Post("/do_delete_webhook", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		h, err := loadOwnWebhook(r, db, u, false)
+		if err == nil {
+			log.Printf("/do_delete_webhook id=%v login=%v\n", h.Id, u.Login)
+			err = db.DeleteWebhook(h)
+		}
+
+		if err != nil {
+			log.Printf("Failed to delete webhook: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot delete such webhook")
+			return
+		}
+
+		http.Redirect(w, r, "/settings/webhooks", http.StatusSeeOther)
+	})
+
+	r.Post("/do_set_webhook_enabled", setWebhookEnabled(false, "/settings/webhooks"))
+
+	// The test event is delivered right away, so the delivery log shows
+	// how it went.
+	r.Post("/do_test_webhook", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		h, err := loadOwnWebhook(r, db, u, false)
+		if err == nil {
+			log.Printf("/do_test_webhook id=%v login=%v\n", h.Id, u.Login)
+			_, err = internal.SendTestWebhook(db, client, h)
+		}
+
+		if err != nil {
+			log.Printf("Failed to test webhook: %v\n", err)
+
+			internal.BeginHtml(w, r, db)
+			defer internal.EndHtml(w)
+
+			internal.WriteErrorString(w, "Cannot test such webhook")
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/settings/webhooks/deliveries?id=%v", h.Id), http.StatusSeeOther)
+	})
+}
+
+// registerAdminWebhookRoutes registers the webhook pages of the admin
+// console on its router.
+func registerAdminWebhookRoutes(r chi.Router) {
+	r.Get("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		db := internal.NewDatabase()
+		defer db.Close()
+
+		internal.BeginHtml(w, r, db)
+		defer internal.EndHtml(w)
+
+		u, err := internal.GetCurrentUser(r, db)
+		if err != nil {
+			log.Printf("Failed to verify token due to %v\n", err)
+			internal.WriteNotLoggedIn(w)
+			return
+		}
+
+		log.Printf("/admin/webhooks login=%v\n", u.Login)
+
+		hs, err := db.GetWebhooks(nil)
+		if err != nil {
+			log.Printf("Failed to list webhooks: %v\n", err)
+			internal.WriteErrorString(w, "Cannot load webhooks")
+			return
+		}
+
+		io.WriteString(w, internal.RenderWebhooks(hs, true))
+	})
+
+	r.Post("/do_set_webhook_enabled", setWebhookEnabled(true, "/admin/webhooks"))
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Visibility tells who besides the owner may see a profile or a post.
+type Visibility int
+
+const (
+	VisibilityPublic Visibility = iota
+	VisibilityFollowers
+	VisibilityFriends
+	VisibilityOnlyMe
+)
+
+var Visibilities = []Visibility{
+	VisibilityPublic,
+	VisibilityFollowers,
+	VisibilityFriends,
+	VisibilityOnlyMe,
+}
+
+func (v Visibility) String() string {
+	switch v {
+	case VisibilityPublic:
+		return "public"
+	case VisibilityFollowers:
+		return "followers"
+	case VisibilityFriends:
+		return "friends"
+	case VisibilityOnlyMe:
+		return "only me"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(v))
+}
+
+func ParseVisibility(s string) (Visibility, error) {
+	for _, v := range Visibilities {
+		if v.String() == s {
+			return v, nil
+		}
+	}
+
+	return VisibilityPublic, fmt.Errorf("Unknown visibility %v", s)
+}
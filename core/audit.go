@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditEventKind is what happened in a security relevant event.
+type AuditEventKind int
+
+const (
+	AuditSignup AuditEventKind = iota
+	AuditLogin
+	AuditLoginFailed
+	AuditLogout
+	AuditPasswordChange
+	AuditSessionRevoke
+	AuditModeration
+	AuditRoleChange
+	AuditSuspend
+	AuditUnsuspend
+	AuditPasswordResetForce
+	AuditAccountDelete
+	AuditTokenCreate
+	AuditTokenRevoke
+	AuditWebhookDisable
+	AuditWebhookEnable
+)
+
+var AuditEventKinds = []AuditEventKind{
+	AuditSignup,
+	AuditLogin,
+	AuditLoginFailed,
+	AuditLogout,
+	AuditPasswordChange,
+	AuditSessionRevoke,
+	AuditModeration,
+	AuditRoleChange,
+	AuditSuspend,
+	AuditUnsuspend,
+	AuditPasswordResetForce,
+	AuditAccountDelete,
+	AuditTokenCreate,
+	AuditTokenRevoke,
+	AuditWebhookDisable,
+	AuditWebhookEnable,
+}
+
+func (k AuditEventKind) String() string {
+	switch k {
+	case AuditSignup:
+		return "signup"
+	case AuditLogin:
+		return "login"
+	case AuditLoginFailed:
+		return "login_failed"
+	case AuditLogout:
+		return "logout"
+	case AuditPasswordChange:
+		return "password_change"
+	case AuditSessionRevoke:
+		return "session_revoke"
+	case AuditModeration:
+		return "moderation"
+	case AuditRoleChange:
+		return "role_change"
+	case AuditSuspend:
+		return "suspend"
+	case AuditUnsuspend:
+		return "unsuspend"
+	case AuditPasswordResetForce:
+		return "password_reset_force"
+	case AuditAccountDelete:
+		return "account_delete"
+	case AuditTokenCreate:
+		return "token_create"
+	case AuditTokenRevoke:
+		return "token_revoke"
+	case AuditWebhookDisable:
+		return "webhook_disable"
+	case AuditWebhookEnable:
+		return "webhook_enable"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+func ParseAuditEventKind(s string) (AuditEventKind, error) {
+	for _, k := range AuditEventKinds {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+
+	return AuditSignup, fmt.Errorf("Unknown audit event kind %v", s)
+}
+
+// AuditEvent is a row of the append-only audit log. Users are stored by id
+// and login so events outlive deleted accounts, a missing actor or target
+// has id 0. Hash covers the event and PrevHash, the Hash of the event
+// before it, so changing or removing an event breaks the chain after it. It
+// is keyed by a secret kept out of the database, so that whoever can write
+// the database cannot compute it again.
+type AuditEvent struct {
+	Id int
+
+	Kind        AuditEventKind
+	ActorId     int
+	ActorLogin  string
+	TargetId    int
+	TargetLogin string
+	Address     string
+	UserAgent   string
+	Detail      string
+	CreatedAt   time.Time
+
+	PrevHash string
+	Hash     string
+}
+
+// HashedData returns what Hash of e is computed over.
+func (e *AuditEvent) HashedData() string {
+	return fmt.Sprintf("%d|%d|%d|%q|%d|%q|%q|%q|%q|%d|%v",
+		e.Id, e.Kind, e.ActorId, e.ActorLogin, e.TargetId, e.TargetLogin,
+		e.Address, e.UserAgent, e.Detail, e.CreatedAt.Unix(), e.PrevHash)
+}
+
+// AuditFilter selects audit events, unset fields match everything.
+type AuditFilter struct {
+	Kind        *AuditEventKind
+	ActorLogin  string
+	TargetLogin string
+
+	// BeforeId pages back through the log, only events older than it match.
+	BeforeId int
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"fmt"
+)
+
+// BlockKind tells how a user shields themselves from another one. Blocked
+// users cannot see the content of, comment on the posts of or message the
+// user blocking them; muted users are only hidden from the user muting them.
+type BlockKind int
+
+const (
+	BlockKindBlock BlockKind = iota
+	BlockKindMute
+)
+
+var BlockKinds = []BlockKind{
+	BlockKindBlock,
+	BlockKindMute,
+}
+
+func (k BlockKind) String() string {
+	switch k {
+	case BlockKindBlock:
+		return "block"
+	case BlockKindMute:
+		return "mute"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+func ParseBlockKind(s string) (BlockKind, error) {
+	for _, k := range BlockKinds {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+
+	return BlockKindBlock, fmt.Errorf("Unknown block kind %v", s)
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"time"
+)
+
+const MaxBookmarkCollectionNameLength = 64
+
+// BookmarkCollection is a named folder of bookmarks, only its owner sees it.
+type BookmarkCollection struct {
+	Id int
+
+	Owner *User
+	Name  string
+}
+
+// Bookmark is a post saved by Owner, Collection is nil for bookmarks not
+// put into a collection.
+type Bookmark struct {
+	Id int
+
+	Owner      *User
+	Post       *Post
+	Collection *BookmarkCollection
+	CreatedAt  time.Time
+}
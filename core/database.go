@@ -1,5 +1,9 @@
 package core
 
+import (
+	"time"
+)
+
 type User struct {
 	Id int
 
@@ -7,13 +11,44 @@ type User struct {
 	PasswordHash uint64
 
 	Bio []byte
+
+	Visibility        Visibility
+	MessageVisibility Visibility
+
+	Email           string
+	DigestFrequency DigestFrequency
+
+	// Suspended accounts cannot log in and their content is not shown.
+	Suspended bool
+
+	Role Role
+
+	// PasswordResetRequired accounts must choose a new password before
+	// using the site.
+	PasswordResetRequired bool
+
+	CreatedAt time.Time
 }
 
 type Post struct {
 	Id int
 
-	Author  *User
-	Content []byte
+	Author     *User
+	Content    []byte
+	Visibility Visibility
+
+	// RepostOfId is the id of the shared post or 0. A repost without
+	// Content is a plain share, with Content it quotes the original.
+	RepostOfId int
+
+	// Hidden posts were taken down by a moderator.
+	Hidden bool
+
+	CreatedAt time.Time
+}
+
+func (p *Post) IsPlainRepost() bool {
+	return p.RepostOfId != 0 && len(p.Content) == 0
 }
 
 type Comment struct {
@@ -22,33 +57,280 @@ type Comment struct {
 	Author        *User
 	CommentedPost *Post
 	Content       []byte
+
+	// ParentId is the id of the comment this one replies to, 0 for replies to the post itself.
+	ParentId int
+
+	// Hidden comments were taken down by a moderator.
+	Hidden bool
+
+	CreatedAt time.Time
 }
 
+// Like is a reaction of Author to either LikedPost or LikedComment, the
+// other one is nil. A user has at most one reaction per post or comment.
 type Like struct {
 	Id int
 
 	Author       *User
 	LikedPost    *Post
 	LikedComment *Comment
+	Kind         string
 }
 
 type Database interface {
 	CreateUser(u *User) error
 	CreatePost(p *Post) error
 	CreateComment(c *Comment) error
+	// CreateLike stores l, replacing the previous reaction of its author to the same item.
 	CreateLike(l *Like) error
 
 	LoadUser(id int) (*User, error)
 	LoadPost(id int) (*Post, error)
 	LoadComment(id int) (*Comment, error)
 	LoadLike(id int) (*Like, error)
+	// DeleteLike removes the reaction of l.Author to the post or comment of l.
+	DeleteLike(l *Like) error
+	// GetPostLikes and GetCommentLikes list reactions, leaving the liked item unset.
+	GetPostLikes(*Post) ([]Like, error)
+	GetCommentLikes(*Comment) ([]Like, error)
+
+	UpdateUser(u *User) error
+	UpdatePostVisibility(p *Post, v Visibility) error
+	UpdatePostContent(p *Post, content []byte) error
+	// DeletePost removes p together with its comments and reactions, reposts
+	// of p stay and point to a missing post.
+	DeletePost(p *Post) error
+	CountReposts(*Post) (int, error)
+
+	// SetPostTags makes tags the normalized tags of p, tags p already had
+	// keep the time they were first added at.
+	SetPostTags(p *Post, tags []string, at time.Time) error
+	GetPostTags(*Post) ([]string, error)
+	// GetPostsByTag returns the newest posts tagged with tag viewer may see.
+	GetPostsByTag(viewer *User, tag string, count int) ([]Post, error)
+	// GetTrendingTags ranks tags of public posts tagged since the given
+	// time, each use counts less the older it is, halving every halfLife.
+	GetTrendingTags(since time.Time, halfLife time.Duration, count int) ([]TrendingTag, error)
+	// GetFeedPosts returns the newest count posts that Atom feeds list:
+	// public posts not hidden by moderators, of public accounts that are not
+	// suspended. Only posts of author are listed unless it is nil, and only
+	// posts tagged with tag unless it is empty.
+	GetFeedPosts(author *User, tag string, count int) ([]Post, error)
+
+	// SetMentions makes users the ones mentioned in post postId, or in its
+	// comment commentId if that is not 0, and returns those not mentioned
+	// there before.
+	SetMentions(author *User, postId int, commentId int, users []*User) ([]*User, error)
+	GetMentionedUsers(postId int, commentId int) ([]User, error)
+	// GetMentionsOf returns the newest mentions of u in posts u may see,
+	// leaving out hidden content and authors u muted or blocked or who
+	// blocked u.
+	GetMentionsOf(u *User, count int) ([]Mention, error)
+
+	// CreateBookmark saves b.Post for b.Owner, saving it again only moves it
+	// to b.Collection.
+	CreateBookmark(b *Bookmark) error
+	DeleteBookmark(owner *User, p *Post) error
+	FindBookmark(owner *User, p *Post) (*Bookmark, error)
+	// GetBookmarks returns the bookmarks of owner in collection c, or all of
+	// them if c is nil, most recently saved first. Bookmarked posts owner
+	// may no longer see are left out.
+	GetBookmarks(owner *User, c *BookmarkCollection, count int) ([]Bookmark, error)
+	CreateBookmarkCollection(c *BookmarkCollection) error
+	LoadBookmarkCollection(id int) (*BookmarkCollection, error)
+	GetBookmarkCollections(owner *User) ([]BookmarkCollection, error)
+	// DeleteBookmarkCollection keeps the bookmarks of c outside of any
+	// collection.
+	DeleteBookmarkCollection(c *BookmarkCollection) error
+
+	SetBlock(owner *User, target *User, k BlockKind, on bool) error
+	// IsBlocked tells whether owner blocked or muted target depending on k.
+	IsBlocked(owner *User, target *User, k BlockKind) (bool, error)
+	GetBlockedUsers(owner *User, k BlockKind) ([]User, error)
+
+	CreateReport(r *Report) error
+	LoadReport(id int) (*Report, error)
+	// GetOpenReports returns the oldest reports waiting for a moderator.
+	GetOpenReports(count int) ([]Report, error)
+	// ResolveReports gives status to r and every other open report about
+	// the same post, comment or account.
+	ResolveReports(r *Report, status ReportStatus, moderator *User) error
+	SetPostHidden(p *Post, hidden bool) error
+	SetCommentHidden(c *Comment, hidden bool) error
+	SetUserSuspended(u *User, suspended bool) error
+	SetUserRole(u *User, role Role) error
+	SetPasswordHash(u *User, passwordHash uint64) error
+	SetPasswordResetRequired(u *User, required bool) error
+	// DeleteUser deletes u with everything it created or received.
+	DeleteUser(u *User) error
+	// FindUsers returns up to count users whose login contains query.
+	FindUsers(query string, count int) ([]User, error)
+	// GetReportsAbout returns the newest count reports on u, its posts and
+	// its comments, of any status.
+	GetReportsAbout(u *User, count int) ([]Report, error)
+	// GetDailyStats returns what was created on each of the last days UTC
+	// days, the newest day first.
+	GetDailyStats(days int) ([]DayStats, error)
+
+	// AppendAuditEvent sets the id, the time and the hashes of e and
+	// stores it at the end of the audit log.
+	AppendAuditEvent(e *AuditEvent) error
+	// GetAuditEvents returns up to count events matching f, newest first.
+	GetAuditEvents(f AuditFilter, count int) ([]AuditEvent, error)
+	// ForEachAuditEvent calls fn for every audit event, oldest first, and
+	// stops at the first error of fn.
+	ForEachAuditEvent(fn func(e *AuditEvent) error) error
+
+	CreateSession(s *Session) error
+	LoadSession(id int) (*Session, error)
+	// TouchSession records that s was used now.
+	TouchSession(s *Session) error
+	RevokeSession(s *Session) error
+	// RevokeSessions revokes every session of u.
+	RevokeSessions(u *User) error
+	// GetSessions returns the sessions of u that are not revoked, the most
+	// recently used first.
+	GetSessions(u *User) ([]Session, error)
+
+	// CreateAccessToken stores t with the hash of its secret.
+	CreateAccessToken(t *AccessToken, hash string) error
+	LoadAccessToken(id int) (*AccessToken, error)
+	// FindAccessToken returns the token whose secret has hash.
+	FindAccessToken(hash string) (*AccessToken, error)
+	// TouchAccessToken records that t was used now.
+	TouchAccessToken(t *AccessToken) error
+	RevokeAccessToken(t *AccessToken) error
+	// RevokeAccessTokens revokes every token of u.
+	RevokeAccessTokens(u *User) error
+	// GetAccessTokens returns the tokens of u that are not revoked, the
+	// newest first.
+	GetAccessTokens(u *User) ([]AccessToken, error)
+
+	CreateWebhook(h *Webhook) error
+	LoadWebhook(id int) (*Webhook, error)
+	// GetWebhooks returns the webhooks of owner, or of everybody if owner
+	// is nil, the newest first.
+	GetWebhooks(owner *User) ([]Webhook, error)
+	// SetWebhookState stores the Failures and Disabled of h.
+	SetWebhookState(h *Webhook) error
+	// DeleteWebhook deletes h with its deliveries.
+	DeleteWebhook(h *Webhook) error
+	CreateWebhookDelivery(d *WebhookDelivery) error
+	// UpdateWebhookDelivery stores how the last attempt of d went.
+	UpdateWebhookDelivery(d *WebhookDelivery) error
+	// GetDueWebhookDeliveries returns up to count pending deliveries to be
+	// attempted by now, the oldest first. Test deliveries are left out, the
+	// request that queues them delivers them.
+	GetDueWebhookDeliveries(now time.Time, count int) ([]WebhookDelivery, error)
+	// GetWebhookDeliveries returns the last count deliveries of h, the
+	// newest first.
+	GetWebhookDeliveries(h *Webhook, count int) ([]WebhookDelivery, error)
+
+	// CreateActorKey stores k unless its user has a key already.
+	CreateActorKey(k *ActorKey) error
+	GetActorKey(u *User) (*ActorKey, error)
+	// StoreRemoteActor inserts a, or updates the actor with its Uri.
+	StoreRemoteActor(a *RemoteActor) error
+	FindRemoteActor(uri string) (*RemoteActor, error)
+	// CreateRemoteFollow stores f, or updates the activity of the follow
+	// of its actor and followee.
+	CreateRemoteFollow(f *RemoteFollow) error
+	DeleteRemoteFollow(actor *RemoteActor, followee *User) error
+	// GetRemoteFollowers returns the follows of u by remote actors, the
+	// oldest first.
+	GetRemoteFollowers(u *User) ([]RemoteFollow, error)
+	CreateRemoteLike(l *RemoteLike) error
+	DeleteRemoteLike(actor *RemoteActor, p *Post) error
+	CountRemoteLikes(p *Post) (int, error)
+	// CreateRemoteNote stores n, or updates the note with its Uri.
+	CreateRemoteNote(n *RemoteNote) error
+	// GetRemoteNotes returns the notes replying to p, the oldest first.
+	GetRemoteNotes(p *Post) ([]RemoteNote, error)
+	// UndoRemoteActivity deletes the follow, like or note actor made with
+	// the activity uri, and tells whether there was one.
+	UndoRemoteActivity(actor *RemoteActor, uri string) (bool, error)
+	CreateFederationDelivery(d *FederationDelivery) error
+	// UpdateFederationDelivery stores how the last attempt of d went.
+	UpdateFederationDelivery(d *FederationDelivery) error
+	// GetDueFederationDeliveries returns up to count pending deliveries to
+	// be attempted by now, the oldest first.
+	GetDueFederationDeliveries(now time.Time, count int) ([]FederationDelivery, error)
+	// GetStaff returns the users with a role other than RoleUser, the most
+	// privileged first.
+	GetStaff() ([]User, error)
+	CreateModerationAction(a *ModerationAction) error
+	GetModerationActions(count int) ([]ModerationAction, error)
 
 	VerifyUser(login string, passwordHash uint64) (*User, error)
 	FindUser(login string) (*User, error)
 
-	GetPostsByUser(*User) ([]Post, error)
-	GetNewestPosts(count int) ([]Post, error)
+	// GetPostsByUser and GetNewestPosts return only posts viewer may see,
+	// viewer is nil for anonymous visitors.
+	GetPostsByUser(viewer *User, u *User) ([]Post, error)
+	GetNewestPosts(viewer *User, count int) ([]Post, error)
+	// GetPostsPage returns up to count posts of author, or of everybody if
+	// author is nil, older than beforeId and newest first. beforeId 0 starts
+	// from the newest post. Posts of everybody leave out authors viewer
+	// hides.
+	GetPostsPage(viewer *User, author *User, beforeId int, count int) ([]Post, error)
+	// GetCommentsPage returns up to count comments to p newer than afterId,
+	// oldest first, leaving out authors viewer hides.
+	GetCommentsPage(viewer *User, p *Post, afterId int, count int) ([]Comment, error)
+
+	// Search returns up to count best matches of query skipping the first
+	// offset ones, together with the offset of the next page or 0 if there is
+	// none. Posts, comments and bios viewer may not see are left out.
+	Search(viewer *User, kind SearchKind, query string, offset int, count int) ([]SearchHit, int, error)
 	GetCommentsByPost(*Post) ([]Comment, error)
 
+	// CreateFriendRequest fails if a pending or accepted request between
+	// fr.From and fr.To exists in either direction.
+	CreateFriendRequest(fr *FriendRequest) error
+	LoadFriendRequest(id int) (*FriendRequest, error)
+	UpdateFriendRequestStatus(fr *FriendRequest, status FriendRequestStatus) error
+	// FindFriendRequest returns the pending or accepted request between a and b
+	// in either direction, or nil if there is none.
+	FindFriendRequest(a *User, b *User) (*FriendRequest, error)
+	GetIncomingFriendRequests(*User) ([]FriendRequest, error)
+	GetOutgoingFriendRequests(*User) ([]FriendRequest, error)
+	GetFriends(*User) ([]User, error)
+	AreFriends(a *User, b *User) (bool, error)
+	CountMutualFriends(a *User, b *User) (int, error)
+
+	Follow(follower *User, followee *User) error
+	Unfollow(follower *User, followee *User) error
+	IsFollowing(follower *User, followee *User) (bool, error)
+	CountFollowers(*User) (int, error)
+
+	CreateConversation(c *Conversation) error
+	LoadConversation(id int) (*Conversation, error)
+	// FindDirectConversation returns the 1:1 conversation of a and b, or nil if there is none.
+	FindDirectConversation(a *User, b *User) (*Conversation, error)
+	// GetConversations lists conversations of u, most recently active first.
+	GetConversations(u *User) ([]Conversation, error)
+	CreateMessage(m *Message) error
+	// GetMessages returns up to count messages older than beforeId, newest
+	// first; beforeId 0 starts from the newest message.
+	GetMessages(c *Conversation, beforeId int, count int) ([]Message, error)
+	MarkConversationRead(c *Conversation, u *User, messageId int) error
+	// GetMessagesSince returns up to count messages newer than afterId from
+	// every conversation of u, oldest first. Their Conversation has only Id set.
+	GetMessagesSince(u *User, afterId int, count int) ([]Message, error)
+
+	CreateNotification(n *Notification) error
+	// GetNotifications returns up to count newest notifications of u.
+	GetNotifications(u *User, count int) ([]Notification, error)
+	CountUnreadNotifications(u *User) (int, error)
+	// MarkNotificationsRead marks notification id of u read, or all of them if id is 0.
+	MarkNotificationsRead(u *User, id int) error
+	GetNotificationOptOuts(u *User) ([]NotificationKind, error)
+	SetNotificationOptOut(u *User, k NotificationKind, optOut bool) error
+
+	// GetDueDigestUsers lists users with an email who want digests with
+	// frequency f and were last sent one before sentBefore.
+	GetDueDigestUsers(f DigestFrequency, sentBefore time.Time) ([]User, error)
+	MarkDigestSent(u *User, at time.Time) error
+
 	Close()
 }
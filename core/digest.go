@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// DigestFrequency tells how often a user wants unread notifications mailed.
+type DigestFrequency int
+
+const (
+	DigestNever DigestFrequency = iota
+	DigestDaily
+	DigestWeekly
+)
+
+var DigestFrequencies = []DigestFrequency{
+	DigestNever,
+	DigestDaily,
+	DigestWeekly,
+}
+
+func (f DigestFrequency) String() string {
+	switch f {
+	case DigestNever:
+		return "never"
+	case DigestDaily:
+		return "daily"
+	case DigestWeekly:
+		return "weekly"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(f))
+}
+
+func (f DigestFrequency) Period() time.Duration {
+	switch f {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+
+	return 0
+}
+
+func ParseDigestFrequency(s string) (DigestFrequency, error) {
+	for _, f := range DigestFrequencies {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+
+	return DigestNever, fmt.Errorf("Unknown digest frequency %v", s)
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ActorKey is the RSA key pair signing the activities of a local user, both
+// halves PEM encoded.
+type ActorKey struct {
+	User          *User
+	PrivateKeyPem string
+	PublicKeyPem  string
+	CreatedAt     time.Time
+}
+
+// RemoteActor is an account on another server as its actor document
+// describes it, kept to check its signatures and to deliver to it.
+type RemoteActor struct {
+	Id int
+
+	Uri      string
+	Username string
+	// Url is the page of the account for people, it may be empty.
+	Url   string
+	Inbox string
+	// SharedInbox is empty if the server of the actor has none.
+	SharedInbox  string
+	PublicKeyId  string
+	PublicKeyPem string
+	FetchedAt    time.Time
+}
+
+// DeliveryInbox is where activities for the actor are delivered, the shared
+// inbox if its server has one so each server gets an activity once.
+func (a *RemoteActor) DeliveryInbox() string {
+	if a.SharedInbox != "" {
+		return a.SharedInbox
+	}
+
+	return a.Inbox
+}
+
+// Handle is the actor as @username@host.
+func (a *RemoteActor) Handle() string {
+	u, err := url.Parse(a.Uri)
+	if err != nil || u.Host == "" {
+		return a.Uri
+	}
+
+	return fmt.Sprintf("@%v@%v", a.Username, u.Host)
+}
+
+// RemoteFollow is Actor following the public posts of Followee.
+type RemoteFollow struct {
+	Id int
+
+	Actor    *RemoteActor
+	Followee *User
+	// ActivityUri is the id of the Follow, undoing it refers to it.
+	ActivityUri string
+	CreatedAt   time.Time
+}
+
+type RemoteLike struct {
+	Id int
+
+	Actor       *RemoteActor
+	Post        *Post
+	ActivityUri string
+	CreatedAt   time.Time
+}
+
+// RemoteNote is a note of Actor replying to a local post. Content is plain
+// text, the markup of the note is dropped.
+type RemoteNote struct {
+	Id int
+
+	Uri   string
+	Actor *RemoteActor
+	Post  *Post
+	// Url is the page of the note for people, it may be empty.
+	Url         string
+	Content     string
+	ActivityUri string
+	CreatedAt   time.Time
+}
+
+// FederationDelivery is one activity of Sender posted to the inbox of a
+// remote server, retried until it is delivered or given up.
+type FederationDelivery struct {
+	Id int
+
+	Sender  *User
+	Inbox   string
+	Payload []byte
+	Status  WebhookDeliveryStatus
+
+	Attempts      int
+	NextAttemptAt time.Time
+	// Error tells why the last attempt failed.
+	Error string
+
+	CreatedAt   time.Time
+	DeliveredAt time.Time
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+)
+
+type FriendRequestStatus int
+
+const (
+	FriendRequestPending FriendRequestStatus = iota
+	FriendRequestAccepted
+	FriendRequestDeclined
+	FriendRequestCancelled
+)
+
+type FriendRequest struct {
+	Id int
+
+	From   *User
+	To     *User
+	Status FriendRequestStatus
+}
+
+func (s FriendRequestStatus) String() string {
+	switch s {
+	case FriendRequestPending:
+		return "pending"
+	case FriendRequestAccepted:
+		return "accepted"
+	case FriendRequestDeclined:
+		return "declined"
+	case FriendRequestCancelled:
+		return "cancelled"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+func ParseFriendRequestStatus(s string) (FriendRequestStatus, error) {
+	for _, status := range []FriendRequestStatus{
+		FriendRequestPending,
+		FriendRequestAccepted,
+		FriendRequestDeclined,
+		FriendRequestCancelled,
+	} {
+		if status.String() == s {
+			return status, nil
+		}
+	}
+
+	return FriendRequestPending, fmt.Errorf("Unknown friend request status %v", s)
+}
+
+// CheckFriendRequestTransition verifies that actor is allowed to move fr into
+// the next status. A pending request can be accepted or declined by its
+// recipient and cancelled by its sender; an accepted request (friendship) can
+// be cancelled by either side. Declined and cancelled requests are final.
+func CheckFriendRequestTransition(fr *FriendRequest, actor *User, next FriendRequestStatus) error {
+	isSender := actor.Id == fr.From.Id
+	isRecipient := actor.Id == fr.To.Id
+
+	if !isSender && !isRecipient {
+		return fmt.Errorf("User %v is not a party of friend request %v", actor.Id, fr.Id)
+	}
+
+	switch fr.Status {
+	case FriendRequestPending:
+		switch next {
+		case FriendRequestAccepted, FriendRequestDeclined:
+			if isRecipient {
+				return nil
+			}
+		case FriendRequestCancelled:
+			if isSender {
+				return nil
+			}
+		}
+	case FriendRequestAccepted:
+		if next == FriendRequestCancelled {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Friend request %v cannot become %v from %v", fr.Id, next, fr.Status)
+}
@@ -0,0 +1,22 @@
+package core
+
+// Event is something pushed to a user in real time. Id is the id of the
+// message the event carries, or 0 for transient events like typing.
+type Event struct {
+	Id   int
+	Type string
+	Data []byte
+}
+
+type Subscription interface {
+	// Events is closed when the subscription is closed, either by Close or by
+	// the hub giving up on a subscriber that does not keep up.
+	Events() <-chan Event
+	Close()
+}
+
+// Hub fans events out to every connection a user has open.
+type Hub interface {
+	Subscribe(u *User) Subscription
+	Publish(userIds []int, e Event)
+}
@@ -0,0 +1,12 @@
+package core
+
+type Mail struct {
+	To      string
+	Subject string
+	Headers map[string]string
+	Body    []byte
+}
+
+type Mailer interface {
+	Send(m *Mail) error
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Mention records that Author mentioned User in post PostId, or in its
+// comment CommentId if that is not 0.
+type Mention struct {
+	Id int
+
+	User      *User
+	Author    *User
+	PostId    int
+	CommentId int
+	CreatedAt time.Time
+}
+
+// mentionPattern matches @login not glued to a preceding word, so e-mail
+// addresses are not mentions. The first group is the login.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_][\p{L}\p{N}_.\-]*)`)
+
+// FindMentions returns the byte ranges of mentions in content, each range
+// starts at the @ and ends after the login. Punctuation ending a sentence
+// is not a part of the login.
+func FindMentions(content string) [][2]int {
+	ranges := [][2]int{}
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		login := strings.TrimRight(content[match[2]:match[3]], ".-")
+		ranges = append(ranges, [2]int{match[2] - 1, match[2] + len(login)})
+	}
+
+	return ranges
+}
+
+// ExtractMentions returns the distinct logins mentioned in content in order
+// of appearance, they are not checked to exist.
+func ExtractMentions(content []byte) []string {
+	s := string(content)
+	seen := map[string]bool{}
+	logins := []string{}
+
+	for _, r := range FindMentions(s) {
+		login := s[r[0]+1 : r[1]]
+		if seen[login] {
+			continue
+		}
+
+		seen[login] = true
+		logins = append(logins, login)
+	}
+
+	return logins
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"time"
+)
+
+const (
+	MaxConversationMembers = 10
+)
+
+type ConversationMember struct {
+	User *User
+
+	// LastReadMessageId is the newest message of the conversation the member has seen.
+	LastReadMessageId int
+}
+
+type Conversation struct {
+	Id int
+
+	Title        string
+	Members      []ConversationMember
+	LastActivity time.Time
+
+	// Unread is the number of unread messages of the user who listed the conversation.
+	Unread int
+}
+
+type Message struct {
+	Id int
+
+	Conversation *Conversation
+	Author       *User
+	Content      []byte
+	CreatedAt    time.Time
+}
+
+func (c *Conversation) IsMember(u *User) bool {
+	return c.FindMember(u) != nil
+}
+
+func (c *Conversation) FindMember(u *User) *ConversationMember {
+	for i := range c.Members {
+		if c.Members[i].User.Id == u.Id {
+			return &c.Members[i]
+		}
+	}
+
+	return nil
+}
+
+// ReadBy lists members other than the author who have seen m.
+func (c *Conversation) ReadBy(m *Message) []*User {
+	us := []*User{}
+	for _, member := range c.Members {
+		if member.User.Id != m.Author.Id && member.LastReadMessageId >= m.Id {
+			us = append(us, member.User)
+		}
+	}
+
+	return us
+}
+
+func (c *Conversation) IsDirect() bool {
+	return len(c.Members) == 2
+}
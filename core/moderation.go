@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+const MaxReportReasonLength = 1000
+
+type ReportStatus int
+
+const (
+	ReportOpen ReportStatus = iota
+	ReportDismissed
+	ReportResolved
+)
+
+func (s ReportStatus) String() string {
+	switch s {
+	case ReportOpen:
+		return "open"
+	case ReportDismissed:
+		return "dismissed"
+	case ReportResolved:
+		return "resolved"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// Report asks moderators to look at a post, a comment or an account, exactly
+// one of Post, Comment and User is set. Reported content that was deleted
+// since leaves all three nil. ResolvedBy of a moderator deleted since has
+// Id 0 and only the Login.
+type Report struct {
+	Id int
+
+	Reporter *User
+	Post     *Post
+	Comment  *Comment
+	User     *User
+	Reason   string
+	Status   ReportStatus
+
+	CreatedAt  time.Time
+	ResolvedBy *User
+	ResolvedAt time.Time
+}
+
+// ModerationActionKind is what a moderator did.
+type ModerationActionKind int
+
+const (
+	ModerationDismiss ModerationActionKind = iota
+	ModerationHide
+	ModerationSuspend
+)
+
+var ModerationActionKinds = []ModerationActionKind{
+	ModerationDismiss,
+	ModerationHide,
+	ModerationSuspend,
+}
+
+func (k ModerationActionKind) String() string {
+	switch k {
+	case ModerationDismiss:
+		return "dismiss"
+	case ModerationHide:
+		return "hide"
+	case ModerationSuspend:
+		return "suspend"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+func ParseModerationActionKind(s string) (ModerationActionKind, error) {
+	for _, k := range ModerationActionKinds {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+
+	return ModerationDismiss, fmt.Errorf("Unknown moderation action %v", s)
+}
+
+// ModerationAction records what Moderator did and why. ReportId is the
+// report acted upon or 0, PostId, CommentId and UserId tell what was acted
+// upon, unset ones are 0. Actions read back hold only the Id and Login of
+// Moderator, and Id is 0 if the moderator was demoted and deleted since.
+type ModerationAction struct {
+	Id int
+
+	Moderator *User
+	Kind      ModerationActionKind
+	ReportId  int
+	PostId    int
+	CommentId int
+	UserId    int
+	Reason    string
+	CreatedAt time.Time
+}
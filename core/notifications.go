@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+type NotificationKind int
+
+const (
+	NotificationComment NotificationKind = iota
+	NotificationLike
+	NotificationFollow
+	NotificationFriendRequest
+	NotificationFriendAccepted
+	NotificationMention
+	NotificationMessage
+)
+
+var NotificationKinds = []NotificationKind{
+	NotificationComment,
+	NotificationLike,
+	NotificationFollow,
+	NotificationFriendRequest,
+	NotificationFriendAccepted,
+	NotificationMention,
+	NotificationMessage,
+}
+
+func (k NotificationKind) String() string {
+	switch k {
+	case NotificationComment:
+		return "comment"
+	case NotificationLike:
+		return "like"
+	case NotificationFollow:
+		return "follow"
+	case NotificationFriendRequest:
+		return "friend request"
+	case NotificationFriendAccepted:
+		return "friend accepted"
+	case NotificationMention:
+		return "mention"
+	case NotificationMessage:
+		return "message"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+func ParseNotificationKind(s string) (NotificationKind, error) {
+	for _, k := range NotificationKinds {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+
+	return NotificationComment, fmt.Errorf("Unknown notification kind %v", s)
+}
+
+// Notification tells Recipient that Actor did something. Which of PostId,
+// CommentId and ConversationId are set depends on Kind, unset ones are 0.
+type Notification struct {
+	Id int
+
+	Recipient      *User
+	Actor          *User
+	Kind           NotificationKind
+	PostId         int
+	CommentId      int
+	ConversationId int
+	CreatedAt      time.Time
+	Read           bool
+}
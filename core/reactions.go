@@ -0,0 +1,16 @@
+package core
+
+type Reaction struct {
+	Name  string
+	Emoji string
+}
+
+func FindReaction(rs []Reaction, name string) *Reaction {
+	for i := range rs {
+		if rs[i].Name == name {
+			return &rs[i]
+		}
+	}
+
+	return nil
+}
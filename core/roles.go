@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Role is what a user may do on the site beyond using it, every role can
+// do everything the roles before it can.
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleModerator
+	RoleAdmin
+)
+
+var Roles = []Role{
+	RoleUser,
+	RoleModerator,
+	RoleAdmin,
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleUser:
+		return "user"
+	case RoleModerator:
+		return "moderator"
+	case RoleAdmin:
+		return "admin"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(r))
+}
+
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+
+	return RoleUser, fmt.Errorf("Unknown role %v", s)
+}
+
+// Permission is something handlers check a role for.
+type Permission int
+
+const (
+	// PermissionModerate allows to work the moderation queue and to see
+	// hidden content and suspended accounts.
+	PermissionModerate Permission = iota
+	// PermissionAdminister allows to use /admin and to change roles.
+	PermissionAdminister
+)
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionModerate:
+		return "moderate"
+	case PermissionAdminister:
+		return "administer"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// Has tells whether r is granted p.
+func (r Role) Has(p Permission) bool {
+	switch p {
+	case PermissionModerate:
+		return r >= RoleModerator
+	case PermissionAdminister:
+		return r >= RoleAdmin
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+)
+
+// SearchKind selects what /search looks through.
+type SearchKind int
+
+const (
+	SearchUsers SearchKind = iota
+	SearchPosts
+	SearchComments
+)
+
+var SearchKinds = []SearchKind{
+	SearchUsers,
+	SearchPosts,
+	SearchComments,
+}
+
+func (k SearchKind) String() string {
+	switch k {
+	case SearchUsers:
+		return "users"
+	case SearchPosts:
+		return "posts"
+	case SearchComments:
+		return "comments"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+func ParseSearchKind(s string) (SearchKind, error) {
+	for _, k := range SearchKinds {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+
+	return SearchUsers, fmt.Errorf("Unknown search kind %v", s)
+}
+
+// SearchHit is one search result, exactly one of User, Post and Comment is
+// set depending on the kind of the search. Snippet is an excerpt of the
+// matching text with SnippetOpen and SnippetClose around the matched terms.
+// The CommentedPost of Comment only has its Id.
+type SearchHit struct {
+	User    *User
+	Post    *Post
+	Comment *Comment
+	Snippet string
+}
+
+// Markers put around matched terms in snippets, they cannot appear in
+// text typed in a browser so are safe to replace after HTML escaping.
+const (
+	SnippetOpen  = "\x02"
+	SnippetClose = "\x03"
+)
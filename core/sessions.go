@@ -0,0 +1,28 @@
+package core
+
+import (
+	"time"
+)
+
+// Session is a login of User from one browser, its id is a part of the
+// token cookie. Revoked sessions no longer log anybody in.
+type Session struct {
+	Id int
+
+	User      *User
+	Address   string
+	UserAgent string
+
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Revoked    bool
+}
+
+// DayStats counts what was created on the UTC day starting at Day.
+type DayStats struct {
+	Day time.Time
+
+	Users    int
+	Posts    int
+	Comments int
+}
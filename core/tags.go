@@ -0,0 +1,63 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+const MaxTagLength = 64
+
+// TrendingTag is a tag ranked by how much and how recently it was used.
+type TrendingTag struct {
+	Name  string
+	Posts int
+	Score float64
+}
+
+// hashtagPattern matches #tag not glued to a preceding word, so that
+// "C#" or "page#anchor" are not tags. The first group is the tag itself.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])#([\p{L}\p{N}_]+)`)
+
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+
+// NormalizeTag returns the stored form of a tag: lower case and without
+// the leading #. It returns "" if s is not a valid tag.
+func NormalizeTag(s string) string {
+	s = strings.ToLower(strings.TrimPrefix(s, "#"))
+	if len(s) > MaxTagLength || !tagPattern.MatchString(s) {
+		return ""
+	}
+
+	return s
+}
+
+// FindHashtags returns the byte ranges of hashtags in content, each range
+// starts at the # and ends after the tag.
+func FindHashtags(content string) [][2]int {
+	ranges := [][2]int{}
+	for _, match := range hashtagPattern.FindAllStringSubmatchIndex(content, -1) {
+		ranges = append(ranges, [2]int{match[2] - 1, match[3]})
+	}
+
+	return ranges
+}
+
+// ExtractHashtags returns the distinct normalized tags of content in order
+// of appearance.
+func ExtractHashtags(content []byte) []string {
+	s := string(content)
+	seen := map[string]bool{}
+	tags := []string{}
+
+	for _, r := range FindHashtags(s) {
+		tag := NormalizeTag(s[r[0]:r[1]])
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scope is what a personal access token may be used for.
+type Scope int
+
+const (
+	// ScopeRead reads what the user may see, except messages.
+	ScopeRead Scope = iota
+	// ScopeWritePosts writes posts, comments, likes and follows.
+	ScopeWritePosts
+	// ScopeMessages reads and sends messages.
+	ScopeMessages
+)
+
+var Scopes = []Scope{
+	ScopeRead,
+	ScopeWritePosts,
+	ScopeMessages,
+}
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeRead:
+		return "read"
+	case ScopeWritePosts:
+		return "write_posts"
+	case ScopeMessages:
+		return "messages"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+func ParseScope(s string) (Scope, error) {
+	for _, scope := range Scopes {
+		if scope.String() == s {
+			return scope, nil
+		}
+	}
+
+	return ScopeRead, fmt.Errorf("Unknown scope %v", s)
+}
+
+// AccessToken lets scripts use the API as User, within Scopes. Only a hash
+// of its secret is stored, the secret is shown once when it is created.
+type AccessToken struct {
+	Id int
+
+	User   *User
+	Name   string
+	Scopes []Scope
+
+	CreatedAt time.Time
+	// ExpiresAt is zero for tokens that do not expire.
+	ExpiresAt time.Time
+	// LastUsedAt is zero for tokens never used.
+	LastUsedAt time.Time
+	Revoked    bool
+}
+
+func (t *AccessToken) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *AccessToken) IsExpired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
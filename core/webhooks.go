@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// WebhookEvent is what happened to the owner of a webhook.
+type WebhookEvent int
+
+const (
+	// WebhookPost is a new post of the owner.
+	WebhookPost WebhookEvent = iota
+	// WebhookComment is a new comment to a post of the owner.
+	WebhookComment
+	// WebhookFollower is a new follower of the owner.
+	WebhookFollower
+	// WebhookMessage is a new message to the owner.
+	WebhookMessage
+	// WebhookTest is sent by the owner to try the webhook out.
+	WebhookTest
+)
+
+// WebhookEvents are the events webhooks may subscribe to.
+var WebhookEvents = []WebhookEvent{
+	WebhookPost,
+	WebhookComment,
+	WebhookFollower,
+	WebhookMessage,
+}
+
+func (e WebhookEvent) String() string {
+	switch e {
+	case WebhookPost:
+		return "post.created"
+	case WebhookComment:
+		return "comment.created"
+	case WebhookFollower:
+		return "follower.created"
+	case WebhookMessage:
+		return "message.created"
+	case WebhookTest:
+		return "test"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(e))
+}
+
+func ParseWebhookEvent(s string) (WebhookEvent, error) {
+	for _, e := range WebhookEvents {
+		if e.String() == s {
+			return e, nil
+		}
+	}
+
+	return WebhookPost, fmt.Errorf("Unknown webhook event %v", s)
+}
+
+// Webhook posts the events it subscribes to to Url, signed with Secret.
+type Webhook struct {
+	Id int
+
+	Owner  *User
+	Url    string
+	Secret string
+	Events []WebhookEvent
+
+	// Failures counts the attempts failed since the last success, too many
+	// of them disable the webhook.
+	Failures  int
+	Disabled  bool
+	CreatedAt time.Time
+}
+
+func (h *Webhook) SubscribesTo(e WebhookEvent) bool {
+	for _, other := range h.Events {
+		if other == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+type WebhookDeliveryStatus int
+
+const (
+	DeliveryPending WebhookDeliveryStatus = iota
+	DeliveryDelivered
+	DeliveryFailed
+)
+
+func (s WebhookDeliveryStatus) String() string {
+	switch s {
+	case DeliveryPending:
+		return "pending"
+	case DeliveryDelivered:
+		return "delivered"
+	case DeliveryFailed:
+		return "failed"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// WebhookDelivery is one event sent to a webhook, retried until it is
+// delivered or given up.
+type WebhookDelivery struct {
+	Id int
+
+	Webhook *Webhook
+	Event   WebhookEvent
+	Payload []byte
+	Status  WebhookDeliveryStatus
+
+	Attempts      int
+	NextAttemptAt time.Time
+	// ResponseCode and Error tell how the last attempt went.
+	ResponseCode int
+	Error        string
+
+	CreatedAt time.Time
+	// DeliveredAt is zero until the delivery succeeds.
+	DeliveredAt time.Time
+}
@@ -3,7 +3,7 @@ module github.com/JouleJ/socnet
 go 1.19
 
 require (
-	github.com/go-chi/chi/v5 v5.0.8 // indirect
-	github.com/mattn/go-sqlite3 v1.14.16 // indirect
-	golang.org/x/net v0.8.0 // indirect
+	github.com/go-chi/chi/v5 v5.0.8
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/net v0.8.0
 )
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"log"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// CanSee is the single place deciding whether viewer may see something owned
+// by owner with visibility v. viewer is nil for anonymous visitors. Lists
+// apply the same rules in SQL, see visibleProfileClause and
+// visiblePostsClause.
+func CanSee(viewer *core.User, owner *core.User, v core.Visibility, db core.Database) bool {
+	if viewer != nil && viewer.Id == owner.Id {
+		return true
+	}
+
+	if IsBlockedBy(viewer, owner, db) {
+		return false
+	}
+
+	if owner.Suspended && !Can(viewer, core.PermissionModerate) {
+		return false
+	}
+
+	switch v {
+	case core.VisibilityPublic:
+		return true
+	case core.VisibilityFollowers:
+		if viewer == nil {
+			return false
+		}
+
+		following, err := db.IsFollowing(viewer, owner)
+		if err != nil {
+			log.Printf("Failed to check if %v follows %v: %v\n", viewer.Id, owner.Id, err)
+			return false
+		}
+
+		if following {
+			return true
+		}
+
+		// Friends are trusted at least as much as followers.
+		fallthrough
+	case core.VisibilityFriends:
+		if viewer == nil {
+			return false
+		}
+
+		friends, err := db.AreFriends(viewer, owner)
+		if err != nil {
+			log.Printf("Failed to check if %v and %v are friends: %v\n", viewer.Id, owner.Id, err)
+			return false
+		}
+
+		return friends
+	}
+
+	return false
+}
+
+// IsBlockedBy tells whether owner blocked viewer.
+func IsBlockedBy(viewer *core.User, owner *core.User, db core.Database) bool {
+	if viewer == nil {
+		return false
+	}
+
+	blocked, err := db.IsBlocked(owner, viewer, core.BlockKindBlock)
+	if err != nil {
+		log.Printf("Failed to check if %v blocked %v: %v\n", owner.Id, viewer.Id, err)
+		return true
+	}
+
+	return blocked
+}
+
+// Hides tells whether content by author is left out of what viewer sees in
+// feeds, search and comments: viewer muted or blocked author, or the other
+// way round author blocked viewer.
+func Hides(viewer *core.User, author *core.User, db core.Database) bool {
+	if viewer == nil || viewer.Id == author.Id {
+		return false
+	}
+
+	for _, k := range core.BlockKinds {
+		hidden, err := db.IsBlocked(viewer, author, k)
+		if err != nil {
+			log.Printf("Failed to check if %v %v %v: %v\n", viewer.Id, k, author.Id, err)
+			return true
+		}
+
+		if hidden {
+			return true
+		}
+	}
+
+	return IsBlockedBy(viewer, author, db)
+}
+
+func CanViewProfile(viewer *core.User, u *core.User, db core.Database) bool {
+	return CanSee(viewer, u, u.Visibility, db)
+}
+
+// CanViewPost requires both the author's profile and the post itself to be visible.
+func CanViewPost(viewer *core.User, p *core.Post, db core.Database) bool {
+	return CanViewProfile(viewer, p.Author, db) && CanSee(viewer, p.Author, p.Visibility, db)
+}
+
+// CanMessage tells whether sender may write to recipient privately, recipients
+// choose who may contact them through MessageVisibility.
+func CanMessage(sender *core.User, recipient *core.User, db core.Database) bool {
+	return CanSee(sender, recipient, recipient.MessageVisibility, db)
+}
+
+// IsBlockedBetween tells whether either of a and b blocked the other.
+func IsBlockedBetween(a *core.User, b *core.User, db core.Database) bool {
+	return IsBlockedBy(a, b, db) || IsBlockedBy(b, a, db)
+}
+
+// CanWrite tells whether sender may send a message to c. Nobody writes to
+// a member they blocked or who blocked them, in groups too, and the other
+// member of a direct conversation must accept messages from sender.
+func CanWrite(sender *core.User, c *core.Conversation, db core.Database) bool {
+	for _, member := range c.Members {
+		if member.User.Id == sender.Id {
+			continue
+		}
+
+		if IsBlockedBetween(sender, member.User, db) {
+			return false
+		}
+
+		if c.IsDirect() && !CanMessage(sender, member.User, db) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,824 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	ActivityJsonType       = "application/activity+json"
+	ActivityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	securityContext        = "https://w3id.org/security/v1"
+	publicAudience         = "https://www.w3.org/ns/activitystreams#Public"
+
+	// MaxActivitySize is the largest activity or document read from other
+	// servers.
+	MaxActivitySize = 1 << 20
+	// remoteActorTtl is how long a fetched actor document is trusted before
+	// it is fetched again.
+	remoteActorTtl = 24 * time.Hour
+	// maxRemoteNoteLength is how many characters of a remote reply are kept.
+	maxRemoteNoteLength = 5000
+
+	// federationMaxAttempts is how many times a delivery is tried before it
+	// is given up, federationRetryDelay doubles after each attempt like
+	// webhookRetryDelay.
+	federationMaxAttempts = 8
+	federationRetryDelay  = time.Minute
+	federationTimeout     = 10 * time.Second
+	federationBatchSize   = 100
+)
+
+// FederationClient fetches documents from and delivers activities to other
+// servers. *http.Client is one, the client of an httptest.Server standing in
+// for a remote server can replace it.
+type FederationClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// NewFederationClient returns the client talking to other servers. Like
+// webhooks it refuses loopback and private addresses, unless
+// FEDERATION_ALLOW_PRIVATE is set to federate with a server running next
+// to this one.
+func NewFederationClient() FederationClient {
+	return newOutboundClient(os.Getenv("FEDERATION_ALLOW_PRIVATE") != "", federationTimeout)
+}
+
+// FederationHost is the host in the @login@host handles of local users.
+func FederationHost() string {
+	u, err := url.Parse(SiteUrl())
+	if err != nil {
+		return SiteUrl()
+	}
+
+	return u.Host
+}
+
+func ActorUri(u *core.User) string {
+	return fmt.Sprintf("%v/ap/users/%v", SiteUrl(), u.Id)
+}
+
+func actorKeyId(u *core.User) string {
+	return ActorUri(u) + "#main-key"
+}
+
+func PostUri(p *core.Post) string {
+	return fmt.Sprintf("%v/ap/posts/%v", SiteUrl(), p.Id)
+}
+
+// localId returns the id at the end of uri if it starts with prefix on this
+// server, or 0.
+func localId(uri string, prefix string) int {
+	rest := strings.TrimPrefix(uri, SiteUrl()+prefix)
+	if rest == uri {
+		return 0
+	}
+
+	id, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0
+	}
+
+	return id
+}
+
+// IsFederated tells whether other servers may see u: only profiles anyone
+// may see are published.
+func IsFederated(u *core.User, db core.Database) bool {
+	return CanViewProfile(nil, u, db)
+}
+
+// IsFederatedPost tells whether p is published to other servers, which
+// takes the posts listed in feeds but for plain reposts.
+func IsFederatedPost(p *core.Post, db core.Database) bool {
+	return IsFeedPost(p, db) && !p.IsPlainRepost()
+}
+
+// actorKey returns the key of u, generating it on first use.
+func actorKey(db core.Database, u *core.User) (*core.ActorKey, error) {
+	if k, err := db.GetActorKey(u); err == nil {
+		return k, nil
+	}
+
+	privatePem, publicPem, err := NewActorKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	// Another request may have stored a key meanwhile, that one is kept.
+	err = db.CreateActorKey(&core.ActorKey{User: u, PrivateKeyPem: privatePem, PublicKeyPem: publicPem})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store key of user %v due to %v\n", u.Id, err)
+	}
+
+	return db.GetActorKey(u)
+}
+
+type ApPublicKey struct {
+	Id           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type ApEndpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type ApActor struct {
+	Context           any          `json:"@context,omitempty"`
+	Id                string       `json:"id"`
+	Type              string       `json:"type"`
+	PreferredUsername string       `json:"preferredUsername"`
+	Name              string       `json:"name"`
+	Summary           string       `json:"summary,omitempty"`
+	Url               string       `json:"url"`
+	Inbox             string       `json:"inbox"`
+	Outbox            string       `json:"outbox"`
+	Followers         string       `json:"followers"`
+	Endpoints         *ApEndpoints `json:"endpoints,omitempty"`
+	PublicKey         *ApPublicKey `json:"publicKey,omitempty"`
+}
+
+type ApTag struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type ApNote struct {
+	Context      any      `json:"@context,omitempty"`
+	Id           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	Url          string   `json:"url"`
+	Published    string   `json:"published"`
+	To           []string `json:"to"`
+	Cc           []string `json:"cc,omitempty"`
+	Tag          []ApTag  `json:"tag,omitempty"`
+}
+
+type ApActivity struct {
+	Context   any      `json:"@context,omitempty"`
+	Id        string   `json:"id"`
+	Type      string   `json:"type"`
+	Actor     string   `json:"actor"`
+	Object    any      `json:"object"`
+	Published string   `json:"published,omitempty"`
+	To        []string `json:"to,omitempty"`
+	Cc        []string `json:"cc,omitempty"`
+}
+
+type ApCollection struct {
+	Context      any    `json:"@context,omitempty"`
+	Id           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+// WriteActivityJson writes v as an ActivityStreams document.
+func WriteActivityJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", ActivityJsonType)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write activity: %v\n", err)
+	}
+}
+
+// FindWebFinger answers a WebFinger query for resource, either
+// acct:login@host or the uri of an actor.
+func FindWebFinger(resource string, db core.Database) (*WebFinger, error) {
+	var u *core.User
+	var err error
+
+	if id := localId(resource, "/ap/users/"); id != 0 {
+		u, err = db.LoadUser(id)
+	} else {
+		login := strings.TrimPrefix(resource, "acct:")
+		if !strings.HasSuffix(login, "@"+FederationHost()) || login == resource {
+			return nil, fmt.Errorf("Resource %v is not on this server", resource)
+		}
+
+		u, err = db.FindUser(strings.TrimSuffix(login, "@"+FederationHost()))
+	}
+
+	if err != nil || !IsFederated(u, db) {
+		return nil, fmt.Errorf("No actor for resource %v", resource)
+	}
+
+	return &WebFinger{
+		Subject: fmt.Sprintf("acct:%v@%v", u.Login, FederationHost()),
+		Aliases: []string{ActorUri(u)},
+		Links: []WebFingerLink{
+			{Rel: "self", Type: ActivityJsonType, Href: ActorUri(u)},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: fmt.Sprintf("%v/user?id=%v", SiteUrl(), u.Id)},
+		},
+	}, nil
+}
+
+// NewApActor returns the actor document of u.
+func NewApActor(u *core.User, db core.Database) (*ApActor, error) {
+	k, err := actorKey(db, u)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := ActorUri(u)
+	return &ApActor{
+		Context:           []string{ActivityStreamsContext, securityContext},
+		Id:                uri,
+		Type:              "Person",
+		PreferredUsername: u.Login,
+		Name:              u.Login,
+		Summary:           html.EscapeString(string(u.Bio)),
+		Url:               fmt.Sprintf("%v/user?id=%v", SiteUrl(), u.Id),
+		Inbox:             uri + "/inbox",
+		Outbox:            uri + "/outbox",
+		Followers:         uri + "/followers",
+		Endpoints:         &ApEndpoints{SharedInbox: SiteUrl() + "/ap/inbox"},
+		PublicKey:         &ApPublicKey{Id: actorKeyId(u), Owner: uri, PublicKeyPem: k.PublicKeyPem},
+	}, nil
+}
+
+// NewApNote returns p as a note, its links made absolute.
+func NewApNote(p *core.Post, db core.Database) *ApNote {
+	content := strings.ReplaceAll(feedContent(p, db), `href="/`, `href="`+SiteUrl()+`/`)
+
+	n := &ApNote{
+		Id:           PostUri(p),
+		Type:         "Note",
+		AttributedTo: ActorUri(p.Author),
+		Content:      content,
+		Url:          fmt.Sprintf("%v/post?id=%v", SiteUrl(), p.Id),
+		Published:    feedTime(p.CreatedAt),
+		To:           []string{publicAudience},
+		Cc:           []string{ActorUri(p.Author) + "/followers"},
+	}
+
+	s := string(p.Content)
+	for _, r := range core.FindHashtags(s) {
+		if tag := core.NormalizeTag(s[r[0]:r[1]]); tag != "" {
+			n.Tag = append(n.Tag, ApTag{Type: "Hashtag", Href: SiteUrl() + TagUrl(tag), Name: "#" + tag})
+		}
+	}
+
+	mentioned, err := db.GetMentionedUsers(p.Id, 0)
+	if err != nil {
+		log.Printf("Failed to load mentions in post %v: %v\n", p.Id, err)
+	}
+
+	for i := range mentioned {
+		if IsFederated(&mentioned[i], db) {
+			n.Tag = append(n.Tag, ApTag{
+				Type: "Mention",
+				Href: ActorUri(&mentioned[i]),
+				Name: fmt.Sprintf("@%v@%v", mentioned[i].Login, FederationHost()),
+			})
+		}
+	}
+
+	return n
+}
+
+func newCreateActivity(p *core.Post, db core.Database) *ApActivity {
+	n := NewApNote(p, db)
+	return &ApActivity{
+		Id:        n.Id + "/activity",
+		Type:      "Create",
+		Actor:     n.AttributedTo,
+		Object:    n,
+		Published: n.Published,
+		To:        n.To,
+		Cc:        n.Cc,
+	}
+}
+
+// NewApOutbox returns the outbox of u with the creation of its newest
+// FeedPostCount federated posts.
+func NewApOutbox(u *core.User, db core.Database) (*ApCollection, error) {
+	ps, err := db.GetPostsByUser(nil, u)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ApCollection{Context: ActivityStreamsContext, Id: ActorUri(u) + "/outbox", Type: "OrderedCollection"}
+	for i := len(ps) - 1; i >= 0; i-- {
+		if !IsFederatedPost(&ps[i], db) {
+			continue
+		}
+
+		c.TotalItems++
+		if len(c.OrderedItems) < FeedPostCount {
+			c.OrderedItems = append(c.OrderedItems, newCreateActivity(&ps[i], db))
+		}
+	}
+
+	return c, nil
+}
+
+// NewApFollowers returns the followers collection of u, which only tells
+// how many remote followers it has.
+func NewApFollowers(u *core.User, db core.Database) (*ApCollection, error) {
+	fs, err := db.GetRemoteFollowers(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ApCollection{Context: ActivityStreamsContext, Id: ActorUri(u) + "/followers", Type: "OrderedCollection", TotalItems: len(fs)}, nil
+}
+
+// apRef is the id an activity refers to by raw, which is either the id
+// itself or an object with it.
+func apRef(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+
+	var object struct {
+		Id string `json:"id"`
+	}
+	if json.Unmarshal(raw, &object) == nil {
+		return object.Id
+	}
+
+	return ""
+}
+
+// incomingObject holds what is read of activities and notes received, the
+// fields that may be an id or an object are left raw.
+type incomingObject struct {
+	Id           string          `json:"id"`
+	Type         string          `json:"type"`
+	Actor        json.RawMessage `json:"actor"`
+	Object       json.RawMessage `json:"object"`
+	AttributedTo json.RawMessage `json:"attributedTo"`
+	InReplyTo    json.RawMessage `json:"inReplyTo"`
+	Url          json.RawMessage `json:"url"`
+	Content      string          `json:"content"`
+	Published    string          `json:"published"`
+}
+
+type remoteActorDocument struct {
+	Id                string          `json:"id"`
+	Type              string          `json:"type"`
+	PreferredUsername string          `json:"preferredUsername"`
+	Url               json.RawMessage `json:"url"`
+	Inbox             string          `json:"inbox"`
+	Endpoints         ApEndpoints     `json:"endpoints"`
+	PublicKey         ApPublicKey     `json:"publicKey"`
+}
+
+func isRemoteUri(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// fetchActivityJson reads the document at uri into v.
+func fetchActivityJson(client FederationClient, uri string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", ActivityJsonType+`, application/ld+json; profile="`+ActivityStreamsContext+`"`)
+	req.Header.Set("User-Agent", "socnet-federation")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v answered %v", uri, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, MaxActivitySize)).Decode(v)
+}
+
+// FetchRemoteActor returns the actor with uri, fetching its document if it
+// is not known or older than remoteActorTtl, or refresh is set.
+func FetchRemoteActor(db core.Database, client FederationClient, uri string, refresh bool) (*core.RemoteActor, error) {
+	if a, err := db.FindRemoteActor(uri); err == nil && !refresh && time.Since(a.FetchedAt) < remoteActorTtl {
+		return a, nil
+	}
+
+	if !isRemoteUri(uri) || localId(uri, "/ap/users/") != 0 {
+		return nil, fmt.Errorf("Actor %v is not on another server", uri)
+	}
+
+	doc := &remoteActorDocument{}
+	if err := fetchActivityJson(client, uri, doc); err != nil {
+		return nil, fmt.Errorf("Failed to fetch actor %v due to %v\n", uri, err)
+	}
+
+	if doc.Id != uri || !isRemoteUri(doc.Inbox) || doc.PublicKey.Owner != uri || doc.PublicKey.PublicKeyPem == "" {
+		return nil, fmt.Errorf("Document of actor %v is not a usable actor\n", uri)
+	}
+
+	a := &core.RemoteActor{
+		Uri:          uri,
+		Username:     doc.PreferredUsername,
+		Url:          apRef(doc.Url),
+		Inbox:        doc.Inbox,
+		PublicKeyId:  doc.PublicKey.Id,
+		PublicKeyPem: doc.PublicKey.PublicKeyPem,
+	}
+	if isRemoteUri(doc.Endpoints.SharedInbox) {
+		a.SharedInbox = doc.Endpoints.SharedInbox
+	}
+	if a.Username == "" {
+		a.Username = uri
+	}
+	if !isRemoteUri(a.Url) {
+		a.Url = ""
+	}
+
+	return a, db.StoreRemoteActor(a)
+}
+
+// VerifyInbox checks the signature of a request posting body to an inbox
+// and returns its signer, the actor of the activity. A key the signer no
+// longer uses is noticed by fetching its actor again.
+func VerifyInbox(db core.Database, client FederationClient, r *http.Request, body []byte) (*core.RemoteActor, error) {
+	sig, err := ParseSignature(r)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &incomingObject{}
+	if err := json.Unmarshal(body, activity); err != nil {
+		return nil, fmt.Errorf("Malformed activity: %v", err)
+	}
+
+	uri := apRef(activity.Actor)
+	if uri == "" {
+		return nil, fmt.Errorf("The activity has no actor")
+	}
+
+	for _, refresh := range []bool{false, true} {
+		a, err := FetchRemoteActor(db, client, uri, refresh)
+		if err != nil {
+			return nil, err
+		}
+
+		if sig.KeyId != a.PublicKeyId {
+			err = fmt.Errorf("Key %v is not the key of %v", sig.KeyId, uri)
+		} else {
+			err = VerifyRequestSignature(r, body, sig, a.PublicKeyPem, time.Now())
+		}
+
+		if err == nil {
+			return a, nil
+		}
+
+		if refresh || time.Since(a.FetchedAt) < time.Minute {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("Failed to verify the signature of %v", uri)
+}
+
+var (
+	htmlBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+	htmlTagRegexp   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText drops the markup of the content of a remote note.
+func htmlToText(s string) string {
+	s = htmlBreakRegexp.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(htmlTagRegexp.ReplaceAllString(s, ""))
+	s = strings.TrimSpace(s)
+
+	runes := []rune(s)
+	if len(runes) > maxRemoteNoteLength {
+		s = string(runes[:maxRemoteNoteLength]) + "…"
+	}
+
+	return s
+}
+
+// loadFederatedUser returns the local user with actor uri, if other servers
+// may see them.
+func loadFederatedUser(uri string, db core.Database) (*core.User, error) {
+	u, err := db.LoadUser(localId(uri, "/ap/users/"))
+	if err != nil || !IsFederated(u, db) {
+		return nil, fmt.Errorf("No local actor %v", uri)
+	}
+
+	return u, nil
+}
+
+// loadFederatedPost returns the local post with uri or page url, if it is
+// published to other servers.
+func loadFederatedPost(uri string, db core.Database) (*core.Post, error) {
+	id := localId(uri, "/ap/posts/")
+	if id == 0 {
+		id = localId(uri, "/post?id=")
+	}
+
+	p, err := db.LoadPost(id)
+	if err != nil || !IsFederatedPost(p, db) {
+		return nil, fmt.Errorf("No local post %v", uri)
+	}
+
+	return p, nil
+}
+
+// HandleActivity applies the activity in body, signed by actor, to this
+// server. Follow, Like, Create of replies to local posts and Undo of those
+// are understood, other activities are ignored.
+func HandleActivity(db core.Database, actor *core.RemoteActor, body []byte) error {
+	activity := &incomingObject{}
+	if err := json.Unmarshal(body, activity); err != nil {
+		return fmt.Errorf("Malformed activity: %v", err)
+	}
+
+	if apRef(activity.Actor) != actor.Uri {
+		return fmt.Errorf("Activity %v is not by its signer %v", activity.Id, actor.Uri)
+	}
+
+	switch activity.Type {
+	case "Follow":
+		return acceptFollow(db, actor, activity)
+	case "Like":
+		p, err := loadFederatedPost(apRef(activity.Object), db)
+		if err != nil {
+			return err
+		}
+
+		return db.CreateRemoteLike(&core.RemoteLike{Actor: actor, Post: p, ActivityUri: activity.Id})
+	case "Create":
+		return storeRemoteNote(db, actor, activity)
+	case "Undo":
+		return undoActivity(db, actor, activity)
+	}
+
+	log.Printf("Ignoring %v activity %v of %v\n", activity.Type, activity.Id, actor.Uri)
+	return nil
+}
+
+// acceptFollow stores follow and queues its Accept, every follow of a
+// published profile is accepted.
+func acceptFollow(db core.Database, actor *core.RemoteActor, follow *incomingObject) error {
+	u, err := loadFederatedUser(apRef(follow.Object), db)
+	if err != nil {
+		return err
+	}
+
+	f := &core.RemoteFollow{Actor: actor, Followee: u, ActivityUri: follow.Id}
+	if err := db.CreateRemoteFollow(f); err != nil {
+		return err
+	}
+
+	accept := &ApActivity{
+		Context: ActivityStreamsContext,
+		Id:      fmt.Sprintf("%v#accepts/follows/%v", ActorUri(u), f.Id),
+		Type:    "Accept",
+		Actor:   ActorUri(u),
+		Object: &ApActivity{
+			Id:     follow.Id,
+			Type:   "Follow",
+			Actor:  actor.Uri,
+			Object: ActorUri(u),
+		},
+	}
+
+	return queueActivity(db, u, []string{actor.Inbox}, accept)
+}
+
+// storeRemoteNote stores the note created by activity if it replies to a
+// local post, other notes are not kept.
+func storeRemoteNote(db core.Database, actor *core.RemoteActor, activity *incomingObject) error {
+	n := &incomingObject{}
+	if err := json.Unmarshal(activity.Object, n); err != nil || n.Type != "Note" {
+		log.Printf("Ignoring creation %v of something else than a note\n", activity.Id)
+		return nil
+	}
+
+	if apRef(n.AttributedTo) != actor.Uri || !isRemoteUri(n.Id) {
+		return fmt.Errorf("Note %v is not by %v", n.Id, actor.Uri)
+	}
+
+	p, err := loadFederatedPost(apRef(n.InReplyTo), db)
+	if err != nil {
+		log.Printf("Ignoring note %v not replying to a local post\n", n.Id)
+		return nil
+	}
+
+	note := &core.RemoteNote{
+		Uri:         n.Id,
+		Actor:       actor,
+		Post:        p,
+		Url:         apRef(n.Url),
+		Content:     htmlToText(n.Content),
+		ActivityUri: activity.Id,
+	}
+	if !isRemoteUri(note.Url) {
+		note.Url = ""
+	}
+	if published, err := time.Parse(time.RFC3339, n.Published); err == nil && published.Before(time.Now()) {
+		note.CreatedAt = published
+	}
+
+	return db.CreateRemoteNote(note)
+}
+
+// undoActivity undoes the follow, like or note activity refers to, by the
+// id of the undone activity or, for embedded follows and likes, by what they
+// were about.
+func undoActivity(db core.Database, actor *core.RemoteActor, activity *incomingObject) error {
+	undone, err := db.UndoRemoteActivity(actor, apRef(activity.Object))
+	if err != nil || undone {
+		return err
+	}
+
+	inner := &incomingObject{}
+	if json.Unmarshal(activity.Object, inner) != nil {
+		return nil
+	}
+
+	if ref := apRef(inner.Actor); ref != "" && ref != actor.Uri {
+		return fmt.Errorf("Activity %v is not by %v", inner.Id, actor.Uri)
+	}
+
+	switch inner.Type {
+	case "Follow":
+		if u, err := loadFederatedUser(apRef(inner.Object), db); err == nil {
+			return db.DeleteRemoteFollow(actor, u)
+		}
+	case "Like":
+		if p, err := loadFederatedPost(apRef(inner.Object), db); err == nil {
+			return db.DeleteRemoteLike(actor, p)
+		}
+	}
+
+	return nil
+}
+
+// queueActivity queues a delivery of activity by sender to each of inboxes.
+func queueActivity(db core.Database, sender *core.User, inboxes []string, activity *ApActivity) error {
+	if activity.Context == nil {
+		activity.Context = ActivityStreamsContext
+	}
+
+	payload, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	for _, inbox := range inboxes {
+		d := &core.FederationDelivery{Sender: sender, Inbox: inbox, Payload: payload, Status: core.DeliveryPending}
+		if err := db.CreateFederationDelivery(d); err != nil {
+			return fmt.Errorf("Failed to queue %v to %v due to %v\n", activity.Id, inbox, err)
+		}
+	}
+
+	return nil
+}
+
+// FederatePost delivers the creation of p to the servers of the remote
+// followers of its author, once per server. Failures are only logged like
+// those of webhooks.
+func FederatePost(db core.Database, p *core.Post) {
+	if !IsFederatedPost(p, db) {
+		return
+	}
+
+	fs, err := db.GetRemoteFollowers(p.Author)
+	if err != nil {
+		log.Printf("Failed to load remote followers of %v: %v\n", p.Author.Id, err)
+		return
+	}
+
+	inboxes := []string{}
+	seen := map[string]bool{}
+	for _, f := range fs {
+		inbox := f.Actor.DeliveryInbox()
+		if !seen[inbox] {
+			seen[inbox] = true
+			inboxes = append(inboxes, inbox)
+		}
+	}
+
+	if err := queueActivity(db, p.Author, inboxes, newCreateActivity(p, db)); err != nil {
+		log.Printf("Failed to federate post %v: %v\n", p.Id, err)
+	}
+}
+
+// postActivity posts d to its inbox, signed with the key of its sender.
+func postActivity(db core.Database, client FederationClient, d *core.FederationDelivery, now time.Time) error {
+	k, err := actorKey(db, d.Sender)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.Inbox, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", ActivityJsonType)
+	req.Header.Set("User-Agent", "socnet-federation")
+	if err := SignRequest(req, d.Payload, actorKeyId(d.Sender), k.PrivateKeyPem, now); err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, MaxActivitySize))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("The inbox answered %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// DeliverActivity makes an attempt at d and stores how it went, failed
+// deliveries are retried with exponential backoff. Activities of users no
+// longer published are dropped.
+func DeliverActivity(db core.Database, client FederationClient, d *core.FederationDelivery, now time.Time) error {
+	d.Attempts++
+
+	federated := IsFederated(d.Sender, db)
+	err := fmt.Errorf("The sender is no longer federated")
+	if federated {
+		err = postActivity(db, client, d, now)
+	}
+
+	d.Error = ""
+	if err == nil {
+		d.Status = core.DeliveryDelivered
+		d.DeliveredAt = now
+	} else {
+		log.Printf("Failed to deliver activity %v to %v: %v\n", d.Id, d.Inbox, err)
+
+		d.Error = err.Error()
+		if d.Attempts >= federationMaxAttempts || !federated {
+			d.Status = core.DeliveryFailed
+		} else {
+			d.NextAttemptAt = now.Add(federationRetryDelay << (d.Attempts - 1))
+		}
+	}
+
+	return db.UpdateFederationDelivery(d)
+}
+
+// DeliverActivities makes an attempt at every delivery due by now.
+func DeliverActivities(db core.Database, client FederationClient, now time.Time) {
+	ds, err := db.GetDueFederationDeliveries(now, federationBatchSize)
+	if err != nil {
+		log.Printf("Failed to load due federation deliveries: %v\n", err)
+		return
+	}
+
+	for i := range ds {
+		if err := DeliverActivity(db, client, &ds[i], now); err != nil {
+			log.Printf("Failed to store delivery %v: %v\n", ds[i].Id, err)
+		}
+	}
+}
+
+// RunFederationDispatcher delivers due activities with client every
+// interval.
+func RunFederationDispatcher(client FederationClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		db := NewDatabase()
+		DeliverActivities(db, client, now)
+		db.Close()
+	}
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// maxApiRequestSize is the largest request body the API reads.
+const maxApiRequestSize = 1 << 20
+
+// The API has its own types so that what it shows is decided here and not
+// by the core structs, which hold secrets like the password hash.
+
+type ApiUser struct {
+	Id        int        `json:"id"`
+	Login     string     `json:"login"`
+	Bio       string     `json:"bio,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// ApiProfile is a user as seen by the viewer of the profile.
+type ApiProfile struct {
+	ApiUser
+	Visible   bool `json:"visible"`
+	Followers int  `json:"followers"`
+	Following bool `json:"following"`
+}
+
+type ApiPost struct {
+	Id         int            `json:"id"`
+	Author     ApiUser        `json:"author"`
+	Content    string         `json:"content"`
+	Visibility string         `json:"visibility" enum:"visibility"`
+	RepostOf   int            `json:"repost_of,omitempty"`
+	Hidden     bool           `json:"hidden,omitempty"`
+	CreatedAt  *time.Time     `json:"created_at,omitempty"`
+	Likes      map[string]int `json:"likes"`
+}
+
+type ApiComment struct {
+	Id        int            `json:"id"`
+	PostId    int            `json:"post_id"`
+	ParentId  int            `json:"parent_id,omitempty"`
+	Author    ApiUser        `json:"author"`
+	Content   string         `json:"content"`
+	Hidden    bool           `json:"hidden,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	Likes     map[string]int `json:"likes"`
+}
+
+type ApiLike struct {
+	User ApiUser `json:"user"`
+	Kind string  `json:"kind" enum:"reaction"`
+}
+
+type ApiConversation struct {
+	Id           int        `json:"id"`
+	Title        string     `json:"title,omitempty"`
+	Members      []ApiUser  `json:"members"`
+	LastActivity *time.Time `json:"last_activity,omitempty"`
+	Unread       int        `json:"unread"`
+}
+
+type ApiMessage struct {
+	Id             int        `json:"id"`
+	ConversationId int        `json:"conversation_id"`
+	Author         ApiUser    `json:"author"`
+	Content        string     `json:"content"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+}
+
+type ApiToken struct {
+	Token string  `json:"token"`
+	User  ApiUser `json:"user"`
+}
+
+type ApiLoginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// Fields of requests left out with omitempty are optional, which is what
+// the OpenAPI document says of them.
+
+type ApiPostRequest struct {
+	Content    string `json:"content,omitempty"`
+	Visibility string `json:"visibility,omitempty" enum:"visibility"`
+	RepostOf   int    `json:"repost_of,omitempty"`
+}
+
+type ApiCommentRequest struct {
+	Content  string `json:"content"`
+	ParentId int    `json:"parent_id,omitempty"`
+}
+
+type ApiMessageRequest struct {
+	Content string `json:"content"`
+}
+
+type ApiLikeRequest struct {
+	Kind string `json:"kind,omitempty" enum:"reaction"`
+}
+
+// ApiError is the body of every failed API response, wrapped as
+// {"error": {...}}. Code is meant for programs, Message for people.
+type ApiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiTime leaves out times not known for rows stored before they were.
+func apiTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	t = t.UTC()
+	return &t
+}
+
+// NewApiUser shows u to viewer, the bio only if viewer may see the profile.
+func NewApiUser(u *core.User, viewer *core.User, db core.Database) ApiUser {
+	au := ApiUser{Id: u.Id, Login: u.Login, CreatedAt: apiTime(u.CreatedAt)}
+	if CanViewProfile(viewer, u, db) {
+		au.Bio = string(u.Bio)
+	}
+
+	return au
+}
+
+func NewApiProfile(u *core.User, viewer *core.User, db core.Database) (ApiProfile, error) {
+	ap := ApiProfile{ApiUser: NewApiUser(u, viewer, db), Visible: CanViewProfile(viewer, u, db)}
+
+	var err error
+	ap.Followers, err = db.CountFollowers(u)
+	if err == nil && viewer != nil {
+		ap.Following, err = db.IsFollowing(viewer, u)
+	}
+
+	return ap, err
+}
+
+func countLikes(ls []core.Like) map[string]int {
+	counts := map[string]int{}
+	for _, l := range ls {
+		counts[l.Kind]++
+	}
+
+	return counts
+}
+
+// NewApiPost shows p to viewer, who must be allowed to see it. Content of
+// hidden posts is shown only to moderators.
+func NewApiPost(p *core.Post, viewer *core.User, db core.Database) (ApiPost, error) {
+	ap := ApiPost{
+		Id:         p.Id,
+		Author:     NewApiUser(p.Author, viewer, db),
+		Content:    string(p.Content),
+		Visibility: p.Visibility.String(),
+		RepostOf:   p.RepostOfId,
+		Hidden:     p.Hidden,
+		CreatedAt:  apiTime(p.CreatedAt),
+	}
+
+	if p.Hidden && !Can(viewer, core.PermissionModerate) {
+		ap.Content = ""
+	}
+
+	ls, err := db.GetPostLikes(p)
+	ap.Likes = countLikes(ls)
+
+	return ap, err
+}
+
+// NewApiComment shows c to viewer, who must be allowed to see its post.
+func NewApiComment(c *core.Comment, viewer *core.User, db core.Database) (ApiComment, error) {
+	ac := ApiComment{
+		Id:        c.Id,
+		PostId:    c.CommentedPost.Id,
+		ParentId:  c.ParentId,
+		Author:    NewApiUser(c.Author, viewer, db),
+		Content:   string(c.Content),
+		Hidden:    c.Hidden,
+		CreatedAt: apiTime(c.CreatedAt),
+	}
+
+	if c.Hidden && !Can(viewer, core.PermissionModerate) {
+		ac.Content = ""
+	}
+
+	ls, err := db.GetCommentLikes(c)
+	ac.Likes = countLikes(ls)
+
+	return ac, err
+}
+
+// NewApiConversation shows c to viewer, who must be one of its members.
+func NewApiConversation(c *core.Conversation, viewer *core.User, db core.Database) ApiConversation {
+	ac := ApiConversation{
+		Id:           c.Id,
+		Title:        c.Title,
+		Members:      []ApiUser{},
+		LastActivity: apiTime(c.LastActivity),
+		Unread:       c.Unread,
+	}
+
+	for _, member := range c.Members {
+		ac.Members = append(ac.Members, NewApiUser(member.User, viewer, db))
+	}
+
+	return ac
+}
+
+func NewApiMessage(m *core.Message, viewer *core.User, db core.Database) ApiMessage {
+	return ApiMessage{
+		Id:             m.Id,
+		ConversationId: m.Conversation.Id,
+		Author:         NewApiUser(m.Author, viewer, db),
+		Content:        string(m.Content),
+		CreatedAt:      apiTime(m.CreatedAt),
+	}
+}
+
+// WriteApiData writes {"data": data} with status.
+func WriteApiData(w http.ResponseWriter, status int, data any) {
+	writeJson(w, status, map[string]any{"data": data})
+}
+
+// WriteApiPage writes {"data": data, "next_cursor": next}, next is left
+// out on the last page.
+func WriteApiPage(w http.ResponseWriter, data any, next string) {
+	page := map[string]any{"data": data}
+	if next != "" {
+		page["next_cursor"] = next
+	}
+
+	writeJson(w, http.StatusOK, page)
+}
+
+// WriteApiError writes {"error": {"code": code, "message": message}}.
+func WriteApiError(w http.ResponseWriter, status int, code string, message string) {
+	writeJson(w, status, map[string]any{"error": ApiError{Code: code, Message: message}})
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write JSON response: %v\n", err)
+	}
+}
+
+// ReadApiRequest decodes the JSON body of r into v, refusing unknown fields.
+func ReadApiRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxApiRequestSize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Invalid JSON request: %v", err)
+	}
+
+	return nil
+}
+
+// EncodeCursor turns the id a page ended at into an opaque cursor.
+func EncodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// DecodeCursor returns the id of cursor, or 0 for the empty cursor of the
+// first page.
+func DecodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid cursor %v", cursor)
+	}
+
+	id, err := strconv.Atoi(string(b))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("Invalid cursor %v", cursor)
+	}
+
+	return id, nil
+}
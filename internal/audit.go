@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// Audit appends an event of kind to the audit log. actor did it to target
+// over r, any of them may be nil. The audited action already happened, so
+// failures are only logged.
+func Audit(db core.Database, r *http.Request, kind core.AuditEventKind, actor *core.User, target *core.User, detail string) {
+	e := &core.AuditEvent{Kind: kind, Detail: detail}
+	if actor != nil {
+		e.ActorId, e.ActorLogin = actor.Id, actor.Login
+	}
+	if target != nil {
+		e.TargetId, e.TargetLogin = target.Id, target.Login
+	}
+	if r != nil {
+		e.Address, e.UserAgent = ClientAddress(r), r.UserAgent()
+	}
+
+	if err := db.AppendAuditEvent(e); err != nil {
+		log.Printf("Failed to audit %v of %v: %v\n", kind, e.ActorLogin, err)
+	}
+}
+
+// auditHash returns what Hash of e must be, an HMAC keyed from SALT.
+func auditHash(e *core.AuditEvent) string {
+	return Sign(SignAudit, e.HashedData())
+}
+
+// VerifyAuditLog walks the audit log and fails at the first event whose
+// hash or link to the event before it does not match. It returns how many
+// events were verified and the newest of them, or nil if there are none.
+// Dropping the newest events leaves a valid chain, so the head must also be
+// compared with one noted elsewhere.
+func VerifyAuditLog(db core.Database) (int, *core.AuditEvent, error) {
+	count, prevId, prevHash := 0, 0, ""
+
+	var head *core.AuditEvent
+	err := db.ForEachAuditEvent(func(e *core.AuditEvent) error {
+		switch {
+		case e.Id != prevId+1:
+			return fmt.Errorf("Audit event %v follows event %v", e.Id, prevId)
+		case e.PrevHash != prevHash:
+			return fmt.Errorf("Audit event %v is not chained to event %v", e.Id, prevId)
+		case e.Hash != auditHash(e):
+			return fmt.Errorf("Audit event %v does not match its hash", e.Id)
+		}
+
+		head = e
+		count, prevId, prevHash = count+1, e.Id, e.Hash
+		return nil
+	})
+
+	return count, head, err
+}
+
+// DescribeAuditHead tells which event is the head of the audit log, to be
+// noted elsewhere and compared on later checks.
+func DescribeAuditHead(head *core.AuditEvent) string {
+	if head == nil {
+		return "The audit log is empty"
+	}
+
+	return fmt.Sprintf("The newest audit event is %v with hash %v", head.Id, head.Hash)
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func TestAuditLogVerifies(t *testing.T) {
+	db := newTestDatabase(t)
+
+	count, head, err := VerifyAuditLog(db)
+	if err != nil || count != 0 || head != nil {
+		t.Fatalf("Empty log verified as %v events up to %+v: %v", count, head, err)
+	}
+
+	u := createTestUser(t, db, "alice")
+	for _, kind := range []core.AuditEventKind{core.AuditSignup, core.AuditLogin, core.AuditLogout} {
+		Audit(db, nil, kind, u, nil, "")
+	}
+
+	count, head, err = VerifyAuditLog(db)
+	if err != nil || count != 3 || head == nil || head.Id != 3 || head.Kind != core.AuditLogout {
+		t.Fatalf("Log verified as %v events up to %+v: %v", count, head, err)
+	}
+
+	// Without SALT the chain cannot be computed again.
+	t.Setenv("SALT", "another salt")
+	if _, _, err := VerifyAuditLog(db); err == nil {
+		t.Errorf("Log verified with another key")
+	}
+}
+
+// Whoever writes the database can recompute a plain hash, not the keyed one.
+func TestAuditLogRefusesRecomputedHashes(t *testing.T) {
+	db := newTestDatabase(t)
+
+	u := createTestUser(t, db, "alice")
+	Audit(db, nil, core.AuditLogin, u, nil, "")
+
+	impl := db.(*database).impl
+	if _, err := impl.Exec("DROP TRIGGER audit_log_no_update;"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, head, err := VerifyAuditLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head.ActorLogin = "mallory"
+	sum := sha256.Sum256([]byte(head.HashedData()))
+	if _, err := impl.Exec("UPDATE audit_log SET actor_login = ?, hash = ? WHERE id = ?;",
+		head.ActorLogin, hex.EncodeToString(sum[:]), head.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := VerifyAuditLog(db); err == nil {
+		t.Errorf("Log with a recomputed hash verified")
+	}
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// sessionTouchInterval is how stale the last use of a session may get
+// before it is stored again, so not every request writes to the database.
+const sessionTouchInterval = time.Minute
+
+// ClientAddress returns the IP address r came from.
+func ClientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// OpenSession logs u in on the client that sent r and returns the session
+// with its token.
+func OpenSession(r *http.Request, db core.Database, u *core.User) (*core.Session, string, error) {
+	s := &core.Session{User: u, Address: ClientAddress(r), UserAgent: r.UserAgent()}
+	if err := db.CreateSession(s); err != nil {
+		return nil, "", err
+	}
+
+	return s, MakeToken(u.Login, s.Id), nil
+}
+
+// StartSession logs u in on the browser that sent r.
+func StartSession(w http.ResponseWriter, r *http.Request, db core.Database, u *core.User) (*core.Session, error) {
+	s, token, err := OpenSession(r, db, u)
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "socnet_token", Value: token})
+	return s, nil
+}
+
+// GetSession returns the session identified by the socnet_token cookie of
+// r. Unlike GetCurrentUser it accepts users who must reset their password.
+func GetSession(r *http.Request, db core.Database) (*core.Session, error) {
+	tokenCookie, err := r.Cookie("socnet_token")
+	if err != nil || tokenCookie == nil {
+		return nil, fmt.Errorf("Missing token cookie: %v", err)
+	}
+
+	return loadTokenSession(tokenCookie.Value, db)
+}
+
+// loadTokenSession returns the session token logs in with if it is still
+// valid.
+func loadTokenSession(token string, db core.Database) (*core.Session, error) {
+	login, sessionId, err := VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := db.LoadSession(sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Revoked || s.User.Login != login {
+		return nil, fmt.Errorf("Session %v of %v is revoked", sessionId, login)
+	}
+
+	if s.User.Suspended {
+		return nil, fmt.Errorf("User %v is suspended", s.User.Id)
+	}
+
+	if time.Since(s.LastSeenAt) > sessionTouchInterval {
+		if err := db.TouchSession(s); err != nil {
+			log.Printf("Failed to touch session %v: %v\n", s.Id, err)
+		}
+	}
+
+	return s, nil
+}
+
+// GetCurrentUser returns the user identified by the socnet_token cookie of r.
+func GetCurrentUser(r *http.Request, db core.Database) (*core.User, error) {
+	s, err := GetSession(r, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.User.PasswordResetRequired {
+		return nil, fmt.Errorf("User %v must reset their password", s.User.Id)
+	}
+
+	return s.User, nil
+}
+
+// Bearer is who makes an API request, with either the token of a Session
+// or a personal access Token.
+type Bearer struct {
+	User    *core.User
+	Session *core.Session
+	Token   *core.AccessToken
+}
+
+// Allows tells whether the bearer may do what needs scope. Sessions may do
+// everything their user may.
+func (b *Bearer) Allows(scope core.Scope) bool {
+	return b.Token == nil || b.Token.Allows(scope)
+}
+
+// GetBearer returns the bearer of the token of the Authorization header of
+// r, or nil without error if r has no such header.
+func GetBearer(r *http.Request, db core.Database) (*Bearer, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, fmt.Errorf("Authorization is not a bearer token")
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	b := &Bearer{}
+	if isAccessTokenSecret(token) {
+		t, err := loadAccessToken(token, db)
+		if err != nil {
+			return nil, err
+		}
+
+		b.User, b.Token = t.User, t
+	} else {
+		s, err := loadTokenSession(token, db)
+		if err != nil {
+			return nil, err
+		}
+
+		b.User, b.Session = s.User, s
+	}
+
+	if b.User.PasswordResetRequired {
+		return nil, fmt.Errorf("User %v must reset their password", b.User.Id)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	digestNotificationCount = 100
+)
+
+// SiteUrl is the address of the site as seen from outside, used in emails.
+func SiteUrl() string {
+	siteUrl := os.Getenv("SITE_URL")
+	if siteUrl == "" {
+		siteUrl = "http://localhost"
+	}
+
+	return strings.TrimSuffix(siteUrl, "/")
+}
+
+func UnsubscribeSignature(u *core.User) string {
+	return Sign(SignUnsubscribe, fmt.Sprint(u.Id))
+}
+
+func VerifyUnsubscribeSignature(u *core.User, signature string) bool {
+	return VerifySignature(SignUnsubscribe, fmt.Sprint(u.Id), signature)
+}
+
+func UnsubscribeUrl(u *core.User) string {
+	return fmt.Sprintf("%v/unsubscribe?user=%v&sig=%v", SiteUrl(), u.Id, UnsubscribeSignature(u))
+}
+
+// BuildDigest returns the digest mail of the notifications in ns that are
+// unread and newer than since, or nil if there are none.
+func BuildDigest(u *core.User, ns []core.Notification, since time.Time) *core.Mail {
+	body := &strings.Builder{}
+
+	count := 0
+	for i := range ns {
+		n := &ns[i]
+		if n.Read || n.CreatedAt.Before(since) {
+			continue
+		}
+
+		count++
+		fmt.Fprintf(body, "* %v (%v)\n  %v%v\n\n", NotificationText(n), n.CreatedAt.Format(timeLayout), SiteUrl(), NotificationLink(n))
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	unsubscribeUrl := UnsubscribeUrl(u)
+	fmt.Fprintf(body, "You get this %v digest because you asked for it in your settings.\n", u.DigestFrequency)
+	fmt.Fprintf(body, "Unsubscribe: %v\n", unsubscribeUrl)
+
+	return &core.Mail{
+		To:      u.Email,
+		Subject: fmt.Sprintf("socnet: %v unread notifications", count),
+		Headers: map[string]string{"List-Unsubscribe": "<" + unsubscribeUrl + ">"},
+		Body:    []byte(body.String()),
+	}
+}
+
+func sendDigests(db core.Database, mailer core.Mailer, now time.Time) {
+	for _, f := range core.DigestFrequencies {
+		if f == core.DigestNever {
+			continue
+		}
+
+		since := now.Add(-f.Period())
+
+		us, err := db.GetDueDigestUsers(f, since)
+		if err != nil {
+			log.Printf("Failed to list users due a %v digest: %v\n", f, err)
+			continue
+		}
+
+		for i := range us {
+			u := &us[i]
+
+			ns, err := db.GetNotifications(u, digestNotificationCount)
+			if err != nil {
+				log.Printf("Failed to load notifications of %v: %v\n", u.Id, err)
+				continue
+			}
+
+			if mail := BuildDigest(u, ns, since); mail != nil {
+				err = mailer.Send(mail)
+				if err != nil {
+					log.Printf("Failed to mail digest to %v: %v\n", u.Id, err)
+					continue
+				}
+
+				log.Printf("Mailed %v digest to user %v\n", f, u.Id)
+			}
+
+			err = db.MarkDigestSent(u, now)
+			if err != nil {
+				log.Printf("Failed to mark digest of %v sent: %v\n", u.Id, err)
+			}
+		}
+	}
+}
+
+// RunDigestScheduler checks every interval for users due a digest and mails
+// them their unread notifications. It never returns.
+func RunDigestScheduler(mailer core.Mailer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		db := NewDatabase()
+		sendDigests(db, mailer, now)
+		db.Close()
+	}
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	// FeedPostCount is how many of the newest posts a feed lists.
+	FeedPostCount = 50
+	// feedTitleLength is how many characters of a post make its title.
+	feedTitleLength = 80
+)
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Id        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Link      atomLink   `xml:"link"`
+	Author    atomPerson `xml:"author"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Base    string      `xml:"xml:base,attr"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// Feed is a rendered Atom feed, Updated is when its newest post was written
+// and zero for an empty feed.
+type Feed struct {
+	Body    []byte
+	Updated time.Time
+}
+
+func feedTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// feedTitle is the first line of content, shortened to feedTitleLength.
+func feedTitle(content []byte) string {
+	title := strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0])
+
+	runes := []rune(title)
+	if len(runes) > feedTitleLength {
+		title = string(runes[:feedTitleLength]) + "…"
+	}
+
+	return title
+}
+
+// IsFeedPost tells whether p may appear in feeds: feeds are read by anyone,
+// so only public posts not hidden by moderators are listed. GetFeedPosts
+// lists the same posts in SQL.
+func IsFeedPost(p *core.Post, db core.Database) bool {
+	return p.Visibility == core.VisibilityPublic && !p.Hidden && CanViewPost(nil, p, db)
+}
+
+// feedContent is the HTML of p shown to readers elsewhere, its links are
+// relative to SiteUrl.
+func feedContent(p *core.Post, db core.Database) string {
+	content := ""
+	if !p.IsPlainRepost() {
+		content = `<pre>` + RenderPostContent(p, db) + `</pre>`
+	}
+
+	if p.RepostOfId != 0 {
+		content += fmt.Sprintf(`<p>Reposted <a href="/post?id=%v">post %v</a></p>`, p.RepostOfId, p.RepostOfId)
+	}
+
+	return content
+}
+
+func newAtomEntry(p *core.Post, db core.Database) atomEntry {
+	postUrl := fmt.Sprintf("%v/post?id=%v", SiteUrl(), p.Id)
+
+	title := feedTitle(p.Content)
+	if p.IsPlainRepost() {
+		title = fmt.Sprintf("Reposted post %v", p.RepostOfId)
+	}
+
+	if title == "" {
+		title = fmt.Sprintf("Post %v", p.Id)
+	}
+
+	return atomEntry{
+		Id:    postUrl,
+		Title: title,
+		Link:  atomLink{Rel: "alternate", Type: "text/html", Href: postUrl},
+		Author: atomPerson{
+			Name: p.Author.Login,
+			Uri:  fmt.Sprintf("%v/user?id=%v", SiteUrl(), p.Author.Id),
+		},
+		Published: feedTime(p.CreatedAt),
+		Updated:   feedTime(p.CreatedAt),
+		Content:   atomText{Type: "html", Body: feedContent(p, db)},
+	}
+}
+
+// BuildFeed renders ps, which GetFeedPosts lists. path is where the feed is
+// served and htmlPath the page it follows, both relative to SiteUrl.
+func BuildFeed(title string, path string, htmlPath string, ps []core.Post, db core.Database) (*Feed, error) {
+	f := &Feed{}
+	for i := range ps {
+		if ps[i].CreatedAt.After(f.Updated) {
+			f.Updated = ps[i].CreatedAt
+		}
+	}
+
+	feed := atomFeed{
+		Base:  SiteUrl() + "/",
+		Id:    SiteUrl() + path,
+		Title: title,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: SiteUrl() + path},
+			{Rel: "alternate", Type: "text/html", Href: SiteUrl() + htmlPath},
+		},
+		Updated: feedTime(f.Updated),
+	}
+	if f.Updated.IsZero() {
+		feed.Updated = feedTime(time.Unix(0, 0))
+	}
+
+	for i := range ps {
+		feed.Entries = append(feed.Entries, newAtomEntry(&ps[i], db))
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to render feed %v due to %v\n", path, err)
+	}
+
+	f.Body = append([]byte(xml.Header), body...)
+	return f, nil
+}
+
+// ServeFeed writes f answering conditional requests by its ETag, a hash of
+// the feed. There is no Last-Modified: the newest post is not when the feed
+// last changed, edits, deletions and hidden posts change it too.
+func ServeFeed(w http.ResponseWriter, r *http.Request, f *Feed) {
+	sum := sha256.Sum256(f.Body)
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(f.Body))
+}
@@ -1,6 +1,9 @@
 package internal
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
@@ -41,32 +44,64 @@ func GetHash(password []byte) uint64 {
 	return h
 }
 
-// TODO: use JWT
-func MakeToken(login string) string {
-	loginBytes := []byte(login)
-	return fmt.Sprintf("%v:%v", login, GetHash(loginBytes))
+// MakeToken returns the cookie value logging login in with session
+// sessionId, it is login:sessionId:signature.
+func MakeToken(login string, sessionId int) string {
+	data := fmt.Sprintf("%v:%v", login, sessionId)
+	return fmt.Sprintf("%v:%v", data, Sign(SignSession, data))
 }
 
-func VerifyToken(token string) (string, error) {
-	i := strings.Index(token, ":")
+// VerifyToken returns the login and the session id of token.
+func VerifyToken(token string) (string, int, error) {
+	i := strings.LastIndex(token, ":")
 	if i < 0 {
-		return "", fmt.Errorf("Failed to find ':'")
+		return "", 0, fmt.Errorf("Failed to find ':'")
 	}
 
-	login := token[:i]
-	if len(login) == 0 {
-		return "", fmt.Errorf("Login is empty")
+	data := token[:i]
+	if !VerifySignature(SignSession, data, token[i+1:]) {
+		return "", 0, fmt.Errorf("Token and signature do not match")
 	}
 
-	h, err := strconv.ParseUint(token[i+1:], 10, 64)
+	j := strings.LastIndex(data, ":")
+	if j <= 0 {
+		return "", 0, fmt.Errorf("Login is empty")
+	}
+
+	sessionId, err := strconv.Atoi(data[j+1:])
 	if err != nil {
-		return "", fmt.Errorf("Failed to parse hash: %v", err)
+		return "", 0, fmt.Errorf("Failed to parse session id: %v", err)
 	}
 
-	loginBytes := []byte(login)
-	if GetHash(loginBytes) != h {
-		return "", fmt.Errorf("Login and hash do not match")
+	return data[:j], sessionId, nil
+}
+
+// SignPurpose is what a signature is for. Each purpose signs with its own
+// key, so that a signature made for one is never accepted for another.
+type SignPurpose string
+
+const (
+	SignSession     SignPurpose = "session"
+	SignUnsubscribe SignPurpose = "unsubscribe"
+	SignAudit       SignPurpose = "audit"
+)
+
+// Sign returns an HMAC of data for purpose, keyed by a key derived from
+// SALT, for tokens and links that must not be forged.
+func Sign(purpose SignPurpose, data string) string {
+	salt := []byte(os.Getenv("SALT"))
+	if len(salt) == 0 {
+		log.Fatalf("SALT is empty\n")
 	}
 
-	return login, nil
+	key := hmac.New(sha256.New, salt)
+	key.Write([]byte(purpose))
+
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(purpose SignPurpose, data string, signature string) bool {
+	return hmac.Equal([]byte(Sign(purpose, data)), []byte(signature))
 }
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// A session cookie of the user named unsubscribe must not be an
+// unsubscribe link for the user with the id of the session.
+func TestSignaturesAreBoundToPurpose(t *testing.T) {
+	t.Setenv("SALT", "salt")
+
+	token := MakeToken("unsubscribe", 5)
+	signature := token[strings.LastIndex(token, ":")+1:]
+
+	if VerifyUnsubscribeSignature(&core.User{Id: 5}, signature) {
+		t.Errorf("Session token %v unsubscribes user 5", token)
+	}
+
+	if !VerifyUnsubscribeSignature(&core.User{Id: 5}, UnsubscribeSignature(&core.User{Id: 5})) {
+		t.Errorf("Unsubscribe signature of user 5 does not verify")
+	}
+
+	if login, id, err := VerifyToken(token); err != nil || login != "unsubscribe" || id != 5 {
+		t.Errorf("Token %v verifies as %v %v: %v", token, login, id, err)
+	}
+}
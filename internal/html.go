@@ -6,9 +6,16 @@ import (
 	"golang.org/x/net/html"
 	"io"
 	"log"
+	"net/http"
 	"strings"
 )
 
+const (
+	// maxCommentDepth is how deep a comment thread is nested before it
+	// continues on a page of its own.
+	maxCommentDepth = 4
+)
+
 func WriteErrorString(w io.Writer, s string) {
 	io.WriteString(w, `<h1 class="error">`)
 	io.WriteString(w, s)
@@ -21,35 +28,66 @@ func WriteMessageString(w io.Writer, s string) {
 	io.WriteString(w, `</h1>`)
 }
 
-func WriteHeaderFooterContent(w io.Writer) {
+func WriteNotLoggedIn(w io.Writer) {
+	WriteErrorString(w, "You are not logged in")
+	io.WriteString(w, `<p class="error">Please visit <a href="/signup">sign up</a> or <a href="/login">log in</a> page</p>`)
+}
+
+func UserLink(u *core.User) string {
+	return fmt.Sprintf(`<a href="/user?id=%v">%v</a>`, u.Id, html.EscapeString(u.Login))
+}
+
+// WriteHeaderFooterContent writes the navigation, unread is the number of
+// unread notifications to show next to the notifications link.
+func WriteHeaderFooterContent(w io.Writer, unread int) {
 	io.WriteString(w, `<nav>`)
 	io.WriteString(w, `<a href="/newsfeed"> News Feed </a>`)
 	io.WriteString(w, `<a href="/homepage"> Home Page </a>`)
+	io.WriteString(w, `<a href="/friend_requests/incoming"> Friends </a>`)
+	io.WriteString(w, `<a href="/inbox"> Inbox </a>`)
+	io.WriteString(w, `<a href="/search"> Search </a>`)
+	io.WriteString(w, `<a href="/trending"> Trending </a>`)
+	if unread > 0 {
+		fmt.Fprintf(w, `<a href="/notifications"> Notifications <b>(%v)</b> </a>`, unread)
+	} else {
+		io.WriteString(w, `<a href="/notifications"> Notifications </a>`)
+	}
+	io.WriteString(w, `<a href="/bookmarks"> Bookmarks </a>`)
+	io.WriteString(w, `<a href="/settings"> Settings </a>`)
 	io.WriteString(w, `<a href="/login"> Login </a>`)
 	io.WriteString(w, `<a href="/signup"> Sign Up </a>`)
 	io.WriteString(w, `</nav>`)
 }
 
-func WriteHeader(w io.Writer) {
+func WriteHeader(w io.Writer, unread int) {
 	io.WriteString(w, `<header>`)
-	WriteHeaderFooterContent(w)
+	WriteHeaderFooterContent(w, unread)
 	io.WriteString(w, `</header>`)
 }
 
 func WriteFooter(w io.Writer) {
 	io.WriteString(w, `<footer>`)
-	WriteHeaderFooterContent(w)
+	WriteHeaderFooterContent(w, 0)
 	io.WriteString(w, `</footer>`)
 }
 
-func BeginHtml(w io.Writer) {
+// BeginHtml starts a page for the user who sent r, if any.
+func BeginHtml(w io.Writer, r *http.Request, db core.Database) {
+	unread := 0
+	if u, err := GetCurrentUser(r, db); err == nil {
+		unread, err = db.CountUnreadNotifications(u)
+		if err != nil {
+			log.Printf("Failed to count unread notifications of %v: %v\n", u.Id, err)
+		}
+	}
+
 	io.WriteString(w, `<!DOCTYPE HTML>`)
 	io.WriteString(w, `<html>`)
 	io.WriteString(w, `    <head>`)
 	io.WriteString(w, `        <link rel="stylesheet" type="text/css" href="style.css">`)
 	io.WriteString(w, `    </head>`)
 	io.WriteString(w, `    <body>`)
-	WriteHeader(w)
+	WriteHeader(w, unread)
 }
 
 func EndHtml(w io.Writer) {
@@ -58,7 +96,129 @@ func EndHtml(w io.Writer) {
 	io.WriteString(w, `</html>`)
 }
 
-func RenderUser(u *core.User, db core.Database) (string, error) {
+// VisibilitySelect renders a <select> listing every visibility with selected preselected.
+func VisibilitySelect(name string, selected core.Visibility) string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, `<select id="%v" name="%v">`, name, name)
+	for _, v := range core.Visibilities {
+		if v == selected {
+			fmt.Fprintf(builder, `<option value="%v" selected>%v</option>`, v, v)
+		} else {
+			fmt.Fprintf(builder, `<option value="%v">%v</option>`, v, v)
+		}
+	}
+	builder.WriteString(`</select>`)
+
+	return builder.String()
+}
+
+func renderFollowing(builder *strings.Builder, u *core.User, viewer *core.User, db core.Database) error {
+	followers, err := db.CountFollowers(u)
+	if err != nil {
+		return err
+	}
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Followers</td>`)
+	fmt.Fprintf(builder, `<td>%v`, followers)
+
+	if viewer != nil && viewer.Id != u.Id {
+		following, err := db.IsFollowing(viewer, u)
+		if err != nil {
+			return err
+		}
+
+		if following {
+			fmt.Fprintf(builder, `<form action="/do_unfollow?id=%v" method="POST"><input type="submit" value="Unfollow"></input></form>`, u.Id)
+		} else {
+			fmt.Fprintf(builder, `<form action="/do_follow?id=%v" method="POST"><input type="submit" value="Follow"></input></form>`, u.Id)
+		}
+
+		if CanMessage(viewer, u, db) {
+			builder.WriteString(`<form action="/do_new_conversation" method="POST">`)
+			fmt.Fprintf(builder, `<input type="hidden" name="logins" value="%v"></input>`, html.EscapeString(u.Login))
+			builder.WriteString(`<input type="submit" value="Send message"></input>`)
+			builder.WriteString(`</form>`)
+		}
+	}
+
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+
+	return nil
+}
+
+func renderFriendship(builder *strings.Builder, u *core.User, viewer *core.User, db core.Database) error {
+	if viewer != nil && viewer.Id != u.Id {
+		mutual, err := db.CountMutualFriends(u, viewer)
+		if err != nil {
+			return err
+		}
+
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Mutual friends</td>`)
+		fmt.Fprintf(builder, `<td>%v</td>`, mutual)
+		builder.WriteString(`</tr>`)
+
+		fr, err := db.FindFriendRequest(viewer, u)
+		if err != nil {
+			return err
+		}
+
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Friendship</td>`)
+		builder.WriteString(`<td>`)
+		switch {
+		case fr == nil:
+			fmt.Fprintf(builder, `<form action="/do_friend_request?id=%v" method="POST"><input type="submit" value="Add friend"></input></form>`, u.Id)
+		case fr.Status == core.FriendRequestAccepted:
+			builder.WriteString(`You are friends`)
+			writeFriendRequestForm(builder, fr, core.FriendRequestCancelled, "Unfriend")
+		case fr.From.Id == viewer.Id:
+			builder.WriteString(`Friend request sent`)
+			writeFriendRequestForm(builder, fr, core.FriendRequestCancelled, "Cancel request")
+		default:
+			builder.WriteString(`Wants to be your friend`)
+			writeFriendRequestForm(builder, fr, core.FriendRequestAccepted, "Accept")
+			writeFriendRequestForm(builder, fr, core.FriendRequestDeclined, "Decline")
+		}
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	if !CanViewProfile(viewer, u, db) {
+		return nil
+	}
+
+	friends, err := db.GetFriends(u)
+	if err != nil {
+		return err
+	}
+
+	builder.WriteString(`<tr>`)
+	fmt.Fprintf(builder, `<td class="rowname">Friends (%v)</td>`, len(friends))
+	builder.WriteString(`<td>`)
+	for i := range friends {
+		if i > 0 {
+			builder.WriteString(`, `)
+		}
+		builder.WriteString(UserLink(&friends[i]))
+	}
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+
+	return nil
+}
+
+func writeFriendRequestForm(builder *strings.Builder, fr *core.FriendRequest, status core.FriendRequestStatus, label string) {
+	fmt.Fprintf(builder, `<form action="/do_update_friend_request?id=%v" method="POST">`, fr.Id)
+	fmt.Fprintf(builder, `<input type="hidden" name="status" value="%v"></input>`, status)
+	fmt.Fprintf(builder, `<input type="submit" value="%v"></input>`, label)
+	builder.WriteString(`</form>`)
+}
+
+func RenderUser(u *core.User, viewer *core.User, db core.Database) (string, error) {
 	builder := &strings.Builder{}
 
 	builder.WriteString(`<table>`)
@@ -68,12 +228,48 @@ func RenderUser(u *core.User, db core.Database) (string, error) {
 	fmt.Fprintf(builder, `<td>%v</td>`, html.EscapeString(u.Login))
 	builder.WriteString(`</tr>`)
 
-	builder.WriteString(`<tr>`)
-	builder.WriteString(`<td class="rowname">Bio</td>`)
-	fmt.Fprintf(builder, `<td>%v</td>`, html.EscapeString(string(u.Bio)))
-	builder.WriteString(`</tr>`)
+	visible := CanViewProfile(viewer, u, db)
+	if u.Suspended {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Account</td>`)
+		builder.WriteString(`<td>This account is suspended</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	if visible {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Bio</td>`)
+		fmt.Fprintf(builder, `<td>%v</td>`, html.EscapeString(string(u.Bio)))
+		builder.WriteString(`</tr>`)
+	} else {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Profile</td>`)
+		builder.WriteString(`<td>This profile is private</td>`)
+		builder.WriteString(`</tr>`)
+	}
 
-	ps, err := db.GetPostsByUser(u)
+	err := renderFollowing(builder, u, viewer, db)
+	if err != nil {
+		return "", err
+	}
+
+	err = renderFriendship(builder, u, viewer, db)
+	if err != nil {
+		return "", err
+	}
+
+	renderBlocking(builder, u, viewer, db)
+
+	if CanViewProfile(nil, u, db) {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Feed</td>`)
+		fmt.Fprintf(builder, `<td><a href="/user/%v/feed.atom">Atom feed</a></td>`, u.Id)
+		builder.WriteString(`</tr>`)
+
+		renderFediverse(builder, u, db)
+	}
+
+	ps, err := db.GetPostsByUser(viewer, u)
 	if err != nil || ps == nil {
 		return "", err
 	}
@@ -81,7 +277,13 @@ func RenderUser(u *core.User, db core.Database) (string, error) {
 	for _, p := range ps {
 		builder.WriteString(`<tr>`)
 		fmt.Fprintf(builder, `<td class="rowname"><a href="/post?id=%v">Post link</a></td>`, p.Id)
-		fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td>`, html.EscapeString(string(p.Content)))
+		if p.IsPlainRepost() {
+			fmt.Fprintf(builder, `<td>Reposted <a href="/post?id=%v">post %v</a></td>`, p.RepostOfId, p.RepostOfId)
+		} else if p.Hidden && !Can(viewer, core.PermissionModerate) {
+			builder.WriteString(`<td>This post was hidden by a moderator</td>`)
+		} else {
+			fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td>`, RenderPostContent(&p, db))
+		}
 		builder.WriteString(`</tr>`)
 	}
 
@@ -90,31 +292,219 @@ func RenderUser(u *core.User, db core.Database) (string, error) {
 	return builder.String(), nil
 }
 
-func RenderUserByLogin(login string, db core.Database) (string, error) {
+func RenderUserByLogin(login string, viewer *core.User, db core.Database) (string, error) {
 	u, err := db.FindUser(login)
 	if err != nil {
 		return "", fmt.Errorf("Failed to find user: login=%v, err=%v\n", login, err)
 	}
 
-	html, err := RenderUser(u, db)
+	html, err := RenderUser(u, viewer, db)
 	return html, err
 }
 
-func RenderUserById(id int, db core.Database) (string, error) {
+func RenderUserById(id int, viewer *core.User, db core.Database) (string, error) {
 	u, err := db.LoadUser(id)
 	if err != nil {
 		return "", fmt.Errorf("Failed to find user: id=%v, err=%v\n", id, err)
 	}
 
-	html, err := RenderUser(u, db)
+	html, err := RenderUser(u, viewer, db)
 	return html, err
 }
 
-func RenderPost(p *core.Post, db core.Database) (string, error) {
+// RenderFriendRequests renders pending requests; incoming selects whether
+// the viewer is their recipient (accept/decline) or sender (cancel).
+func RenderFriendRequests(frs []core.FriendRequest, incoming bool) string {
 	builder := &strings.Builder{}
 
 	builder.WriteString(`<table>`)
 
+	if len(frs) == 0 {
+		builder.WriteString(`<tr><td>No pending friend requests</td></tr>`)
+	}
+
+	for i := range frs {
+		fr := &frs[i]
+
+		builder.WriteString(`<tr>`)
+		if incoming {
+			fmt.Fprintf(builder, `<td class="rowname">From %v</td>`, UserLink(fr.From))
+			builder.WriteString(`<td>`)
+			writeFriendRequestForm(builder, fr, core.FriendRequestAccepted, "Accept")
+			writeFriendRequestForm(builder, fr, core.FriendRequestDeclined, "Decline")
+			builder.WriteString(`</td>`)
+		} else {
+			fmt.Fprintf(builder, `<td class="rowname">To %v</td>`, UserLink(fr.To))
+			builder.WriteString(`<td>`)
+			writeFriendRequestForm(builder, fr, core.FriendRequestCancelled, "Cancel")
+			builder.WriteString(`</td>`)
+		}
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// loadRepostOriginal loads the post shared by p, when it is gone or hidden
+// from viewer a placeholder text is returned instead.
+func loadRepostOriginal(p *core.Post, viewer *core.User, db core.Database) (*core.Post, string) {
+	original, err := db.LoadPost(p.RepostOfId)
+	if err != nil {
+		log.Printf("Failed to load original %v of post %v: %v\n", p.RepostOfId, p.Id, err)
+		return nil, "The original post was deleted"
+	}
+
+	if !CanViewPost(viewer, original, db) {
+		return nil, "The original post is not available"
+	}
+
+	if Hides(viewer, original.Author, db) {
+		return nil, "The original post is by a user you blocked or muted"
+	}
+
+	if original.Hidden && !Can(viewer, core.PermissionModerate) {
+		return nil, "The original post was hidden by a moderator"
+	}
+
+	return original, ""
+}
+
+// renderQuotedPost renders the original of a quote inline, without comments
+// and without further nesting of quotes.
+func renderQuotedPost(builder *strings.Builder, p *core.Post, viewer *core.User, db core.Database) {
+	original, placeholder := loadRepostOriginal(p, viewer, db)
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Quoting</td>`)
+	if original == nil {
+		fmt.Fprintf(builder, `<td class="quote">%v</td>`, placeholder)
+	} else {
+		builder.WriteString(`<td class="quote">`)
+		fmt.Fprintf(builder, `%v in <a href="/post?id=%v">post %v</a>`, UserLink(original.Author), original.Id, original.Id)
+		fmt.Fprintf(builder, `<code><pre>%v</pre></code>`, RenderPostContent(original, db))
+		if original.RepostOfId != 0 {
+			fmt.Fprintf(builder, `<a href="/post?id=%v">Quoted post</a>`, original.RepostOfId)
+		}
+		builder.WriteString(`</td>`)
+	}
+	builder.WriteString(`</tr>`)
+}
+
+// renderReposting renders the share count of p and, for logged in viewers,
+// the form reposting or quoting it.
+func renderReposting(builder *strings.Builder, p *core.Post, viewer *core.User, db core.Database) {
+	count, err := db.CountReposts(p)
+	if err != nil {
+		log.Printf("Failed to count reposts of %v: %v\n", p.Id, err)
+	}
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Shares</td>`)
+	fmt.Fprintf(builder, `<td>Shared %v times`, count)
+	if viewer != nil {
+		builder.WriteString(`<details><summary>Repost</summary>`)
+		fmt.Fprintf(builder, `<form action="/do_repost?id=%v" method="POST">`, p.Id)
+		builder.WriteString(`<textarea name="quoteContent" rows="2" cols="30" placeholder="Add a comment to quote the post"></textarea>`)
+		builder.WriteString(VisibilitySelect("visibility", core.VisibilityPublic))
+		builder.WriteString(`<input type="submit" value="Repost"></input>`)
+		builder.WriteString(`</form>`)
+		builder.WriteString(`</details>`)
+	}
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+}
+
+func renderEditPost(builder *strings.Builder, p *core.Post, viewer *core.User) {
+	if viewer == nil || viewer.Id != p.Author.Id {
+		return
+	}
+
+	builder.WriteString(`<details><summary>Edit</summary>`)
+	fmt.Fprintf(builder, `<form action="/do_edit_post?id=%v" method="POST">`, p.Id)
+	fmt.Fprintf(builder, `<textarea name="postContent" rows="4" cols="40">%v</textarea>`, html.EscapeString(string(p.Content)))
+	builder.WriteString(`<input type="submit" value="Save"></input>`)
+	builder.WriteString(`</form>`)
+	builder.WriteString(`</details>`)
+}
+
+func renderDeletePost(builder *strings.Builder, p *core.Post, viewer *core.User) {
+	if viewer == nil || viewer.Id != p.Author.Id {
+		return
+	}
+
+	fmt.Fprintf(builder, `<form action="/do_delete_post?id=%v" method="POST">`, p.Id)
+	builder.WriteString(`<input type="submit" value="Delete"></input>`)
+	builder.WriteString(`</form>`)
+}
+
+// renderPlainRepost renders an "X reposted" header followed by the shared
+// post itself, so reactions and comments go to the original.
+func renderPlainRepost(p *core.Post, threadId int, viewer *core.User, db core.Database) (string, error) {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<table class="repost">`)
+	builder.WriteString(`<tr>`)
+	fmt.Fprintf(builder, `<td class="rowname"><a href="/post?id=%v">Repost</a></td>`, p.Id)
+	fmt.Fprintf(builder, `<td>%v reposted`, UserLink(p.Author))
+	renderDeletePost(builder, p, viewer)
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+
+	original, placeholder := loadRepostOriginal(p, viewer, db)
+	if original == nil {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname"></td>`)
+		fmt.Fprintf(builder, `<td>%v</td>`, placeholder)
+		builder.WriteString(`</tr>`)
+	}
+	builder.WriteString(`</table>`)
+
+	if original != nil {
+		html, err := RenderPostThread(original, threadId, viewer, db)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(html)
+	}
+
+	return builder.String(), nil
+}
+
+// RenderPostThread renders p with its comments; if threadId is not 0 only
+// the subtree of that comment is shown.
+func RenderPostThread(p *core.Post, threadId int, viewer *core.User, db core.Database) (string, error) {
+	if !CanViewPost(viewer, p, db) {
+		return "", fmt.Errorf("Post %v is not visible to the viewer\n", p.Id)
+	}
+
+	if p.IsPlainRepost() {
+		return renderPlainRepost(p, threadId, viewer, db)
+	}
+
+	builder := &strings.Builder{}
+
+	if p.Hidden && !Can(viewer, core.PermissionModerate) {
+		builder.WriteString(`<table>`)
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname"><a href="/post?id=%v">Post %v</a></td>`, p.Id, p.Id)
+		builder.WriteString(`<td>This post was hidden by a moderator</td>`)
+		builder.WriteString(`</tr>`)
+		builder.WriteString(`</table>`)
+
+		return builder.String(), nil
+	}
+
+	builder.WriteString(`<table>`)
+
+	if p.Hidden {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Moderation</td>`)
+		builder.WriteString(`<td>Hidden from everyone but moderators</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
 	builder.WriteString(`<tr>`)
 	builder.WriteString(`<td class="rowname">Author</td>`)
 	fmt.Fprintf(builder, `<td><a href="/user?id=%v">%v</a></td>`, p.Author.Id, html.EscapeString(p.Author.Login))
@@ -125,21 +515,75 @@ func RenderPost(p *core.Post, db core.Database) (string, error) {
 	fmt.Fprintf(builder, `<td><a href="/post?id=%v">Post %v</a></td>`, p.Id, p.Id)
 	builder.WriteString(`</tr>`)
 
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Visible to</td>`)
+	if viewer != nil && viewer.Id == p.Author.Id {
+		fmt.Fprintf(builder, `<td><form action="/do_post_visibility?id=%v" method="POST">`, p.Id)
+		builder.WriteString(VisibilitySelect("visibility", p.Visibility))
+		builder.WriteString(`<input type="submit" value="Change"></input></form></td>`)
+	} else {
+		fmt.Fprintf(builder, `<td>%v</td>`, p.Visibility)
+	}
+	builder.WriteString(`</tr>`)
+
 	builder.WriteString(`<tr>`)
 	builder.WriteString(`<td class="rowname">Content</td>`)
-	fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td>`, html.EscapeString(string(p.Content)))
+	fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code>`, RenderPostContent(p, db))
+	renderEditPost(builder, p, viewer)
+	renderDeletePost(builder, p, viewer)
+	builder.WriteString(`</td>`)
 	builder.WriteString(`</tr>`)
 
+	if p.RepostOfId != 0 {
+		renderQuotedPost(builder, p, viewer, db)
+	}
+
+	renderReposting(builder, p, viewer, db)
+	renderBookmark(builder, p, viewer, db)
+
+	if viewer != nil && viewer.Id != p.Author.Id {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Report</td>`)
+		builder.WriteString(`<td>`)
+		renderReportForm(builder, fmt.Sprintf("post=%v", p.Id))
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	ls, err := db.GetPostLikes(p)
+	if err != nil {
+		log.Printf("Failed to get reactions in RenderPost: %v\n", err)
+	}
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Reactions</td>`)
+	builder.WriteString(`<td>`)
+	renderReactions(builder, ls, fmt.Sprintf("post=%v", p.Id), viewer)
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+
+	renderRemoteReplies(builder, p, db)
+
 	cs, err := db.GetCommentsByPost(p)
 	if err != nil {
 		log.Printf("Failed to get comments in RenderPost: %v\n", err)
 	}
 
-	for _, c := range cs {
-		builder.WriteString(`<tr>`)
-		fmt.Fprintf(builder, `<td class="rowname">Comment by <a href="/user?id=%v">%v</a></td>`, c.Author.Id, html.EscapeString(c.Author.Login))
-		fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td`, html.EscapeString(string(c.Content)))
-		builder.WriteString(`</tr>`)
+	replies := map[int][]*core.Comment{}
+	for i := range cs {
+		replies[cs[i].ParentId] = append(replies[cs[i].ParentId], &cs[i])
+	}
+
+	if threadId == 0 {
+		for _, c := range replies[0] {
+			renderCommentTree(builder, c, replies, 0, viewer, db)
+		}
+	} else {
+		for i := range cs {
+			if cs[i].Id == threadId {
+				renderCommentTree(builder, &cs[i], replies, 0, viewer, db)
+			}
+		}
 	}
 
 	builder.WriteString(`</table>`)
@@ -147,12 +591,134 @@ func RenderPost(p *core.Post, db core.Database) (string, error) {
 	return builder.String(), nil
 }
 
-func RenderPostById(id int, db core.Database) (string, error) {
+func RenderPost(p *core.Post, viewer *core.User, db core.Database) (string, error) {
+	return RenderPostThread(p, 0, viewer, db)
+}
+
+// RenderCommentForm renders a form commenting post postId, parentId is the
+// comment being replied to or 0.
+func RenderCommentForm(postId int, parentId int) string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, `<form action="/do_comment?id=%v&parent=%v" method="POST">`, postId, parentId)
+	builder.WriteString(`<textarea name="commentContent" rows="1" cols="30"></textarea>`)
+	if parentId == 0 {
+		builder.WriteString(`<input type="submit" value="Leave comment"></input>`)
+	} else {
+		builder.WriteString(`<input type="submit" value="Reply"></input>`)
+	}
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
+
+func renderCommentTree(builder *strings.Builder, c *core.Comment, replies map[int][]*core.Comment, depth int, viewer *core.User, db core.Database) {
+	// Replies stay visible, so a comment not shown leaves a placeholder.
+	placeholder := ""
+	switch {
+	case Can(viewer, core.PermissionModerate):
+	case c.Hidden:
+		placeholder = "This comment was hidden by a moderator"
+	case c.Author.Suspended:
+		placeholder = "Comment by a suspended account"
+	case Hides(viewer, c.Author, db):
+		placeholder = "Comment by a user you blocked or muted"
+	}
+
+	if placeholder != "" {
+		fmt.Fprintf(builder, `<tr id="comment-%v">`, c.Id)
+		builder.WriteString(`<td class="rowname"></td>`)
+		fmt.Fprintf(builder, `<td style="padding-left: %vem">%v</td>`, 1+2*depth, placeholder)
+		builder.WriteString(`</tr>`)
+	} else {
+		renderComment(builder, c, depth, viewer, db)
+	}
+
+	children := replies[c.Id]
+	if len(children) == 0 {
+		return
+	}
+
+	if depth+1 >= maxCommentDepth {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname"></td>`)
+		fmt.Fprintf(builder, `<td style="padding-left: %vem">`, 1+2*(depth+1))
+		fmt.Fprintf(builder, `<a href="/post?id=%v&thread=%v">Continue thread (%v replies)</a>`, c.CommentedPost.Id, c.Id, len(children))
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+		return
+	}
+
+	for _, child := range children {
+		renderCommentTree(builder, child, replies, depth+1, viewer, db)
+	}
+}
+
+func renderComment(builder *strings.Builder, c *core.Comment, depth int, viewer *core.User, db core.Database) {
+	fmt.Fprintf(builder, `<tr id="comment-%v">`, c.Id)
+	fmt.Fprintf(builder, `<td class="rowname">Comment by %v<br></br><a href="/comment?id=%v">Permalink</a></td>`, UserLink(c.Author), c.Id)
+	fmt.Fprintf(builder, `<td class="post" style="padding-left: %vem">`, 1+2*depth)
+	if c.Hidden {
+		builder.WriteString(`<i>Hidden from everyone but moderators</i>`)
+	}
+	fmt.Fprintf(builder, `<code><pre>%v</pre></code>`, RenderCommentContent(c, db))
+
+	ls, err := db.GetCommentLikes(c)
+	if err != nil {
+		log.Printf("Failed to get reactions to comment %v: %v\n", c.Id, err)
+	}
+	renderReactions(builder, ls, fmt.Sprintf("comment=%v", c.Id), viewer)
+
+	if viewer != nil {
+		builder.WriteString(`<details><summary>Reply</summary>`)
+		builder.WriteString(RenderCommentForm(c.CommentedPost.Id, c.Id))
+		builder.WriteString(`</details>`)
+	}
+	if viewer != nil && viewer.Id != c.Author.Id {
+		renderReportForm(builder, fmt.Sprintf("comment=%v", c.Id))
+	}
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+}
+
+func RenderPostById(id int, threadId int, viewer *core.User, db core.Database) (string, error) {
 	p, err := db.LoadPost(id)
 	if err != nil {
 		return "", fmt.Errorf("Failed to load post: id=%v, err=%v\n", id, err)
 	}
 
-	html, err := RenderPost(p, db)
+	html, err := RenderPostThread(p, threadId, viewer, db)
 	return html, err
 }
+
+func RenderSettings(u *core.User) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<form action="/do_settings" method="POST">`)
+	builder.WriteString(`<h2>Privacy</h2>`)
+	builder.WriteString(`<label for="visibility">Who can see my profile:</label>`)
+	builder.WriteString(VisibilitySelect("visibility", u.Visibility))
+	builder.WriteString(`<br></br>`)
+	builder.WriteString(`<label for="message_visibility">Who can message me:</label>`)
+	builder.WriteString(VisibilitySelect("message_visibility", u.MessageVisibility))
+	builder.WriteString(`<br></br>`)
+	builder.WriteString(`<label for="bio">Bio:</label>`)
+	fmt.Fprintf(builder, `<input type="text" id="bio" name="bio" value="%v"></input>`, html.EscapeString(string(u.Bio)))
+	builder.WriteString(`<h2>Email</h2>`)
+	builder.WriteString(`<label for="email">Email:</label>`)
+	fmt.Fprintf(builder, `<input type="email" id="email" name="email" value="%v"></input>`, html.EscapeString(u.Email))
+	builder.WriteString(`<label for="digest_frequency">Mail me unread notifications:</label>`)
+	builder.WriteString(`<select id="digest_frequency" name="digest_frequency">`)
+	for _, f := range core.DigestFrequencies {
+		selected := ""
+		if f == u.DigestFrequency {
+			selected = " selected"
+		}
+		fmt.Fprintf(builder, `<option value="%v"%v>%v</option>`, f, selected, f)
+	}
+	builder.WriteString(`</select>`)
+	builder.WriteString(`<input type="submit" value="Save"></input>`)
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// RenderPasswordForm renders the form changing the password, resetRequired
+// tells the user why they were sent there.
+func RenderPasswordForm(resetRequired bool) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<h2>Change password</h2>`)
+	if resetRequired {
+		builder.WriteString(`<p class="error">An administrator asked you to choose a new password before going on.</p>`)
+	}
+
+	builder.WriteString(`<form action="/do_change_password" method="POST">`)
+	builder.WriteString(`<label for="password">Current password:</label>`)
+	builder.WriteString(`<input type="password" id="password" name="password"></input> <br></br>`)
+	builder.WriteString(`<label for="new_password">New password:</label>`)
+	builder.WriteString(`<input type="password" id="new_password" name="new_password"></input> <br></br>`)
+	builder.WriteString(`<label for="new_password_again">New password again:</label>`)
+	builder.WriteString(`<input type="password" id="new_password_again" name="new_password_again"></input> <br></br>`)
+	builder.WriteString(`<input type="submit" value="Change"></input>`)
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
+
+// RenderSessions lists ss with buttons posting to revokeUrl?id=, currentId
+// is the session rendering the page or 0.
+func RenderSessions(ss []core.Session, currentId int, revokeUrl string) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<table>`)
+
+	if len(ss) == 0 {
+		builder.WriteString(`<tr><td>No sessions</td></tr>`)
+	}
+
+	for i := range ss {
+		s := &ss[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">Last seen %v<br></br>Since %v</td>`, s.LastSeenAt.Format(timeLayout), s.CreatedAt.Format(timeLayout))
+		fmt.Fprintf(builder, `<td>%v<br></br>%v</td>`, html.EscapeString(s.Address), html.EscapeString(s.UserAgent))
+		builder.WriteString(`<td>`)
+		if s.Id == currentId {
+			builder.WriteString(`This browser`)
+		} else {
+			fmt.Fprintf(builder, `<form action="%v?id=%v" method="POST">`, revokeUrl, s.Id)
+			builder.WriteString(`<input type="submit" value="Revoke"></input>`)
+			builder.WriteString(`</form>`)
+		}
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// accessTokenLifetimes are the expiries offered for new tokens in days, 0
+// for tokens that do not expire.
+var accessTokenLifetimes = []int{30, 7, 90, 365, 0}
+
+// RenderAccessTokens lists ts with buttons posting to revokeUrl?id=.
+func RenderAccessTokens(ts []core.AccessToken, revokeUrl string) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<h2>Personal access tokens</h2>`)
+	builder.WriteString(`<table>`)
+
+	if len(ts) == 0 {
+		builder.WriteString(`<tr><td>No tokens</td></tr>`)
+	}
+
+	for i := range ts {
+		t := &ts[i]
+
+		names := []string{}
+		for _, s := range t.Scopes {
+			names = append(names, s.String())
+		}
+
+		lastUsed := "Never used"
+		if !t.LastUsedAt.IsZero() {
+			lastUsed = fmt.Sprintf("Last used %v", t.LastUsedAt.Format(timeLayout))
+		}
+
+		expires := "Never expires"
+		if t.IsExpired(time.Now()) {
+			expires = fmt.Sprintf("Expired %v", t.ExpiresAt.Format(timeLayout))
+		} else if !t.ExpiresAt.IsZero() {
+			expires = fmt.Sprintf("Expires %v", t.ExpiresAt.Format(timeLayout))
+		}
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v<br></br>%v</td>`, html.EscapeString(t.Name), strings.Join(names, ", "))
+		fmt.Fprintf(builder, `<td>%v<br></br>Created %v<br></br>%v</td>`, lastUsed, t.CreatedAt.Format(timeLayout), expires)
+		builder.WriteString(`<td>`)
+		fmt.Fprintf(builder, `<form action="%v?id=%v" method="POST">`, revokeUrl, t.Id)
+		builder.WriteString(`<input type="submit" value="Revoke"></input>`)
+		builder.WriteString(`</form>`)
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// RenderAccessTokenForm renders the form creating a personal access token.
+func RenderAccessTokenForm() string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<h2>New token</h2>`)
+	builder.WriteString(`<form action="/do_create_token" method="POST">`)
+	builder.WriteString(`<label for="name">Name:</label>`)
+	builder.WriteString(`<input type="text" id="name" name="name"></input> <br></br>`)
+	for _, s := range core.Scopes {
+		fmt.Fprintf(builder, `<input type="checkbox" id="scope_%v" name="scope" value="%v"></input>`, int(s), s)
+		fmt.Fprintf(builder, `<label for="scope_%v">%v</label><br></br>`, int(s), s)
+	}
+	builder.WriteString(`<label for="expires_in">Expires:</label>`)
+	builder.WriteString(`<select id="expires_in" name="expires_in">`)
+	for _, days := range accessTokenLifetimes {
+		if days == 0 {
+			builder.WriteString(`<option value="0">Never</option>`)
+		} else {
+			fmt.Fprintf(builder, `<option value="%v">In %v days</option>`, days, days)
+		}
+	}
+	builder.WriteString(`</select> <br></br>`)
+	builder.WriteString(`<input type="submit" value="Create"></input>`)
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
+
+// RenderNewAccessToken shows the secret of t, which is not stored and so
+// cannot be shown again.
+func RenderNewAccessToken(t *core.AccessToken, secret string) string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, `<h2>Token %v created</h2>`, html.EscapeString(t.Name))
+	builder.WriteString(`<p>Copy it now, it will not be shown again:</p>`)
+	fmt.Fprintf(builder, `<p><code>%v</code></p>`, html.EscapeString(secret))
+	builder.WriteString(`<p>Send it as <code>Authorization: Bearer &lt;token&gt;</code> to the API at <code>/api/v1</code>.</p>`)
+	builder.WriteString(`<p><a href="/settings/tokens">Back to tokens</a></p>`)
+
+	return builder.String()
+}
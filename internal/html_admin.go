@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const adminNav = `<nav><a href="/admin/users">Users</a> <a href="/admin/stats">Statistics</a> <a href="/admin/audit">Audit log</a> <a href="/admin/webhooks">Webhooks</a> <a href="/moderation">Moderation queue</a></nav>`
+
+// roleSelect renders a <select> listing every role with selected preselected.
+func roleSelect(name string, selected core.Role) string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, `<select name="%v">`, name)
+	for _, role := range core.Roles {
+		if role == selected {
+			fmt.Fprintf(builder, `<option value="%v" selected>%v</option>`, role, role)
+		} else {
+			fmt.Fprintf(builder, `<option value="%v">%v</option>`, role, role)
+		}
+	}
+	builder.WriteString(`</select>`)
+
+	return builder.String()
+}
+
+// RenderAdmin renders the admin page: the staff and forms changing roles.
+func RenderAdmin(staff []core.User) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(adminNav)
+
+	builder.WriteString(`<h2>Staff</h2>`)
+	builder.WriteString(`<table>`)
+	for i := range staff {
+		u := &staff[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v</td>`, UserLink(u))
+		builder.WriteString(`<td>`)
+		fmt.Fprintf(builder, `<form action="/admin/do_set_role?id=%v" method="POST">`, u.Id)
+		builder.WriteString(roleSelect("role", u.Role))
+		builder.WriteString(`<input type="submit" value="Change"></input>`)
+		builder.WriteString(`</form>`)
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+	builder.WriteString(`</table>`)
+
+	builder.WriteString(`<h2>Give a role</h2>`)
+	builder.WriteString(`<form action="/admin/do_set_role" method="POST">`)
+	builder.WriteString(`<label for="login">Login:</label>`)
+	builder.WriteString(`<input type="text" id="login" name="login"></input>`)
+	builder.WriteString(roleSelect("role", core.RoleModerator))
+	builder.WriteString(`<input type="submit" value="Give"></input>`)
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
+
+// RenderAdminUserSearch renders the user search form and the users found.
+func RenderAdminUserSearch(query string, us []core.User) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(adminNav)
+	builder.WriteString(`<form action="/admin/users" method="GET">`)
+	fmt.Fprintf(builder, `<input type="search" name="q" value="%v" placeholder="Login"></input>`, html.EscapeString(query))
+	builder.WriteString(`<input type="submit" value="Find"></input>`)
+	builder.WriteString(`</form>`)
+
+	if query == "" {
+		return builder.String()
+	}
+
+	builder.WriteString(`<table>`)
+
+	if len(us) == 0 {
+		builder.WriteString(`<tr><td>Nobody found</td></tr>`)
+	}
+
+	for i := range us {
+		u := &us[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname"><a href="/admin/user?id=%v">%v</a></td>`, u.Id, html.EscapeString(u.Login))
+		fmt.Fprintf(builder, `<td>%v</td>`, describeAccount(u))
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// describeAccount sums up the role and the state of u.
+func describeAccount(u *core.User) string {
+	parts := []string{u.Role.String()}
+	if !u.CreatedAt.IsZero() {
+		parts = append(parts, "joined "+u.CreatedAt.Format(timeLayout))
+	}
+	if u.Suspended {
+		parts = append(parts, "suspended")
+	}
+	if u.PasswordResetRequired {
+		parts = append(parts, "must reset password")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// adminButton renders a form posting to action with a single button.
+func adminButton(builder *strings.Builder, action string, label string) {
+	fmt.Fprintf(builder, `<form action="%v" method="POST">`, action)
+	fmt.Fprintf(builder, `<input type="submit" value="%v"></input>`, label)
+	builder.WriteString(`</form>`)
+}
+
+// RenderAdminUser renders an account with its posts, sessions and the
+// reports about it, and the actions on it.
+func RenderAdminUser(u *core.User, ps []core.Post, ss []core.Session, rs []core.Report) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(adminNav)
+	fmt.Fprintf(builder, `<h2>%v</h2>`, UserLink(u))
+	fmt.Fprintf(builder, `<p>%v</p>`, describeAccount(u))
+	if u.Email != "" {
+		fmt.Fprintf(builder, `<p>Email: %v</p>`, html.EscapeString(u.Email))
+	}
+
+	// Staff accounts are only suspended, reset or deleted once demoted.
+	switch {
+	case u.Suspended:
+		adminButton(builder, fmt.Sprintf("/admin/do_unsuspend?id=%v", u.Id), "Unsuspend")
+	case u.Role != core.RoleUser:
+		fmt.Fprintf(builder, `<p>Demote this %v to suspend, reset or delete the account.</p>`, u.Role)
+	default:
+		adminButton(builder, fmt.Sprintf("/admin/do_suspend?id=%v", u.Id), "Suspend")
+	}
+
+	if u.Role == core.RoleUser {
+		adminButton(builder, fmt.Sprintf("/admin/do_force_password_reset?id=%v", u.Id), "Force password reset")
+
+		fmt.Fprintf(builder, `<form action="/admin/do_delete_user?id=%v" method="POST">`, u.Id)
+		builder.WriteString(`<input type="text" name="login" placeholder="Type the login to confirm"></input>`)
+		builder.WriteString(`<input type="submit" value="Delete account"></input>`)
+		builder.WriteString(`</form>`)
+	}
+
+	builder.WriteString(`<h2>Sessions</h2>`)
+	builder.WriteString(RenderSessions(ss, 0, "/admin/do_revoke_session"))
+
+	builder.WriteString(`<h2>Reports</h2>`)
+	builder.WriteString(`<table>`)
+	if len(rs) == 0 {
+		builder.WriteString(`<tr><td>No reports</td></tr>`)
+	}
+	for i := range rs {
+		r := &rs[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v by %v<br></br>%v</td>`, r.Status, UserLink(r.Reporter), r.CreatedAt.Format(timeLayout))
+		fmt.Fprintf(builder, `<td class="post">%v<p>Reason: %v</p></td>`, describeReportTarget(r), html.EscapeString(r.Reason))
+		builder.WriteString(`</tr>`)
+	}
+	builder.WriteString(`</table>`)
+
+	builder.WriteString(`<h2>Posts</h2>`)
+	builder.WriteString(`<table>`)
+	if len(ps) == 0 {
+		builder.WriteString(`<tr><td>No posts</td></tr>`)
+	}
+	for i := range ps {
+		p := &ps[i]
+
+		state := p.Visibility.String()
+		if p.Hidden {
+			state += ", hidden"
+		}
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname"><a href="/post?id=%v">Post %v</a><br></br>%v</td>`, p.Id, p.Id, state)
+		fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td>`, html.EscapeString(string(p.Content)))
+		builder.WriteString(`</tr>`)
+	}
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// RenderDailyStats renders a table of what was created per day.
+func RenderDailyStats(stats []core.DayStats) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(adminNav)
+	builder.WriteString(`<table>`)
+	builder.WriteString(`<tr><th>Day (UTC)</th><th>Users</th><th>Posts</th><th>Comments</th></tr>`)
+
+	for _, s := range stats {
+		fmt.Fprintf(builder, `<tr><td class="rowname">%v</td><td>%v</td><td>%v</td><td>%v</td></tr>`,
+			s.Day.Format("2006-01-02"), s.Users, s.Posts, s.Comments)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
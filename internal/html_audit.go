@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func auditUrl(f core.AuditFilter) string {
+	values := url.Values{}
+	if f.Kind != nil {
+		values.Set("kind", f.Kind.String())
+	}
+	if f.ActorLogin != "" {
+		values.Set("actor", f.ActorLogin)
+	}
+	if f.TargetLogin != "" {
+		values.Set("target", f.TargetLogin)
+	}
+	if f.BeforeId != 0 {
+		values.Set("before", fmt.Sprint(f.BeforeId))
+	}
+
+	return "/admin/audit?" + values.Encode()
+}
+
+// auditUser renders the actor or the target of an event, which may have
+// been deleted since.
+func auditUser(id int, login string) string {
+	if id == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(`<a href="/admin/user?id=%v">%v</a>`, id, html.EscapeString(login))
+}
+
+// RenderAuditLog renders the filter form and a page of events, events has
+// one more event than the page shows if there is a next page.
+func RenderAuditLog(f core.AuditFilter, es []core.AuditEvent, pageSize int) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(adminNav)
+	builder.WriteString(`<p><a href="/admin/audit/verify">Verify the hash chain</a></p>`)
+
+	builder.WriteString(`<form action="/admin/audit" method="GET">`)
+	builder.WriteString(`<select name="kind"><option value="">any event</option>`)
+	for _, k := range core.AuditEventKinds {
+		selected := ""
+		if f.Kind != nil && *f.Kind == k {
+			selected = " selected"
+		}
+		fmt.Fprintf(builder, `<option value="%v"%v>%v</option>`, k, selected, k)
+	}
+	builder.WriteString(`</select>`)
+	fmt.Fprintf(builder, `<input type="text" name="actor" value="%v" placeholder="Actor login"></input>`, html.EscapeString(f.ActorLogin))
+	fmt.Fprintf(builder, `<input type="text" name="target" value="%v" placeholder="Target login"></input>`, html.EscapeString(f.TargetLogin))
+	builder.WriteString(`<input type="submit" value="Filter"></input>`)
+	builder.WriteString(`</form>`)
+
+	builder.WriteString(`<table>`)
+	builder.WriteString(`<tr><th>Id</th><th>Time</th><th>Event</th><th>Actor</th><th>Target</th><th>Address</th><th>Detail</th></tr>`)
+
+	if len(es) == 0 {
+		builder.WriteString(`<tr><td>No events</td></tr>`)
+	}
+
+	for i := range es {
+		if i == pageSize {
+			break
+		}
+		e := &es[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td>%v</td>`, e.Id)
+		fmt.Fprintf(builder, `<td>%v</td>`, e.CreatedAt.Format(timeLayout))
+		fmt.Fprintf(builder, `<td>%v</td>`, e.Kind)
+		fmt.Fprintf(builder, `<td>%v</td>`, auditUser(e.ActorId, e.ActorLogin))
+		fmt.Fprintf(builder, `<td>%v</td>`, auditUser(e.TargetId, e.TargetLogin))
+		fmt.Fprintf(builder, `<td>%v<br></br>%v</td>`, html.EscapeString(e.Address), html.EscapeString(e.UserAgent))
+		fmt.Fprintf(builder, `<td>%v</td>`, html.EscapeString(e.Detail))
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	builder.WriteString(`<p>`)
+	if f.BeforeId != 0 {
+		first := f
+		first.BeforeId = 0
+		fmt.Fprintf(builder, `<a href="%v">Newest</a> `, html.EscapeString(auditUrl(first)))
+	}
+	if len(es) > pageSize {
+		next := f
+		next.BeforeId = es[pageSize-1].Id
+		fmt.Fprintf(builder, `<a href="%v">Older</a>`, html.EscapeString(auditUrl(next)))
+	}
+	builder.WriteString(`</p>`)
+
+	return builder.String()
+}
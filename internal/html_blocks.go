@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// blockLabel is the button label turning k on, or off if on is set.
+func blockLabel(k core.BlockKind, on bool) string {
+	switch {
+	case k == core.BlockKindBlock && on:
+		return "Unblock"
+	case k == core.BlockKindBlock:
+		return "Block"
+	case on:
+		return "Unmute"
+	}
+
+	return "Mute"
+}
+
+// renderBlocking writes the block and mute buttons of profile u.
+func renderBlocking(builder *strings.Builder, u *core.User, viewer *core.User, db core.Database) {
+	if viewer == nil || viewer.Id == u.Id {
+		return
+	}
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Protection</td>`)
+	builder.WriteString(`<td>`)
+	for _, k := range core.BlockKinds {
+		on, err := db.IsBlocked(viewer, u, k)
+		if err != nil {
+			log.Printf("Failed to check if %v %v %v: %v\n", viewer.Id, k, u.Id, err)
+			continue
+		}
+
+		action := "do_block"
+		if on {
+			action = "do_unblock"
+		}
+
+		fmt.Fprintf(builder, `<form class="reaction" action="/%v?id=%v&kind=%v" method="POST">`, action, u.Id, k)
+		fmt.Fprintf(builder, `<input type="submit" value="%v"></input>`, blockLabel(k, on))
+		builder.WriteString(`</form>`)
+	}
+	renderReportForm(builder, fmt.Sprintf("user=%v", u.Id))
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+}
+
+// RenderBlockSettings renders the lists of users blocked and muted by the
+// viewer, lists are indexed by core.BlockKind.
+func RenderBlockSettings(lists map[core.BlockKind][]core.User) string {
+	builder := &strings.Builder{}
+
+	for _, k := range core.BlockKinds {
+		switch k {
+		case core.BlockKindBlock:
+			builder.WriteString(`<h2>Blocked users</h2>`)
+			builder.WriteString(`<p>Blocked users cannot see your profile and posts, comment on your posts or message you.</p>`)
+		case core.BlockKindMute:
+			builder.WriteString(`<h2>Muted users</h2>`)
+			builder.WriteString(`<p>Posts and comments of muted users are hidden from you.</p>`)
+		}
+
+		builder.WriteString(`<table>`)
+
+		if len(lists[k]) == 0 {
+			builder.WriteString(`<tr><td>Nobody</td></tr>`)
+		}
+
+		for i := range lists[k] {
+			u := &lists[k][i]
+
+			builder.WriteString(`<tr>`)
+			fmt.Fprintf(builder, `<td class="rowname">%v</td>`, UserLink(u))
+			fmt.Fprintf(builder, `<td><form action="/do_unblock?id=%v&kind=%v" method="POST">`, u.Id, k)
+			fmt.Fprintf(builder, `<input type="submit" value="%v"></input>`, blockLabel(k, true))
+			builder.WriteString(`</form></td>`)
+			builder.WriteString(`</tr>`)
+		}
+
+		builder.WriteString(`</table>`)
+
+		fmt.Fprintf(builder, `<form action="/do_block?kind=%v" method="POST">`, k)
+		builder.WriteString(`<input type="text" name="login" placeholder="Login"></input>`)
+		fmt.Fprintf(builder, `<input type="submit" value="%v"></input>`, blockLabel(k, false))
+		builder.WriteString(`</form>`)
+	}
+
+	return builder.String()
+}
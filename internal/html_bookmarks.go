@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// renderBookmark writes the bookmark toggle of p for a logged in viewer.
+func renderBookmark(builder *strings.Builder, p *core.Post, viewer *core.User, db core.Database) {
+	if viewer == nil {
+		return
+	}
+
+	b, err := db.FindBookmark(viewer, p)
+	if err != nil {
+		log.Printf("Failed to find bookmark of %v: %v\n", p.Id, err)
+		return
+	}
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Bookmark</td>`)
+	builder.WriteString(`<td>`)
+	if b != nil {
+		if b.Collection != nil {
+			fmt.Fprintf(builder, `Saved in <a href="/bookmarks?collection=%v">%v</a>`, b.Collection.Id, html.EscapeString(b.Collection.Name))
+		} else {
+			builder.WriteString(`<a href="/bookmarks">Saved</a>`)
+		}
+		fmt.Fprintf(builder, `<form class="reaction" action="/do_unbookmark?id=%v" method="POST">`, p.Id)
+		builder.WriteString(`<input type="submit" value="Remove bookmark"></input>`)
+		builder.WriteString(`</form>`)
+	} else {
+		cs, err := db.GetBookmarkCollections(viewer)
+		if err != nil {
+			log.Printf("Failed to list bookmark collections: %v\n", err)
+		}
+
+		fmt.Fprintf(builder, `<form class="reaction" action="/do_bookmark?id=%v" method="POST">`, p.Id)
+		if len(cs) != 0 {
+			builder.WriteString(BookmarkCollectionSelect(cs))
+		}
+		builder.WriteString(`<input type="submit" value="Bookmark"></input>`)
+		builder.WriteString(`</form>`)
+	}
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+}
+
+func BookmarkCollectionSelect(cs []core.BookmarkCollection) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<select name="collection">`)
+	builder.WriteString(`<option value="0">No collection</option>`)
+	for _, c := range cs {
+		fmt.Fprintf(builder, `<option value="%v">%v</option>`, c.Id, html.EscapeString(c.Name))
+	}
+	builder.WriteString(`</select>`)
+
+	return builder.String()
+}
+
+// RenderBookmarkCollections renders the collection navigation of the
+// bookmarks page, selected is the shown collection or nil for all.
+func RenderBookmarkCollections(cs []core.BookmarkCollection, selected *core.BookmarkCollection) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<nav>`)
+	if selected == nil {
+		builder.WriteString(`<b>All</b> `)
+	} else {
+		builder.WriteString(`<a href="/bookmarks">All</a> `)
+	}
+	for _, c := range cs {
+		if selected != nil && selected.Id == c.Id {
+			fmt.Fprintf(builder, `<b>%v</b> `, html.EscapeString(c.Name))
+		} else {
+			fmt.Fprintf(builder, `<a href="/bookmarks?collection=%v">%v</a> `, c.Id, html.EscapeString(c.Name))
+		}
+	}
+	builder.WriteString(`</nav>`)
+
+	builder.WriteString(`<form action="/do_bookmark_collection" method="POST">`)
+	fmt.Fprintf(builder, `<input type="text" name="name" maxlength="%v" placeholder="New collection"></input>`, core.MaxBookmarkCollectionNameLength)
+	builder.WriteString(`<input type="submit" value="Create"></input>`)
+	builder.WriteString(`</form>`)
+
+	if selected != nil {
+		fmt.Fprintf(builder, `<form action="/do_delete_bookmark_collection?id=%v" method="POST">`, selected.Id)
+		builder.WriteString(`<input type="submit" value="Delete this collection"></input>`)
+		builder.WriteString(`</form>`)
+	}
+
+	return builder.String()
+}
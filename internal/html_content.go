@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+type contentLink struct {
+	start int
+	end   int
+	href  string
+}
+
+// renderContent escapes content turning hashtags, if tags is set, and
+// mentions of the mentioned users into links. Other @logins stay text.
+func renderContent(content []byte, tags bool, mentioned []core.User) string {
+	s := string(content)
+	links := []contentLink{}
+
+	if tags {
+		for _, r := range core.FindHashtags(s) {
+			if tag := core.NormalizeTag(s[r[0]:r[1]]); tag != "" {
+				links = append(links, contentLink{r[0], r[1], TagUrl(tag)})
+			}
+		}
+	}
+
+	if len(mentioned) != 0 {
+		for _, r := range core.FindMentions(s) {
+			for i := range mentioned {
+				if mentioned[i].Login == s[r[0]+1:r[1]] {
+					links = append(links, contentLink{r[0], r[1], fmt.Sprintf("/user?id=%v", mentioned[i].Id)})
+					break
+				}
+			}
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].start < links[j].start
+	})
+
+	builder := &strings.Builder{}
+	last := 0
+	for _, l := range links {
+		if l.start < last {
+			continue
+		}
+
+		builder.WriteString(html.EscapeString(s[last:l.start]))
+		fmt.Fprintf(builder, `<a href="%v">%v</a>`, html.EscapeString(l.href), html.EscapeString(s[l.start:l.end]))
+		last = l.end
+	}
+	builder.WriteString(html.EscapeString(s[last:]))
+
+	return builder.String()
+}
+
+// RenderPostContent escapes the content of p linking its hashtags and the
+// users it mentions.
+func RenderPostContent(p *core.Post, db core.Database) string {
+	mentioned, err := db.GetMentionedUsers(p.Id, 0)
+	if err != nil {
+		log.Printf("Failed to load mentions in post %v: %v\n", p.Id, err)
+	}
+
+	return renderContent(p.Content, true, mentioned)
+}
+
+// RenderCommentContent escapes the content of c linking the users it
+// mentions, comments are not tagged.
+func RenderCommentContent(c *core.Comment, db core.Database) string {
+	mentioned, err := db.GetMentionedUsers(c.CommentedPost.Id, c.Id)
+	if err != nil {
+		log.Printf("Failed to load mentions in comment %v: %v\n", c.Id, err)
+	}
+
+	return renderContent(c.Content, false, mentioned)
+}
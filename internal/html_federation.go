@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// remoteActorLink links to the page of a, or shows its handle if it has none.
+func remoteActorLink(a *core.RemoteActor) string {
+	if a.Url == "" {
+		return html.EscapeString(a.Handle())
+	}
+
+	return fmt.Sprintf(`<a href="%v">%v</a>`, html.EscapeString(a.Url), html.EscapeString(a.Handle()))
+}
+
+// renderFediverse shows the handle other servers know u by and how many of
+// their users follow u.
+func renderFediverse(builder *strings.Builder, u *core.User, db core.Database) {
+	fs, err := db.GetRemoteFollowers(u)
+	if err != nil {
+		log.Printf("Failed to load remote followers of %v: %v\n", u.Id, err)
+	}
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Fediverse</td>`)
+	fmt.Fprintf(builder, `<td>@%v@%v, followed by %v on other servers</td>`,
+		html.EscapeString(u.Login), html.EscapeString(FederationHost()), len(fs))
+	builder.WriteString(`</tr>`)
+}
+
+// renderRemoteReplies shows the likes and replies p got from other servers.
+func renderRemoteReplies(builder *strings.Builder, p *core.Post, db core.Database) {
+	likes, err := db.CountRemoteLikes(p)
+	if err != nil {
+		log.Printf("Failed to count remote likes of post %v: %v\n", p.Id, err)
+	}
+
+	ns, err := db.GetRemoteNotes(p)
+	if err != nil {
+		log.Printf("Failed to load remote replies to post %v: %v\n", p.Id, err)
+	}
+
+	if likes != 0 {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">Other servers</td>`)
+		fmt.Fprintf(builder, `<td>Likes: %v</td>`, likes)
+		builder.WriteString(`</tr>`)
+	}
+
+	for _, n := range ns {
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">Reply by %v`, remoteActorLink(n.Actor))
+		if n.Url != "" {
+			fmt.Fprintf(builder, `<br></br><a href="%v">Original</a>`, html.EscapeString(n.Url))
+		}
+		builder.WriteString(`</td>`)
+		fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td>`, html.EscapeString(n.Content))
+		builder.WriteString(`</tr>`)
+	}
+}
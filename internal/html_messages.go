@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	timeLayout = "2006-01-02 15:04"
+)
+
+// ConversationTitle returns the title of c or, if it has none, logins of its
+// members other than viewer.
+func ConversationTitle(c *core.Conversation, viewer *core.User) string {
+	if len(c.Title) > 0 {
+		return c.Title
+	}
+
+	logins := []string{}
+	for _, member := range c.Members {
+		if member.User.Id != viewer.Id {
+			logins = append(logins, member.User.Login)
+		}
+	}
+
+	return strings.Join(logins, ", ")
+}
+
+func RenderConversations(cs []core.Conversation, viewer *core.User) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<table>`)
+
+	if len(cs) == 0 {
+		builder.WriteString(`<tr><td>No conversations yet</td></tr>`)
+	}
+
+	for i := range cs {
+		c := &cs[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v</td>`, c.LastActivity.Format(timeLayout))
+		fmt.Fprintf(builder, `<td><a href="/conversation?id=%v">%v</a>`, c.Id, html.EscapeString(ConversationTitle(c, viewer)))
+		if c.Unread > 0 {
+			fmt.Fprintf(builder, ` <b>(%v unread)</b>`, c.Unread)
+		}
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	builder.WriteString(`<form action="/do_new_conversation" method="POST">`)
+	builder.WriteString(`<h2>New conversation</h2>`)
+	builder.WriteString(`<label for="logins">Logins, separated by commas:</label>`)
+	builder.WriteString(`<input type="text" id="logins" name="logins"></input>`)
+	builder.WriteString(`<label for="title">Title (optional, for groups):</label>`)
+	builder.WriteString(`<input type="text" id="title" name="title"></input>`)
+	builder.WriteString(`<textarea id="content" name="content" rows="2" cols="60"></textarea>`)
+	builder.WriteString(`<input type="submit" value="Start conversation"></input>`)
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
+
+// RenderConversation renders ms, given newest first as returned by
+// GetMessages, in chronological order together with a reply form. If
+// olderId is not zero a link to older messages is shown.
+func RenderConversation(c *core.Conversation, ms []core.Message, olderId int, viewer *core.User) string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, `<h2>%v</h2>`, html.EscapeString(ConversationTitle(c, viewer)))
+
+	lastId := 0
+	if len(ms) > 0 {
+		lastId = ms[0].Id
+	}
+
+	fmt.Fprintf(builder, `<table id="messages" data-conversation="%v" data-last="%v">`, c.Id, lastId)
+
+	builder.WriteString(`<tr>`)
+	builder.WriteString(`<td class="rowname">Members</td>`)
+	builder.WriteString(`<td>`)
+	for i, member := range c.Members {
+		if i > 0 {
+			builder.WriteString(`, `)
+		}
+		builder.WriteString(UserLink(member.User))
+	}
+	builder.WriteString(`</td>`)
+	builder.WriteString(`</tr>`)
+
+	if olderId != 0 {
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname"></td>`)
+		fmt.Fprintf(builder, `<td><a href="/conversation?id=%v&before=%v">Older messages</a></td>`, c.Id, olderId)
+		builder.WriteString(`</tr>`)
+	}
+
+	for i := len(ms) - 1; i >= 0; i-- {
+		m := &ms[i]
+
+		fmt.Fprintf(builder, `<tr id="message-%v">`, m.Id)
+		fmt.Fprintf(builder, `<td class="rowname">%v<br></br>%v</td>`, UserLink(m.Author), m.CreatedAt.Format(timeLayout))
+		fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code>`, html.EscapeString(string(m.Content)))
+		if m.Author.Id == viewer.Id {
+			readBy := c.ReadBy(m)
+			if len(readBy) > 0 {
+				builder.WriteString(`<small>Read by `)
+				for j, u := range readBy {
+					if j > 0 {
+						builder.WriteString(`, `)
+					}
+					builder.WriteString(html.EscapeString(u.Login))
+				}
+				builder.WriteString(`</small>`)
+			}
+		}
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	fmt.Fprintf(builder, `<form action="/do_message?id=%v" method="POST">`, c.Id)
+	builder.WriteString(`<p id="typing"></p>`)
+	builder.WriteString(`<textarea id="content" name="content" rows="2" cols="60"></textarea>`)
+	builder.WriteString(`<input type="submit" value="Send"></input>`)
+	builder.WriteString(`</form>`)
+	builder.WriteString(`<script src="/chat.js"></script>`)
+
+	return builder.String()
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// renderReportForm writes the form reporting an item, target is the query
+// addressing it, like "post=3", "comment=5" or "user=2".
+func renderReportForm(builder *strings.Builder, target string) {
+	builder.WriteString(`<details><summary>Report</summary>`)
+	fmt.Fprintf(builder, `<form action="/do_report?%v" method="POST">`, target)
+	fmt.Fprintf(builder, `<textarea name="reason" rows="2" cols="30" maxlength="%v" placeholder="What is wrong with it?"></textarea>`, core.MaxReportReasonLength)
+	builder.WriteString(`<input type="submit" value="Report"></input>`)
+	builder.WriteString(`</form>`)
+	builder.WriteString(`</details>`)
+}
+
+// describeReportTarget links to what r is about and shows its content.
+func describeReportTarget(r *core.Report) string {
+	switch {
+	case r.Post != nil:
+		return fmt.Sprintf(`<a href="/post?id=%v">Post %v</a> by %v<code><pre>%v</pre></code>`,
+			r.Post.Id, r.Post.Id, UserLink(r.Post.Author), html.EscapeString(string(r.Post.Content)))
+	case r.Comment != nil:
+		return fmt.Sprintf(`<a href="/comment?id=%v">Comment %v</a> by %v<code><pre>%v</pre></code>`,
+			r.Comment.Id, r.Comment.Id, UserLink(r.Comment.Author), html.EscapeString(string(r.Comment.Content)))
+	case r.User != nil:
+		return fmt.Sprintf(`Account %v<code><pre>%v</pre></code>`, UserLink(r.User), html.EscapeString(string(r.User.Bio)))
+	}
+
+	return `The reported content was deleted`
+}
+
+// describeModerationTarget links to what a acted upon.
+func describeModerationTarget(a *core.ModerationAction) string {
+	switch {
+	case a.PostId != 0:
+		return fmt.Sprintf(`<a href="/post?id=%v">post %v</a>`, a.PostId, a.PostId)
+	case a.CommentId != 0:
+		return fmt.Sprintf(`<a href="/comment?id=%v">comment %v</a>`, a.CommentId, a.CommentId)
+	case a.UserId != 0:
+		return fmt.Sprintf(`<a href="/user?id=%v">account %v</a>`, a.UserId, a.UserId)
+	}
+
+	return "nothing"
+}
+
+func RenderModerationQueue(rs []core.Report) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<p><a href="/moderation/log">Moderation log</a></p>`)
+	builder.WriteString(`<table>`)
+
+	if len(rs) == 0 {
+		builder.WriteString(`<tr><td>No open reports</td></tr>`)
+	}
+
+	for i := range rs {
+		r := &rs[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">Reported by %v<br></br>%v</td>`, UserLink(r.Reporter), r.CreatedAt.Format(timeLayout))
+		builder.WriteString(`<td class="post">`)
+		builder.WriteString(describeReportTarget(r))
+		fmt.Fprintf(builder, `<p>Reason: %v</p>`, html.EscapeString(r.Reason))
+
+		fmt.Fprintf(builder, `<form action="/do_moderate?report=%v" method="POST">`, r.Id)
+		builder.WriteString(`<select name="action">`)
+		for _, k := range core.ModerationActionKinds {
+			if k == core.ModerationHide && r.Post == nil && r.Comment == nil {
+				continue
+			}
+			if k == core.ModerationSuspend && r.Post == nil && r.Comment == nil && r.User == nil {
+				continue
+			}
+			fmt.Fprintf(builder, `<option value="%v">%v</option>`, k, k)
+		}
+		builder.WriteString(`</select>`)
+		fmt.Fprintf(builder, `<textarea name="reason" rows="1" cols="30" maxlength="%v" placeholder="Why"></textarea>`, core.MaxReportReasonLength)
+		builder.WriteString(`<input type="submit" value="Apply"></input>`)
+		builder.WriteString(`</form>`)
+
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// moderatorLink links to moderator, who may have been deleted since.
+func moderatorLink(moderator *core.User) string {
+	if moderator.Id == 0 {
+		return html.EscapeString(moderator.Login) + ` (deleted)`
+	}
+
+	return UserLink(moderator)
+}
+
+func RenderModerationLog(as []core.ModerationAction) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<p><a href="/moderation">Moderation queue</a></p>`)
+	builder.WriteString(`<table>`)
+
+	if len(as) == 0 {
+		builder.WriteString(`<tr><td>No moderation actions yet</td></tr>`)
+	}
+
+	for i := range as {
+		a := &as[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v</td>`, a.CreatedAt.Format(timeLayout))
+		fmt.Fprintf(builder, `<td>%v: %v %v`, moderatorLink(a.Moderator), a.Kind, describeModerationTarget(a))
+		if a.ReportId != 0 {
+			fmt.Fprintf(builder, ` (report %v)`, a.ReportId)
+		}
+		fmt.Fprintf(builder, `<br></br>Reason: %v</td>`, html.EscapeString(a.Reason))
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// NotificationLink returns the page n is about.
+func NotificationLink(n *core.Notification) string {
+	switch n.Kind {
+	case core.NotificationComment:
+		return fmt.Sprintf("/comment?id=%v", n.CommentId)
+	case core.NotificationLike, core.NotificationMention:
+		if n.CommentId != 0 {
+			return fmt.Sprintf("/comment?id=%v", n.CommentId)
+		}
+
+		return fmt.Sprintf("/post?id=%v", n.PostId)
+	case core.NotificationFriendRequest:
+		return "/friend_requests/incoming"
+	case core.NotificationMessage:
+		return fmt.Sprintf("/conversation?id=%v", n.ConversationId)
+	}
+
+	return fmt.Sprintf("/user?id=%v", n.Actor.Id)
+}
+
+// NotificationText describes n in plain text, it is not HTML escaped.
+func NotificationText(n *core.Notification) string {
+	switch n.Kind {
+	case core.NotificationComment:
+		return fmt.Sprintf("%v commented on your post", n.Actor.Login)
+	case core.NotificationLike:
+		return fmt.Sprintf("%v reacted to your post", n.Actor.Login)
+	case core.NotificationFollow:
+		return fmt.Sprintf("%v started following you", n.Actor.Login)
+	case core.NotificationFriendRequest:
+		return fmt.Sprintf("%v wants to be your friend", n.Actor.Login)
+	case core.NotificationFriendAccepted:
+		return fmt.Sprintf("%v accepted your friend request", n.Actor.Login)
+	case core.NotificationMention:
+		return fmt.Sprintf("%v mentioned you", n.Actor.Login)
+	case core.NotificationMessage:
+		return fmt.Sprintf("%v sent you a message", n.Actor.Login)
+	}
+
+	return fmt.Sprintf("%v did something", n.Actor.Login)
+}
+
+func RenderNotifications(ns []core.Notification) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<form action="/do_read_notifications" method="POST">`)
+	builder.WriteString(`<input type="submit" value="Mark all as read"></input>`)
+	builder.WriteString(`</form>`)
+
+	builder.WriteString(`<table>`)
+
+	if len(ns) == 0 {
+		builder.WriteString(`<tr><td>No notifications</td></tr>`)
+	}
+
+	for i := range ns {
+		n := &ns[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v</td>`, n.CreatedAt.Format(timeLayout))
+
+		text := html.EscapeString(NotificationText(n))
+		if !n.Read {
+			text = "<b>" + text + "</b>"
+		}
+
+		fmt.Fprintf(builder, `<td><a href="%v">%v</a>`, NotificationLink(n), text)
+		if !n.Read {
+			fmt.Fprintf(builder, `<form action="/do_read_notifications?id=%v" method="POST">`, n.Id)
+			builder.WriteString(`<input type="submit" value="Mark as read"></input>`)
+			builder.WriteString(`</form>`)
+		}
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// RenderMentions lists the posts and comments ms were made in.
+func RenderMentions(ms []core.Mention) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<table>`)
+
+	if len(ms) == 0 {
+		builder.WriteString(`<tr><td>Nobody mentioned you yet</td></tr>`)
+	}
+
+	for i := range ms {
+		m := &ms[i]
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v</td>`, m.CreatedAt.Format(timeLayout))
+		if m.CommentId != 0 {
+			fmt.Fprintf(builder, `<td>%v mentioned you in <a href="/comment?id=%v">a comment</a></td>`, UserLink(m.Author), m.CommentId)
+		} else {
+			fmt.Fprintf(builder, `<td>%v mentioned you in <a href="/post?id=%v">a post</a></td>`, UserLink(m.Author), m.PostId)
+		}
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+func RenderNotificationSettings(optOuts []core.NotificationKind) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<form action="/do_notification_settings" method="POST">`)
+	builder.WriteString(`<h2>Notify me about</h2>`)
+	for _, k := range core.NotificationKinds {
+		checked := " checked"
+		for _, optOut := range optOuts {
+			if optOut == k {
+				checked = ""
+			}
+		}
+
+		fmt.Fprintf(builder, `<input type="checkbox" id="notify_%v" name="notify" value="%v"%v></input>`, int(k), k, checked)
+		fmt.Fprintf(builder, `<label for="notify_%v">%v</label><br></br>`, int(k), k)
+	}
+	builder.WriteString(`<input type="submit" value="Save"></input>`)
+	builder.WriteString(`</form>`)
+
+	return builder.String()
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// renderReactions writes the reaction bar of an item, target is the query
+// addressing it, like "post=3" or "comment=5".
+func renderReactions(builder *strings.Builder, ls []core.Like, target string, viewer *core.User) {
+	counts := map[string]int{}
+	mine := ""
+	for _, l := range ls {
+		counts[l.Kind]++
+		if viewer != nil && l.Author.Id == viewer.Id {
+			mine = l.Kind
+		}
+	}
+
+	builder.WriteString(`<div class="reactions">`)
+	for _, r := range GetReactions() {
+		label := r.Emoji
+		if counts[r.Name] > 0 {
+			label = fmt.Sprintf("%v %v", r.Emoji, counts[r.Name])
+		}
+
+		if viewer == nil {
+			fmt.Fprintf(builder, `<span title="%v">%v</span> `, r.Name, label)
+			continue
+		}
+
+		class := "reaction"
+		if r.Name == mine {
+			class = "reaction reacted"
+		}
+
+		fmt.Fprintf(builder, `<form class="%v" action="/do_react?%v" method="POST">`, class, target)
+		fmt.Fprintf(builder, `<input type="hidden" name="kind" value="%v"></input>`, r.Name)
+		fmt.Fprintf(builder, `<input type="submit" title="%v" value="%v"></input>`, r.Name, label)
+		builder.WriteString(`</form>`)
+	}
+
+	if len(ls) > 0 {
+		fmt.Fprintf(builder, ` <a href="/reactions?%v">Who reacted</a>`, target)
+	}
+	builder.WriteString(`</div>`)
+}
+
+func RenderReactionList(ls []core.Like) string {
+	builder := &strings.Builder{}
+	rs := GetReactions()
+
+	builder.WriteString(`<table>`)
+
+	if len(ls) == 0 {
+		builder.WriteString(`<tr><td>Nobody reacted yet</td></tr>`)
+	}
+
+	for _, l := range ls {
+		label := html.EscapeString(l.Kind)
+		if r := core.FindReaction(rs, l.Kind); r != nil {
+			label = r.Emoji + " " + label
+		}
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">%v</td>`, UserLink(l.Author))
+		fmt.Fprintf(builder, `<td>%v</td>`, label)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// RenderSnippet escapes a search snippet and highlights its matched terms.
+func RenderSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, core.SnippetOpen, `<mark>`)
+	escaped = strings.ReplaceAll(escaped, core.SnippetClose, `</mark>`)
+
+	return escaped
+}
+
+func searchUrl(query string, kind core.SearchKind, offset int) string {
+	values := url.Values{}
+	values.Set("q", query)
+	values.Set("kind", kind.String())
+	if offset != 0 {
+		values.Set("offset", fmt.Sprint(offset))
+	}
+
+	return "/search?" + values.Encode()
+}
+
+// RenderSearch renders the search form and a page of hits, next is the
+// offset of the following page or 0.
+func RenderSearch(query string, kind core.SearchKind, hits []core.SearchHit, offset int, next int) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<form action="/search" method="GET">`)
+	fmt.Fprintf(builder, `<input type="search" name="q" value="%v"></input>`, html.EscapeString(query))
+	fmt.Fprintf(builder, `<input type="hidden" name="kind" value="%v"></input>`, kind)
+	builder.WriteString(`<input type="submit" value="Search"></input>`)
+	builder.WriteString(`</form>`)
+
+	builder.WriteString(`<nav>`)
+	for _, k := range core.SearchKinds {
+		if k == kind {
+			fmt.Fprintf(builder, `<b>%v</b> `, k)
+		} else {
+			fmt.Fprintf(builder, `<a href="%v">%v</a> `, html.EscapeString(searchUrl(query, k, 0)), k)
+		}
+	}
+	builder.WriteString(`</nav>`)
+
+	if strings.TrimSpace(query) == "" {
+		return builder.String()
+	}
+
+	builder.WriteString(`<table>`)
+
+	if len(hits) == 0 {
+		builder.WriteString(`<tr><td>Nothing found</td></tr>`)
+	}
+
+	for _, hit := range hits {
+		builder.WriteString(`<tr>`)
+		switch {
+		case hit.User != nil:
+			fmt.Fprintf(builder, `<td class="rowname">%v</td>`, UserLink(hit.User))
+		case hit.Post != nil:
+			fmt.Fprintf(builder, `<td class="rowname"><a href="/post?id=%v">Post by</a> %v</td>`, hit.Post.Id, UserLink(hit.Post.Author))
+		case hit.Comment != nil:
+			fmt.Fprintf(builder, `<td class="rowname"><a href="/comment?id=%v">Comment by</a> %v</td>`, hit.Comment.Id, UserLink(hit.Comment.Author))
+		}
+		fmt.Fprintf(builder, `<td class="post"><code><pre>%v</pre></code></td>`, RenderSnippet(hit.Snippet))
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	builder.WriteString(`<p>`)
+	if offset != 0 {
+		fmt.Fprintf(builder, `<a href="%v">First page</a> `, html.EscapeString(searchUrl(query, kind, 0)))
+	}
+	if next != 0 {
+		fmt.Fprintf(builder, `<a href="%v">Next page</a>`, html.EscapeString(searchUrl(query, kind, next)))
+	}
+	builder.WriteString(`</p>`)
+
+	return builder.String()
+}
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func TagUrl(tag string) string {
+	return "/tag?name=" + url.QueryEscape(tag)
+}
+
+func TagFeedUrl(tag string) string {
+	return "/tag/" + url.PathEscape(tag) + "/feed.atom"
+}
+
+func RenderTrendingTags(ts []core.TrendingTag) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<table>`)
+
+	if len(ts) == 0 {
+		builder.WriteString(`<tr><td>Nothing is trending right now</td></tr>`)
+	}
+
+	for _, t := range ts {
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname"><a href="%v">#%v</a></td>`, html.EscapeString(TagUrl(t.Name)), html.EscapeString(t.Name))
+		fmt.Fprintf(builder, `<td>%v posts, score %.2f</td>`, t.Posts, t.Score)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// RenderWebhooks lists hs with their buttons. The admin page shows owners,
+// and its buttons only disable and enable webhooks.
+func RenderWebhooks(hs []core.Webhook, admin bool) string {
+	builder := &strings.Builder{}
+
+	actionPrefix := ""
+	if admin {
+		builder.WriteString(adminNav)
+		actionPrefix = "/admin"
+	}
+
+	builder.WriteString(`<h2>Webhooks</h2>`)
+	builder.WriteString(`<table>`)
+
+	if len(hs) == 0 {
+		builder.WriteString(`<tr><td>No webhooks</td></tr>`)
+	}
+
+	for i := range hs {
+		h := &hs[i]
+
+		names := []string{}
+		for _, e := range h.Events {
+			names = append(names, e.String())
+		}
+
+		state := "Enabled"
+		if h.Disabled {
+			state = fmt.Sprintf(`<span class="error">Disabled after %v failures</span>`, h.Failures)
+		} else if h.Failures != 0 {
+			state = fmt.Sprintf("Enabled, %v failures in a row", h.Failures)
+		}
+
+		builder.WriteString(`<tr>`)
+		builder.WriteString(`<td class="rowname">`)
+		if admin {
+			fmt.Fprintf(builder, `%v<br></br>`, UserLink(h.Owner))
+		}
+		fmt.Fprintf(builder, `%v<br></br>%v</td>`, html.EscapeString(h.Url), strings.Join(names, ", "))
+
+		fmt.Fprintf(builder, `<td>%v<br></br>Created %v`, state, h.CreatedAt.Format(timeLayout))
+		if !admin {
+			fmt.Fprintf(builder, `<br></br>Secret <code>%v</code>`, html.EscapeString(h.Secret))
+		}
+		builder.WriteString(`</td>`)
+
+		builder.WriteString(`<td>`)
+		fmt.Fprintf(builder, `<a href="/settings/webhooks/deliveries?id=%v">Deliveries</a>`, h.Id)
+		if h.Disabled {
+			fmt.Fprintf(builder, `<form action="%v/do_set_webhook_enabled?id=%v&enabled=1" method="POST">`, actionPrefix, h.Id)
+			builder.WriteString(`<input type="submit" value="Enable"></input>`)
+		} else {
+			fmt.Fprintf(builder, `<form action="%v/do_set_webhook_enabled?id=%v&enabled=0" method="POST">`, actionPrefix, h.Id)
+			builder.WriteString(`<input type="submit" value="Disable"></input>`)
+		}
+		builder.WriteString(`</form>`)
+		if !admin {
+			fmt.Fprintf(builder, `<form action="/do_test_webhook?id=%v" method="POST">`, h.Id)
+			builder.WriteString(`<input type="submit" value="Send test event"></input>`)
+			builder.WriteString(`</form>`)
+			fmt.Fprintf(builder, `<form action="/do_delete_webhook?id=%v" method="POST">`, h.Id)
+			builder.WriteString(`<input type="submit" value="Delete"></input>`)
+			builder.WriteString(`</form>`)
+		}
+		builder.WriteString(`</td>`)
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
+
+// RenderWebhookForm renders the form adding a webhook and how to check
+// the deliveries it gets.
+func RenderWebhookForm() string {
+	builder := &strings.Builder{}
+
+	builder.WriteString(`<h2>New webhook</h2>`)
+	builder.WriteString(`<form action="/do_create_webhook" method="POST">`)
+	builder.WriteString(`<label for="url">URL:</label>`)
+	builder.WriteString(`<input type="text" id="url" name="url"></input> <br></br>`)
+	for _, e := range core.WebhookEvents {
+		fmt.Fprintf(builder, `<input type="checkbox" id="event_%v" name="event" value="%v" checked></input>`, int(e), e)
+		fmt.Fprintf(builder, `<label for="event_%v">%v</label><br></br>`, int(e), e)
+	}
+	builder.WriteString(`<input type="submit" value="Add"></input>`)
+	builder.WriteString(`</form>`)
+
+	builder.WriteString(`<p>Every delivery is a JSON POST with the headers X-Socnet-Event, X-Socnet-Delivery and `)
+	builder.WriteString(`X-Socnet-Signature: t=&lt;unix time&gt;,v1=&lt;signature&gt;. The signature is the hex HMAC-SHA256, `)
+	builder.WriteString(`keyed by the secret of the webhook, of the time, a dot and the body. `)
+	builder.WriteString(`Answer with a 2xx status, failed deliveries are retried a few times and too many failures disable the webhook.</p>`)
+
+	return builder.String()
+}
+
+// RenderWebhookDeliveries lists the deliveries ds of h.
+func RenderWebhookDeliveries(h *core.Webhook, ds []core.WebhookDelivery) string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, `<h2>Deliveries to %v</h2>`, html.EscapeString(h.Url))
+	builder.WriteString(`<table>`)
+
+	if len(ds) == 0 {
+		builder.WriteString(`<tr><td>No deliveries</td></tr>`)
+	}
+
+	for i := range ds {
+		d := &ds[i]
+
+		result := ""
+		switch {
+		case d.Status == core.DeliveryDelivered:
+			result = fmt.Sprintf("Delivered %v, answered %v", d.DeliveredAt.Format(timeLayout), d.ResponseCode)
+		case d.Status == core.DeliveryPending && d.Attempts == 0:
+			result = "Not attempted yet"
+		case d.Status == core.DeliveryPending:
+			result = fmt.Sprintf("%v<br></br>Next attempt %v", html.EscapeString(d.Error), d.NextAttemptAt.Format(timeLayout))
+		default:
+			result = fmt.Sprintf("Given up: %v", html.EscapeString(d.Error))
+		}
+
+		builder.WriteString(`<tr>`)
+		fmt.Fprintf(builder, `<td class="rowname">#%v %v<br></br>%v<br></br>%v attempts</td>`, d.Id, d.Event, d.CreatedAt.Format(timeLayout), d.Attempts)
+		fmt.Fprintf(builder, `<td>%v<br></br><code><pre>%v</pre></code></td>`, result, html.EscapeString(string(d.Payload)))
+		builder.WriteString(`</tr>`)
+	}
+
+	builder.WriteString(`</table>`)
+
+	return builder.String()
+}
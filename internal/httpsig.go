@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	actorKeyBits = 2048
+	// signatureMaxSkew is how far the Date of a signed request may be from
+	// now, older requests are taken for replays.
+	signatureMaxSkew = 12 * time.Hour
+)
+
+// signedHeaders are the headers covered by the signatures of outgoing
+// requests, and at least what incoming ones must cover.
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// NewActorKeyPair returns a new RSA key pair, PEM encoded.
+func NewActorKeyPair() (privatePem string, publicPem string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, actorKeyBits)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to generate actor key due to %v\n", err)
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to encode actor key due to %v\n", err)
+	}
+
+	privatePem = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	publicPem = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	return privatePem, publicPem, nil
+}
+
+func parsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("No PEM block in private key")
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// parsePublicKey reads an RSA public key in PKIX or PKCS #1 form, servers
+// publish either.
+func parsePublicKey(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("No PEM block in public key")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Public key is a %T, not RSA", key)
+	}
+
+	return rsaKey, nil
+}
+
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signingString is what the signature over headers of r covers.
+func signingString(r *http.Request, headers []string) (string, error) {
+	lines := []string{}
+	for _, h := range headers {
+		value := ""
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			value = r.Host
+			if value == "" {
+				value = r.URL.Host
+			}
+		default:
+			values := r.Header.Values(h)
+			if len(values) == 0 {
+				return "", fmt.Errorf("Signed header %v is missing", h)
+			}
+			value = strings.Join(values, ", ")
+		}
+
+		lines = append(lines, h+": "+value)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// SignRequest adds Date, Digest of body and a Signature to r with the
+// rsa-sha256 algorithm of the HTTP Signatures draft, as keyId.
+func SignRequest(r *http.Request, body []byte, keyId string, privatePem string, now time.Time) error {
+	key, err := parsePrivateKey(privatePem)
+	if err != nil {
+		return fmt.Errorf("Failed to parse key %v due to %v\n", keyId, err)
+	}
+
+	r.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	r.Header.Set("Digest", bodyDigest(body))
+
+	s, err := signingString(r, signedHeaders)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(s))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return fmt.Errorf("Failed to sign with %v due to %v\n", keyId, err)
+	}
+
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%v",algorithm="rsa-sha256",headers="%v",signature="%v"`,
+		keyId, strings.Join(signedHeaders, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// RequestSignature is the parsed Signature header of a request.
+type RequestSignature struct {
+	KeyId     string
+	Algorithm string
+	Headers   []string
+	Signature []byte
+}
+
+// ParseSignature reads the Signature header of r, requiring it to cover
+// the signedHeaders.
+func ParseSignature(r *http.Request) (*RequestSignature, error) {
+	header := r.Header.Get("Signature")
+	if header == "" {
+		return nil, fmt.Errorf("The request is not signed")
+	}
+
+	params := map[string]string{}
+	for _, param := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Malformed signature parameter %q", param)
+		}
+
+		params[parts[0]] = strings.Trim(parts[1], `"`)
+	}
+
+	sig := &RequestSignature{KeyId: params["keyId"], Algorithm: params["algorithm"], Headers: []string{"date"}}
+	if h := params["headers"]; h != "" {
+		sig.Headers = strings.Fields(strings.ToLower(h))
+	}
+
+	// hs2019 leaves the algorithm to the key, which is always RSA here.
+	if sig.Algorithm != "" && sig.Algorithm != "rsa-sha256" && sig.Algorithm != "hs2019" {
+		return nil, fmt.Errorf("Unsupported signature algorithm %v", sig.Algorithm)
+	}
+
+	if sig.KeyId == "" {
+		return nil, fmt.Errorf("The signature has no keyId")
+	}
+
+	for _, required := range signedHeaders {
+		covered := false
+		for _, h := range sig.Headers {
+			covered = covered || h == required
+		}
+
+		if !covered {
+			return nil, fmt.Errorf("The signature does not cover %v", required)
+		}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed signature: %v", err)
+	}
+
+	sig.Signature = signature
+	return sig, nil
+}
+
+// VerifyRequestSignature checks sig of r with body against the key in
+// publicPem, along with the Digest and the Date it covers.
+func VerifyRequestSignature(r *http.Request, body []byte, sig *RequestSignature, publicPem string, now time.Time) error {
+	if digest := r.Header.Get("Digest"); digest != bodyDigest(body) {
+		return fmt.Errorf("The digest %q does not match the body", digest)
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("Malformed date: %v", err)
+	}
+
+	if date.Before(now.Add(-signatureMaxSkew)) || date.After(now.Add(signatureMaxSkew)) {
+		return fmt.Errorf("The request is dated %v", date)
+	}
+
+	key, err := parsePublicKey(publicPem)
+	if err != nil {
+		return fmt.Errorf("Failed to parse key %v: %v", sig.KeyId, err)
+	}
+
+	s, err := signingString(r, sig.Headers)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(s))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig.Signature); err != nil {
+		return fmt.Errorf("The signature does not match key %v", sig.KeyId)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	subscriptionBufferSize = 64
+)
+
+type subscription struct {
+	hub    *hub
+	userId int
+	events chan core.Event
+	closed bool
+}
+
+func (s *subscription) Events() <-chan core.Event {
+	return s.events
+}
+
+func (s *subscription) Close() {
+	s.hub.remove(s)
+}
+
+type hub struct {
+	mutex       sync.Mutex
+	subscribers map[int]map[*subscription]struct{}
+}
+
+func (h *hub) Subscribe(u *core.User) core.Subscription {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := &subscription{hub: h, userId: u.Id, events: make(chan core.Event, subscriptionBufferSize)}
+	if h.subscribers[u.Id] == nil {
+		h.subscribers[u.Id] = map[*subscription]struct{}{}
+	}
+	h.subscribers[u.Id][s] = struct{}{}
+
+	return s
+}
+
+// removeLocked must be called with h.mutex held.
+func (h *hub) removeLocked(s *subscription) {
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+	close(s.events)
+
+	delete(h.subscribers[s.userId], s)
+	if len(h.subscribers[s.userId]) == 0 {
+		delete(h.subscribers, s.userId)
+	}
+}
+
+func (h *hub) remove(s *subscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.removeLocked(s)
+}
+
+func (h *hub) Publish(userIds []int, e core.Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, userId := range userIds {
+		for s := range h.subscribers[userId] {
+			select {
+			case s.events <- e:
+			default:
+				// The client is too slow; dropping it makes it reconnect and
+				// resume from the last message it has seen.
+				log.Printf("Dropping slow subscriber of user %v\n", userId)
+				h.removeLocked(s)
+			}
+		}
+	}
+}
+
+func NewHub() core.Hub {
+	return &hub{subscribers: map[int]map[*subscription]struct{}{}}
+}
+
+type eventUser struct {
+	Id    int    `json:"id"`
+	Login string `json:"login"`
+}
+
+type messageEvent struct {
+	Id           int       `json:"id"`
+	Conversation int       `json:"conversation"`
+	Author       eventUser `json:"author"`
+	Content      string    `json:"content"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type typingEvent struct {
+	Conversation int       `json:"conversation"`
+	User         eventUser `json:"user"`
+}
+
+func NewMessageEvent(m *core.Message) core.Event {
+	data, err := json.Marshal(messageEvent{
+		Id:           m.Id,
+		Conversation: m.Conversation.Id,
+		Author:       eventUser{Id: m.Author.Id, Login: m.Author.Login},
+		Content:      string(m.Content),
+		CreatedAt:    m.CreatedAt,
+	})
+
+	if err != nil {
+		log.Printf("Failed to marshal message %v: %v\n", m.Id, err)
+	}
+
+	return core.Event{Id: m.Id, Type: "message", Data: data}
+}
+
+func NewTypingEvent(c *core.Conversation, u *core.User) core.Event {
+	data, err := json.Marshal(typingEvent{
+		Conversation: c.Id,
+		User:         eventUser{Id: u.Id, Login: u.Login},
+	})
+
+	if err != nil {
+		log.Printf("Failed to marshal typing event: %v\n", err)
+	}
+
+	return core.Event{Type: "typing", Data: data}
+}
+
+// WriteEvent writes e in the Server-Sent Events format.
+func WriteEvent(w io.Writer, e core.Event) {
+	if e.Id != 0 {
+		fmt.Fprintf(w, "id: %v\n", e.Id)
+	}
+
+	fmt.Fprintf(w, "event: %v\n", e.Type)
+	fmt.Fprintf(w, "data: %s\n\n", e.Data)
+}
+
+// WriteMessagesJson writes ms as a JSON array of message events, it serves
+// clients that cannot keep an event stream open and poll instead.
+func WriteMessagesJson(w io.Writer, ms []core.Message) error {
+	events := make([]messageEvent, 0, len(ms))
+	for i := range ms {
+		m := &ms[i]
+		events = append(events, messageEvent{
+			Id:           m.Id,
+			Conversation: m.Conversation.Id,
+			Author:       eventUser{Id: m.Author.Id, Login: m.Author.Login},
+			Content:      string(m.Content),
+			CreatedAt:    m.CreatedAt,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(events)
+}
+
+// ConversationMemberIds lists ids of members of c except the one with exceptId.
+func ConversationMemberIds(c *core.Conversation, exceptId int) []int {
+	ids := []int{}
+	for _, member := range c.Members {
+		if member.User.Id != exceptId {
+			ids = append(ids, member.User.Id)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// formatMail renders m as an RFC 5322 message.
+func formatMail(from string, m *core.Mail) []byte {
+	buffer := &bytes.Buffer{}
+
+	fmt.Fprintf(buffer, "From: %v\r\n", from)
+	fmt.Fprintf(buffer, "To: %v\r\n", m.To)
+	fmt.Fprintf(buffer, "Subject: %v\r\n", m.Subject)
+	fmt.Fprintf(buffer, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+
+	keys := make([]string, 0, len(m.Headers))
+	for key := range m.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(buffer, "%v: %v\r\n", key, m.Headers[key])
+	}
+
+	buffer.WriteString("\r\n")
+	buffer.Write(bytes.ReplaceAll(m.Body, []byte("\n"), []byte("\r\n")))
+
+	return buffer.Bytes()
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(mail *core.Mail) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{mail.To}, formatMail(m.from, mail))
+}
+
+// maildirMailer delivers into a local maildir, it is meant for development
+// and tests where no SMTP server is available.
+type maildirMailer struct {
+	path    string
+	from    string
+	counter atomic.Uint64
+}
+
+func (m *maildirMailer) Send(mail *core.Mail) error {
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(m.path, dir), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	name := fmt.Sprintf("%v.%v_%v.%v", time.Now().Unix(), os.Getpid(), m.counter.Add(1), hostname)
+
+	// Maildir readers only look into new, so the file appears there atomically.
+	tmpPath := filepath.Join(m.path, "tmp", name)
+	err := os.WriteFile(tmpPath, formatMail(m.from, mail), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(m.path, "new", name))
+}
+
+// NewMailer creates the mailer selected by MAILER, which is either "smtp"
+// (configured by SMTP_ADDR, SMTP_USER and SMTP_PASSWORD) or "maildir"
+// (delivering into MAILDIR_PATH). It returns nil if MAILER is empty.
+func NewMailer() core.Mailer {
+	kind := os.Getenv("MAILER")
+	log.Printf("MAILER=%v\n", kind)
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "socnet@localhost"
+	}
+
+	switch kind {
+	case "":
+		return nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			log.Fatalf("SMTP_ADDR is empty\n")
+		}
+
+		var auth smtp.Auth
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			host := strings.Split(addr, ":")[0]
+			auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+
+		return &smtpMailer{addr: addr, from: from, auth: auth}
+	case "maildir":
+		path := os.Getenv("MAILDIR_PATH")
+		if path == "" {
+			log.Fatalf("MAILDIR_PATH is empty\n")
+		}
+
+		return &maildirMailer{path: path, from: from}
+	}
+
+	log.Fatalf("Unknown MAILER %v\n", kind)
+	return nil
+}
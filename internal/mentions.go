@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"log"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// Mention resolves the @logins in content, written by author in post p or
+// in its comment commentId if that is not 0, stores them and notifies the
+// newly mentioned users who may see p. Unknown logins are ignored and,
+// like with notifications, failures are only logged.
+func Mention(db core.Database, author *core.User, p *core.Post, commentId int, content []byte) {
+	users := []*core.User{}
+	for _, login := range core.ExtractMentions(content) {
+		u, err := db.FindUser(login)
+		if err != nil || u == nil {
+			continue
+		}
+
+		users = append(users, u)
+	}
+
+	added, err := db.SetMentions(author, p.Id, commentId, users)
+	if err != nil {
+		log.Printf("Failed to store mentions in %v/%v: %v\n", p.Id, commentId, err)
+		return
+	}
+
+	for _, u := range added {
+		if !CanViewPost(u, p, db) {
+			continue
+		}
+
+		Notify(db, &core.Notification{
+			Recipient: u,
+			Actor:     author,
+			Kind:      core.NotificationMention,
+			PostId:    p.Id,
+			CommentId: commentId,
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"log"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// Notify records n unless its recipient is its actor or has opted out of its
+// kind. Failures are only logged: a notification must never break the
+// operation that caused it.
+func Notify(db core.Database, n *core.Notification) {
+	if n.Recipient.Id == n.Actor.Id || Hides(n.Recipient, n.Actor, db) {
+		return
+	}
+
+	optOuts, err := db.GetNotificationOptOuts(n.Recipient)
+	if err != nil {
+		log.Printf("Failed to load notification opt-outs of %v: %v\n", n.Recipient.Id, err)
+		return
+	}
+
+	for _, k := range optOuts {
+		if k == n.Kind {
+			return
+		}
+	}
+
+	err = db.CreateNotification(n)
+	if err != nil {
+		log.Printf("Failed to notify %v about %v: %v\n", n.Recipient.Id, n.Kind, err)
+	}
+}
+
+// NotifyMany sends a copy of n to each of recipients.
+func NotifyMany(db core.Database, recipients []*core.User, n core.Notification) {
+	for _, recipient := range recipients {
+		one := n
+		one.Recipient = recipient
+		Notify(db, &one)
+	}
+}
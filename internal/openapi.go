@@ -0,0 +1,566 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// ApiOperation describes one endpoint of the API for its OpenAPI document.
+// Request and Response are zero values of the types the endpoint reads and
+// writes, nil when there is no body.
+type ApiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+
+	// Endpoints with Auth need a bearer token, the others take an
+	// optional one. Personal access tokens need Scope.
+	Auth  bool
+	Scope core.Scope
+
+	Request         any
+	RequestOptional bool
+
+	// Status is the status of success, 200 when not set. Paged endpoints
+	// write a page of Response, the others {"data": Response}.
+	Status   int
+	Response any
+	Paged    bool
+
+	// Errors are the error statuses beyond those every endpoint of its
+	// kind may answer with.
+	Errors []int
+}
+
+// ApiSchema is the subset of the OpenAPI schema object the API needs.
+type ApiSchema struct {
+	Ref        string                `json:"$ref,omitempty"`
+	Type       string                `json:"type,omitempty"`
+	Format     string                `json:"format,omitempty"`
+	Enum       []string              `json:"enum,omitempty"`
+	Properties map[string]*ApiSchema `json:"properties,omitempty"`
+	Required   []string              `json:"required,omitempty"`
+	Items      *ApiSchema            `json:"items,omitempty"`
+
+	// AdditionalProperties is a *ApiSchema for maps and false for
+	// requests, which may not have unknown fields.
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+}
+
+const apiSchemaPrefix = "#/components/schemas/"
+
+type apiOperationSchemas struct {
+	request         *ApiSchema
+	requestOptional bool
+
+	// responses maps statuses to the schemas of their bodies, nil for
+	// statuses without a body.
+	responses map[int]*ApiSchema
+}
+
+// OpenApi is the OpenAPI 3 document of the API, generated from its
+// operations and the Go types they read and write.
+type OpenApi struct {
+	base       string
+	document   []byte
+	components map[string]*ApiSchema
+	operations map[string]*apiOperationSchemas
+}
+
+func apiOperationKey(method string, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// apiEnums lists the values of fields tagged with enum.
+func apiEnums(name string) []string {
+	values := []string{}
+	switch name {
+	case "visibility":
+		for _, v := range core.Visibilities {
+			values = append(values, v.String())
+		}
+	case "reaction":
+		for _, r := range GetReactions() {
+			values = append(values, r.Name)
+		}
+	}
+
+	return values
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes t, adding the named structs it meets to the
+// components. Structs of requests are closed to unknown fields.
+func (o *OpenApi) schemaOf(t reflect.Type, request bool) *ApiSchema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return o.schemaOf(t.Elem(), request)
+	case reflect.Bool:
+		return &ApiSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &ApiSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &ApiSchema{Type: "number"}
+	case reflect.String:
+		return &ApiSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &ApiSchema{Type: "array", Items: o.schemaOf(t.Elem(), request)}
+	case reflect.Map:
+		return &ApiSchema{Type: "object", AdditionalProperties: o.schemaOf(t.Elem(), request)}
+	case reflect.Struct:
+		if t == timeType {
+			return &ApiSchema{Type: "string", Format: "date-time"}
+		}
+
+		if _, found := o.components[t.Name()]; !found {
+			// Reserve the name first, the struct may refer to itself.
+			o.components[t.Name()] = nil
+			o.components[t.Name()] = o.structSchema(t, request)
+		}
+
+		return &ApiSchema{Ref: apiSchemaPrefix + t.Name()}
+	}
+
+	return &ApiSchema{}
+}
+
+func (o *OpenApi) structSchema(t reflect.Type, request bool) *ApiSchema {
+	s := &ApiSchema{Type: "object", Properties: map[string]*ApiSchema{}}
+	if request {
+		s.AdditionalProperties = false
+	}
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || !f.IsExported() {
+				continue
+			}
+
+			// Embedded structs add their fields, as they do in JSON.
+			if f.Anonymous && tag == "" {
+				addFields(f.Type)
+				continue
+			}
+
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+
+			fs := o.schemaOf(f.Type, request)
+			if enum := f.Tag.Get("enum"); enum != "" {
+				fs.Enum = apiEnums(enum)
+			}
+
+			s.Properties[name] = fs
+			if !strings.Contains(options, "omitempty") {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	return s
+}
+
+func apiErrorSchema() *ApiSchema {
+	return &ApiSchema{
+		Type:       "object",
+		Properties: map[string]*ApiSchema{"error": {Ref: apiSchemaPrefix + "ApiError"}},
+		Required:   []string{"error"},
+	}
+}
+
+// NewOpenApi generates the document of ops, which are served under base.
+func NewOpenApi(title string, version string, base string, ops []ApiOperation) (*OpenApi, error) {
+	o := &OpenApi{
+		base:       base,
+		components: map[string]*ApiSchema{},
+		operations: map[string]*apiOperationSchemas{},
+	}
+	o.schemaOf(reflect.TypeOf(ApiError{}), false)
+
+	paths := map[string]map[string]any{}
+	for _, op := range ops {
+		key := apiOperationKey(op.Method, op.Path)
+		if _, found := o.operations[key]; found {
+			return nil, fmt.Errorf("Operation %v is described twice", key)
+		}
+
+		schemas := &apiOperationSchemas{requestOptional: op.RequestOptional, responses: map[int]*ApiSchema{}}
+		o.operations[key] = schemas
+
+		document := map[string]any{
+			"summary":     op.Summary,
+			"description": fmt.Sprintf("Personal access tokens need the %v scope.", op.Scope),
+		}
+
+		if op.Auth {
+			document["security"] = []map[string][]string{{"bearer": {}}}
+		} else {
+			document["security"] = []map[string][]string{{}, {"bearer": {}}}
+		}
+
+		parameters := []map[string]any{}
+		if strings.Contains(op.Path, "{id}") {
+			parameters = append(parameters, map[string]any{
+				"name": "id", "in": "path", "required": true, "schema": &ApiSchema{Type: "integer"},
+			})
+		}
+
+		if op.Paged {
+			parameters = append(parameters,
+				map[string]any{
+					"name": "cursor", "in": "query", "schema": &ApiSchema{Type: "string"},
+					"description": "The next_cursor of the previous page, left out for the first page.",
+				},
+				map[string]any{
+					"name": "limit", "in": "query", "schema": &ApiSchema{Type: "integer"},
+					"description": "How many items the page has at most, 1 to 100.",
+				})
+		}
+
+		if len(parameters) != 0 {
+			document["parameters"] = parameters
+		}
+
+		if op.Request != nil {
+			schemas.request = o.schemaOf(reflect.TypeOf(op.Request), true)
+			document["requestBody"] = map[string]any{
+				"required": !op.RequestOptional,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemas.request}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if op.Response != nil {
+			s := o.schemaOf(reflect.TypeOf(op.Response), false)
+			if op.Paged {
+				schemas.responses[status] = &ApiSchema{
+					Type: "object",
+					Properties: map[string]*ApiSchema{
+						"data":        {Type: "array", Items: s},
+						"next_cursor": {Type: "string"},
+					},
+					Required: []string{"data"},
+				}
+			} else {
+				schemas.responses[status] = &ApiSchema{
+					Type:       "object",
+					Properties: map[string]*ApiSchema{"data": s},
+					Required:   []string{"data"},
+				}
+			}
+		} else {
+			schemas.responses[status] = nil
+		}
+
+		// Every endpoint refuses bad tokens and tokens without its scope
+		// and may fail, and those that read something may be given
+		// something wrong.
+		errors := []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError}
+		if op.Request != nil || op.Paged || strings.Contains(op.Path, "{") {
+			errors = append(errors, http.StatusBadRequest)
+		}
+		if strings.Contains(op.Path, "{") {
+			errors = append(errors, http.StatusNotFound)
+		}
+
+		for _, e := range append(errors, op.Errors...) {
+			schemas.responses[e] = apiErrorSchema()
+		}
+
+		responses := map[string]any{}
+		for s, schema := range schemas.responses {
+			response := map[string]any{"description": http.StatusText(s)}
+			if schema != nil {
+				response["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+			}
+
+			responses[fmt.Sprint(s)] = response
+		}
+		document["responses"] = responses
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = document
+	}
+
+	var err error
+	o.document, err = json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": title, "version": version},
+		"servers": []map[string]any{{"url": base}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": o.components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A session token from POST /sessions, or a personal access token made in the settings.",
+				},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode the OpenAPI document due to %v\n", err)
+	}
+
+	return o, nil
+}
+
+// Document is the document as JSON.
+func (o *OpenApi) Document() []byte {
+	return o.document
+}
+
+// CheckRoutes tells which of routes, the method and the path of each, have
+// no operation in the document and which operations have no route.
+func (o *OpenApi) CheckRoutes(routes []string) error {
+	problems := []string{}
+
+	routed := map[string]bool{}
+	for _, route := range routes {
+		routed[route] = true
+		if o.operations[route] == nil {
+			problems = append(problems, fmt.Sprintf("route %v is not in the document", route))
+		}
+	}
+
+	for key := range o.operations {
+		if !routed[key] {
+			problems = append(problems, fmt.Sprintf("operation %v has no route", key))
+		}
+	}
+
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("The API does not match its OpenAPI document: %v", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// validate tells how v, decoded from JSON, does not match s.
+func (o *OpenApi) validate(s *ApiSchema, v any, at string) []string {
+	if s.Ref != "" {
+		component := o.components[strings.TrimPrefix(s.Ref, apiSchemaPrefix)]
+		if component == nil {
+			return []string{fmt.Sprintf("%v: unknown schema %v", at, s.Ref)}
+		}
+
+		return o.validate(component, v, at)
+	}
+
+	mismatch := func() []string {
+		return []string{fmt.Sprintf("%v: %v is not %v", at, v, s.Type)}
+	}
+
+	problems := []string{}
+	switch s.Type {
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return mismatch()
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return mismatch()
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%v: %q is not a date-time", at, str))
+			}
+		}
+
+		if len(s.Enum) != 0 {
+			known := false
+			for _, e := range s.Enum {
+				known = known || e == str
+			}
+
+			if !known {
+				problems = append(problems, fmt.Sprintf("%v: %q is not one of %v", at, str, s.Enum))
+			}
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return mismatch()
+		}
+
+		for i, item := range items {
+			problems = append(problems, o.validate(s.Items, item, fmt.Sprintf("%v[%v]", at, i))...)
+		}
+	case "object":
+		fields, ok := v.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+
+		for _, name := range s.Required {
+			if _, found := fields[name]; !found {
+				problems = append(problems, fmt.Sprintf("%v: %v is missing", at, name))
+			}
+		}
+
+		for name, value := range fields {
+			if fs, found := s.Properties[name]; found {
+				problems = append(problems, o.validate(fs, value, at+"."+name)...)
+				continue
+			}
+
+			switch additional := s.AdditionalProperties.(type) {
+			case *ApiSchema:
+				problems = append(problems, o.validate(additional, value, at+"."+name)...)
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%v: %v is unknown", at, name))
+				}
+			default:
+				if s.Properties != nil {
+					problems = append(problems, fmt.Sprintf("%v: %v is unknown", at, name))
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateBody tells how the JSON body does not match s.
+func (o *OpenApi) validateBody(s *ApiSchema, body []byte, at string) []string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []string{fmt.Sprintf("%v is not JSON: %v", at, err)}
+	}
+
+	return o.validate(s, v, at)
+}
+
+// Check tells how an exchange with the operation of method and path, the
+// route pattern under the base, does not match the document. Requests the
+// document does not allow must be refused.
+func (o *OpenApi) Check(method string, path string, request []byte, status int, response []byte) []string {
+	op := o.operations[apiOperationKey(method, path)]
+	if op == nil {
+		return []string{fmt.Sprintf("%v %v is not in the document", method, path)}
+	}
+
+	requestProblems := []string{}
+	if op.request == nil && len(request) != 0 {
+		requestProblems = append(requestProblems, "request has a body")
+	} else if op.request != nil && len(request) == 0 && !op.requestOptional {
+		requestProblems = append(requestProblems, "request has no body")
+	} else if op.request != nil && len(request) != 0 {
+		requestProblems = o.validateBody(op.request, request, "request")
+	}
+
+	problems := []string{}
+	if len(requestProblems) != 0 && status < 400 {
+		problems = append(problems, fmt.Sprintf("accepted a request the document does not allow: %v", strings.Join(requestProblems, ", ")))
+	}
+
+	s, declared := op.responses[status]
+	switch {
+	case !declared:
+		problems = append(problems, fmt.Sprintf("status %v is not in the document", status))
+	case s == nil && len(response) != 0:
+		problems = append(problems, fmt.Sprintf("status %v has a body", status))
+	case s != nil:
+		problems = append(problems, o.validateBody(s, response, "response")...)
+	}
+
+	return problems
+}
+
+// apiRecorder keeps what the handler writes, as well as writing it.
+type apiRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *apiRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *apiRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// ApiViolationReport is told of each problem found in an exchange with the
+// API at the route path of the document.
+type ApiViolationReport func(r *http.Request, path string, problem string)
+
+// LogApiViolation logs a problem found by a Validator.
+func LogApiViolation(r *http.Request, path string, problem string) {
+	log.Printf("OpenAPI violation by %v %v: %v\n", r.Method, path, problem)
+}
+
+// Validator returns a middleware for the router of the API which gives
+// report every problem of the exchanges that do not match the document.
+// Requests to routes the document does not know are left to the router.
+func (o *OpenApi) Validator(report ApiViolationReport) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var request []byte
+			if r.Body != nil {
+				var err error
+				request, err = io.ReadAll(io.LimitReader(r.Body, maxApiRequestSize+1))
+				if err != nil {
+					log.Printf("Failed to read the request to %v %v: %v\n", r.Method, r.URL.Path, err)
+				}
+
+				r.Body = io.NopCloser(bytes.NewReader(request))
+			}
+
+			rec := &apiRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			path := strings.TrimPrefix(chi.RouteContext(r.Context()).RoutePattern(), o.base)
+			if o.operations[apiOperationKey(r.Method, path)] == nil {
+				return
+			}
+
+			for _, problem := range o.Check(r.Method, path, request, rec.status, rec.body.Bytes()) {
+				report(r, path, problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	defaultReactions = "like:👍,love:❤️,laugh:😂,wow:😮,sad:😢,angry:😠"
+)
+
+// GetReactions returns the reactions configured by REACTIONS, a comma
+// separated list of name:emoji pairs.
+func GetReactions() []core.Reaction {
+	config := os.Getenv("REACTIONS")
+	if config == "" {
+		config = defaultReactions
+	}
+
+	rs := []core.Reaction{}
+	for _, pair := range strings.Split(config, ",") {
+		name, emoji, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || name == "" || emoji == "" {
+			log.Printf("Ignoring malformed reaction %v\n", pair)
+			continue
+		}
+
+		rs = append(rs, core.Reaction{Name: name, Emoji: emoji})
+	}
+
+	return rs
+}
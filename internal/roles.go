@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// Can tells whether u is granted p, anonymous visitors are granted nothing.
+func Can(u *core.User, p core.Permission) bool {
+	return u != nil && u.Role.Has(p)
+}
+
+// CanModerateUser tells whether staff member u may hide the content of
+// target or suspend them: only users of a lower role are moderated, so that
+// no moderator can lock out an admin.
+func CanModerateUser(u *core.User, target *core.User) bool {
+	return u != nil && u.Id != target.Id && target.Role < u.Role
+}
+
+// RequirePermission is a middleware letting through only requests of users
+// granted p, others get an error page.
+func RequirePermission(p core.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			db := NewDatabase()
+			defer db.Close()
+
+			u, err := GetCurrentUser(r, db)
+			if err == nil && Can(u, p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusForbidden)
+
+			BeginHtml(w, r, db)
+			defer EndHtml(w)
+
+			if err != nil {
+				WriteNotLoggedIn(w)
+				return
+			}
+
+			log.Printf("%v denied to login=%v role=%v\n", r.URL.Path, u.Login, u.Role)
+			WriteErrorString(w, "You are not allowed to see this page")
+		})
+	}
+}
@@ -6,25 +6,79 @@ import (
 	"github.com/JouleJ/socnet/core"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type database struct {
 	impl *sql.DB
 }
 
+// unixTime scans a column of Unix seconds into t, 0 stands for the zero time
+// of rows stored before the column existed.
+type unixTime struct {
+	t *time.Time
+}
+
+func (u unixTime) Scan(value any) error {
+	seconds, ok := value.(int64)
+	if !ok {
+		return fmt.Errorf("Cannot scan %T as Unix time\n", value)
+	}
+
+	*u.t = time.Time{}
+	if seconds != 0 {
+		*u.t = time.Unix(seconds, 0)
+	}
+
+	return nil
+}
+
+// storedTime is the column value of t read back by unixTime, 0 for the
+// zero time.
+func storedTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// userColumns lists the columns of users aliased as u in the order expected by userFields.
+const userColumns = `u.id, u.login, u.password_hash, u.bio, u.visibility, u.message_visibility, u.email, u.digest_frequency, u.suspended, u.role, u.password_reset_required, u.created_at`
+
+func userFields(u *core.User) []any {
+	return []any{&u.Id, &u.Login, &u.PasswordHash, &u.Bio, &u.Visibility, &u.MessageVisibility, &u.Email, &u.DigestFrequency, &u.Suspended, &u.Role, &u.PasswordResetRequired, unixTime{&u.CreatedAt}}
+}
+
+func withUserFields(u *core.User, fields ...any) []any {
+	return append(fields, userFields(u)...)
+}
+
 func (db *database) CreateUser(u *core.User) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+
+	// Accounts can be deleted, so ids come from AUTOINCREMENT and are never
+	// given to a new account that leftover references would point to.
 	query := `
-INSERT INTO users (id, login, password_hash, bio)
-SELECT COUNT(*) + 1, ?, ?, ? FROM users;
+INSERT INTO users (login, password_hash, bio, visibility, message_visibility, email, digest_frequency, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
 `
 
 	result, err := db.impl.Exec(
 		query,
 		u.Login,
 		u.PasswordHash,
-		u.Bio)
+		u.Bio,
+		u.Visibility,
+		u.MessageVisibility,
+		u.Email,
+		u.DigestFrequency,
+		u.CreatedAt.Unix())
 
 	if err != nil {
 		return err
@@ -36,15 +90,24 @@ SELECT COUNT(*) + 1, ?, ?, ? FROM users;
 }
 
 func (db *database) CreatePost(p *core.Post) error {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+
+	// Posts can be deleted, so ids come from AUTOINCREMENT and are never
+	// reused by a new post that reposts of the deleted one would point to.
 	query := `
-INSERT INTO posts (id, author, content) 
-SELECT COUNT(*) + 1, ?, ? FROM posts;
+INSERT INTO posts (author, content, visibility, repost_of, created_at)
+VALUES (?, ?, ?, ?, ?);
 `
 
 	result, err := db.impl.Exec(
 		query,
 		p.Author.Id,
-		p.Content)
+		p.Content,
+		p.Visibility,
+		p.RepostOfId,
+		p.CreatedAt.Unix())
 
 	if err != nil {
 		return err
@@ -56,16 +119,22 @@ SELECT COUNT(*) + 1, ?, ? FROM posts;
 }
 
 func (db *database) CreateComment(c *core.Comment) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+
 	query := `
-INSERT INTO comments (id, author, commented_post, content)
-SELECT COUNT(*) + 1, ?, ?, ? FROM comments;
+INSERT INTO comments (author, commented_post, content, parent_comment, created_at)
+VALUES (?, ?, ?, ?, ?);
 `
 
 	result, err := db.impl.Exec(
 		query,
 		c.Author.Id,
 		c.CommentedPost.Id,
-		c.Content)
+		c.Content,
+		c.ParentId,
+		c.CreatedAt.Unix())
 
 	if err != nil {
 		return err
@@ -76,13 +145,98 @@ SELECT COUNT(*) + 1, ?, ?, ? FROM comments;
 	return err
 }
 
+// likeTarget returns the post and comment columns identifying what l reacts to.
+func likeTarget(l *core.Like) (int, int) {
+	if l.LikedComment != nil {
+		return 0, l.LikedComment.Id
+	}
+
+	return l.LikedPost.Id, 0
+}
+
 func (db *database) CreateLike(l *core.Like) error {
-	return fmt.Errorf("Not yet implemented")
+	postId, commentId := likeTarget(l)
+
+	_, err := db.impl.Exec(
+		`INSERT INTO reactions (author, post, comment, kind) VALUES (?, ?, ?, ?)
+         ON CONFLICT (author, post, comment) DO UPDATE SET kind = excluded.kind;`,
+		l.Author.Id,
+		postId,
+		commentId,
+		l.Kind)
+
+	if err != nil {
+		return err
+	}
+
+	// LastInsertId is unreliable for an upsert that updated.
+	rows, err := db.impl.Query(
+		"SELECT id FROM reactions WHERE author = ? AND post = ? AND comment = ?;",
+		l.Author.Id,
+		postId,
+		commentId)
+
+	if err != nil || rows == nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		rows.Scan(&l.Id)
+	}
+
+	return nil
+}
+
+func (db *database) DeleteLike(l *core.Like) error {
+	postId, commentId := likeTarget(l)
+
+	_, err := db.impl.Exec(
+		"DELETE FROM reactions WHERE author = ? AND post = ? AND comment = ?;",
+		l.Author.Id,
+		postId,
+		commentId)
+
+	return err
+}
+
+func (db *database) getLikes(column string, id int) ([]core.Like, error) {
+	rows, err := db.impl.Query(
+		`SELECT r.id, r.kind, `+userColumns+`
+         FROM reactions AS r
+         INNER JOIN users AS u
+         ON u.id = r.author
+         WHERE r.`+column+` = ?
+         ORDER BY r.id;`,
+		id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list reactions to %v %v due to %v\n", column, id, err)
+	}
+	defer rows.Close()
+
+	ls := []core.Like{}
+	for rows.Next() {
+		l := core.Like{Author: &core.User{}}
+		rows.Scan(withUserFields(l.Author, &l.Id, &l.Kind)...)
+
+		ls = append(ls, l)
+	}
+
+	return ls, nil
+}
+
+func (db *database) GetPostLikes(p *core.Post) ([]core.Like, error) {
+	return db.getLikes("post", p.Id)
+}
+
+func (db *database) GetCommentLikes(c *core.Comment) ([]core.Like, error) {
+	return db.getLikes("comment", c.Id)
 }
 
 func (db *database) LoadUser(id int) (*core.User, error) {
 	rows, err := db.impl.Query(
-		"SELECT login, password_hash, bio FROM users WHERE id = ?;",
+		"SELECT "+userColumns+" FROM users AS u WHERE u.id = ?;",
 		id)
 
 	if err != nil || rows == nil {
@@ -91,9 +245,9 @@ func (db *database) LoadUser(id int) (*core.User, error) {
 
 	defer rows.Close()
 
-	u := &core.User{Id: id}
+	u := &core.User{}
 	if rows.Next() {
-		rows.Scan(&u.Login, &u.PasswordHash, &u.Bio)
+		rows.Scan(userFields(u)...)
 	} else {
 		return nil, fmt.Errorf("Failed to scan rows\n")
 	}
@@ -103,7 +257,7 @@ func (db *database) LoadUser(id int) (*core.User, error) {
 
 func (db *database) LoadPost(id int) (*core.Post, error) {
 	rows, err := db.impl.Query(
-		"SELECT author, content FROM posts WHERE id = ?;",
+		"SELECT author, content, visibility, repost_of, hidden, created_at FROM posts WHERE id = ?;",
 		id)
 
 	if err != nil || rows == nil {
@@ -116,7 +270,7 @@ func (db *database) LoadPost(id int) (*core.Post, error) {
 	if rows.Next() {
 		var authorId int
 
-		rows.Scan(&authorId, &p.Content)
+		rows.Scan(&authorId, &p.Content, &p.Visibility, &p.RepostOfId, &p.Hidden, unixTime{&p.CreatedAt})
 
 		p.Author, err = db.LoadUser(authorId)
 		if err != nil {
@@ -129,9 +283,13 @@ func (db *database) LoadPost(id int) (*core.Post, error) {
 	return p, nil
 }
 
-func (db *database) GetPostsByUser(u *core.User) ([]core.Post, error) {
+func (db *database) GetPostsByUser(viewer *core.User, u *core.User) ([]core.Post, error) {
+	if !CanViewProfile(viewer, u, db) {
+		return []core.Post{}, nil
+	}
+
 	rows, err := db.impl.Query(
-		`SELECT id, content FROM posts WHERE author = ?;`,
+		`SELECT id, content, visibility, repost_of, hidden, created_at FROM posts WHERE author = ?;`,
 		u.Id)
 
 	if err != nil || rows == nil {
@@ -142,9 +300,11 @@ func (db *database) GetPostsByUser(u *core.User) ([]core.Post, error) {
 	ps := []core.Post{}
 	for rows.Next() {
 		p := core.Post{Author: u}
-		rows.Scan(&p.Id, &p.Content)
+		rows.Scan(&p.Id, &p.Content, &p.Visibility, &p.RepostOfId, &p.Hidden, unixTime{&p.CreatedAt})
 
-		ps = append(ps, p)
+		if CanViewPost(viewer, &p, db) {
+			ps = append(ps, p)
+		}
 	}
 
 	return ps, nil
@@ -152,7 +312,7 @@ func (db *database) GetPostsByUser(u *core.User) ([]core.Post, error) {
 
 func (db *database) GetCommentsByPost(p *core.Post) ([]core.Comment, error) {
 	rows, err := db.impl.Query(
-		`SELECT c.id, c.content, u.id, u.login, u.password_hash, u.bio
+		`SELECT c.id, c.content, c.parent_comment, c.hidden, c.created_at, `+userColumns+`
          FROM comments as c
          INNER JOIN users as u
          ON u.id == c.author
@@ -168,13 +328,7 @@ func (db *database) GetCommentsByPost(p *core.Post) ([]core.Comment, error) {
 	for rows.Next() {
 		u := &core.User{}
 		c := core.Comment{CommentedPost: p, Author: u}
-		rows.Scan(
-			&c.Id,
-			&c.Content,
-			&c.Author.Id,
-			&c.Author.Login,
-			&c.Author.PasswordHash,
-			&c.Author.Bio)
+		rows.Scan(withUserFields(c.Author, &c.Id, &c.Content, &c.ParentId, &c.Hidden, unixTime{&c.CreatedAt})...)
 
 		cs = append(cs, c)
 	}
@@ -182,34 +336,40 @@ func (db *database) GetCommentsByPost(p *core.Post) ([]core.Comment, error) {
 	return cs, nil
 }
 
-func (db *database) GetNewestPosts(count int) ([]core.Post, error) {
+func (db *database) GetNewestPosts(viewer *core.User, count int) ([]core.Post, error) {
+	return db.GetPostsPage(viewer, nil, 0, count)
+}
+
+func (db *database) GetPostsPage(viewer *core.User, author *core.User, beforeId int, count int) ([]core.Post, error) {
+	if beforeId == 0 {
+		beforeId = math.MaxInt
+	}
+
+	authorId := 0
+	if author != nil {
+		authorId = author.Id
+	}
+
+	visible, args := visiblePostsClause(viewer, author == nil)
 	rows, err := db.impl.Query(
-		`SELECT p.id, p.content, u.id, u.login, u.password_hash, u.bio
+		`SELECT p.id, p.content, p.visibility, p.repost_of, p.hidden, p.created_at, `+userColumns+`
          FROM posts as p
          INNER JOIN users as u
          ON u.id = p.author
-         ORDER BY p.id DESC;`)
+         WHERE p.id < ? AND (? = 0 OR p.author = ?) AND `+visible+`
+         ORDER BY p.id DESC
+         LIMIT ?;`,
+		append(append([]any{beforeId, authorId, authorId}, args...), count)...)
 
 	if err != nil || rows == nil {
-		return nil, fmt.Errorf("Failed to list %v newst posts due to %v\n", count, err)
+		return nil, fmt.Errorf("Failed to list %v posts before %v due to %v\n", count, beforeId, err)
 	}
 	defer rows.Close()
 
 	ps := make([]core.Post, 0, count)
-	for i := 0; i < count; i++ {
-		if !rows.Next() {
-			break
-		}
-
-		u := &core.User{}
-		p := core.Post{Author: u}
-		rows.Scan(
-			&p.Id,
-			&p.Content,
-			&p.Author.Id,
-			&p.Author.Login,
-			&p.Author.PasswordHash,
-			&p.Author.Bio)
+	for rows.Next() {
+		p := core.Post{Author: &core.User{}}
+		rows.Scan(withUserFields(p.Author, &p.Id, &p.Content, &p.Visibility, &p.RepostOfId, &p.Hidden, unixTime{&p.CreatedAt})...)
 
 		ps = append(ps, p)
 	}
@@ -217,17 +377,109 @@ func (db *database) GetNewestPosts(count int) ([]core.Post, error) {
 	return ps, nil
 }
 
+func (db *database) GetCommentsPage(viewer *core.User, p *core.Post, afterId int, count int) ([]core.Comment, error) {
+	rows, err := db.impl.Query(
+		`SELECT c.id, c.content, c.parent_comment, c.hidden, c.created_at, `+userColumns+`
+         FROM comments as c
+         INNER JOIN users as u
+         ON u.id == c.author
+         WHERE c.commented_post = ? AND c.id > ?
+         ORDER BY c.id;`,
+		p.Id,
+		afterId)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to get comments to post %v after %v due to %v\n", p.Id, afterId, err)
+	}
+	defer rows.Close()
+
+	cs := make([]core.Comment, 0, count)
+	for len(cs) < count && rows.Next() {
+		c := core.Comment{CommentedPost: p, Author: &core.User{}}
+		rows.Scan(withUserFields(c.Author, &c.Id, &c.Content, &c.ParentId, &c.Hidden, unixTime{&c.CreatedAt})...)
+
+		if Hides(viewer, c.Author, db) {
+			continue
+		}
+
+		cs = append(cs, c)
+	}
+
+	return cs, nil
+}
+
 func (db *database) LoadComment(id int) (*core.Comment, error) {
-	return nil, fmt.Errorf("Not yet implemented")
+	rows, err := db.impl.Query(
+		"SELECT author, commented_post, content, parent_comment, hidden, created_at FROM comments WHERE id = ?;",
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+
+	c := &core.Comment{Id: id}
+	var authorId, postId int
+	if rows.Next() {
+		rows.Scan(&authorId, &postId, &c.Content, &c.ParentId, &c.Hidden, unixTime{&c.CreatedAt})
+		rows.Close()
+	} else {
+		rows.Close()
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	c.Author, err = db.LoadUser(authorId)
+	if err != nil {
+		return nil, err
+	}
+
+	c.CommentedPost, err = db.LoadPost(postId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
 }
 
 func (db *database) LoadLike(id int) (*core.Like, error) {
-	return nil, fmt.Errorf("Not yet implemented")
+	rows, err := db.impl.Query(
+		"SELECT author, post, comment, kind FROM reactions WHERE id = ?;",
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+
+	l := &core.Like{Id: id}
+	var authorId, postId, commentId int
+	if rows.Next() {
+		rows.Scan(&authorId, &postId, &commentId, &l.Kind)
+		rows.Close()
+	} else {
+		rows.Close()
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	l.Author, err = db.LoadUser(authorId)
+	if err != nil {
+		return nil, err
+	}
+
+	if commentId != 0 {
+		l.LikedComment, err = db.LoadComment(commentId)
+	} else {
+		l.LikedPost, err = db.LoadPost(postId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
 }
 
 func (db *database) VerifyUser(login string, passwordHash uint64) (*core.User, error) {
 	rows, err := db.impl.Query(
-		"SELECT id, bio FROM users WHERE login = ? AND password_hash = ?;",
+		"SELECT "+userColumns+" FROM users AS u WHERE u.login = ? AND u.password_hash = ?;",
 		login,
 		passwordHash)
 
@@ -236,9 +488,9 @@ func (db *database) VerifyUser(login string, passwordHash uint64) (*core.User, e
 	}
 	defer rows.Close()
 
-	u := &core.User{Login: login, PasswordHash: passwordHash}
+	u := &core.User{}
 	if rows.Next() {
-		rows.Scan(&u.Id, &u.Bio)
+		rows.Scan(userFields(u)...)
 	} else {
 		return nil, fmt.Errorf("Failed to scan rows\n")
 	}
@@ -248,7 +500,7 @@ func (db *database) VerifyUser(login string, passwordHash uint64) (*core.User, e
 
 func (db *database) FindUser(login string) (*core.User, error) {
 	rows, err := db.impl.Query(
-		"SELECT id, bio, password_hash FROM users WHERE login = ?;",
+		"SELECT "+userColumns+" FROM users AS u WHERE u.login = ?;",
 		login)
 
 	if err != nil || rows == nil {
@@ -256,9 +508,9 @@ func (db *database) FindUser(login string) (*core.User, error) {
 	}
 	defer rows.Close()
 
-	u := &core.User{Login: login}
+	u := &core.User{}
 	if rows.Next() {
-		rows.Scan(&u.Id, &u.Bio, &u.PasswordHash)
+		rows.Scan(userFields(u)...)
 	} else {
 		return nil, fmt.Errorf("Failed to scan rows\n")
 	}
@@ -266,6 +518,368 @@ func (db *database) FindUser(login string) (*core.User, error) {
 	return u, nil
 }
 
+func (db *database) CreateFriendRequest(fr *core.FriendRequest) error {
+	result, err := db.impl.Exec(
+		"INSERT INTO friend_requests (sender, recipient, status) VALUES (?, ?, ?);",
+		fr.From.Id,
+		fr.To.Id,
+		fr.Status)
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	fr.Id = int(lastInsertId)
+	return err
+}
+
+func (db *database) LoadFriendRequest(id int) (*core.FriendRequest, error) {
+	rows, err := db.impl.Query(
+		"SELECT sender, recipient, status FROM friend_requests WHERE id = ?;",
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+
+	fr := &core.FriendRequest{Id: id}
+	var senderId, recipientId int
+	if rows.Next() {
+		rows.Scan(&senderId, &recipientId, &fr.Status)
+		rows.Close()
+	} else {
+		rows.Close()
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	fr.From, err = db.LoadUser(senderId)
+	if err != nil {
+		return nil, err
+	}
+
+	fr.To, err = db.LoadUser(recipientId)
+	if err != nil {
+		return nil, err
+	}
+
+	return fr, nil
+}
+
+func (db *database) UpdateFriendRequestStatus(fr *core.FriendRequest, status core.FriendRequestStatus) error {
+	result, err := db.impl.Exec(
+		"UPDATE friend_requests SET status = ? WHERE id = ? AND status = ?;",
+		status,
+		fr.Id,
+		fr.Status)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("Friend request %v was changed concurrently\n", fr.Id)
+	}
+
+	fr.Status = status
+	return nil
+}
+
+func (db *database) FindFriendRequest(a *core.User, b *core.User) (*core.FriendRequest, error) {
+	rows, err := db.impl.Query(
+		`SELECT id FROM friend_requests
+         WHERE ((sender = ? AND recipient = ?) OR (sender = ? AND recipient = ?))
+         AND status IN (?, ?)
+         ORDER BY id DESC;`,
+		a.Id, b.Id, b.Id, a.Id,
+		core.FriendRequestPending,
+		core.FriendRequestAccepted)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to find friend request between %v and %v due to %v\n", a.Id, b.Id, err)
+	}
+
+	var id int
+	found := rows.Next()
+	if found {
+		rows.Scan(&id)
+	}
+	rows.Close()
+
+	if !found {
+		return nil, nil
+	}
+
+	return db.LoadFriendRequest(id)
+}
+
+func (db *database) getFriendRequests(column string, u *core.User) ([]core.FriendRequest, error) {
+	rows, err := db.impl.Query(
+		`SELECT id FROM friend_requests WHERE `+column+` = ? AND status = ? ORDER BY id DESC;`,
+		u.Id,
+		core.FriendRequestPending)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list friend requests of user %v due to %v\n", u.Id, err)
+	}
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	frs := make([]core.FriendRequest, 0, len(ids))
+	for _, id := range ids {
+		fr, err := db.LoadFriendRequest(id)
+		if err != nil {
+			return nil, err
+		}
+
+		frs = append(frs, *fr)
+	}
+
+	return frs, nil
+}
+
+func (db *database) GetIncomingFriendRequests(u *core.User) ([]core.FriendRequest, error) {
+	return db.getFriendRequests("recipient", u)
+}
+
+func (db *database) GetOutgoingFriendRequests(u *core.User) ([]core.FriendRequest, error) {
+	return db.getFriendRequests("sender", u)
+}
+
+func (db *database) GetFriends(u *core.User) ([]core.User, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+userColumns+`
+         FROM friend_requests AS fr
+         INNER JOIN users AS u
+         ON (fr.sender = ? AND u.id = fr.recipient) OR (fr.recipient = ? AND u.id = fr.sender)
+         WHERE fr.status = ?
+         ORDER BY u.login;`,
+		u.Id,
+		u.Id,
+		core.FriendRequestAccepted)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list friends of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	us := []core.User{}
+	for rows.Next() {
+		f := core.User{}
+		rows.Scan(userFields(&f)...)
+
+		us = append(us, f)
+	}
+
+	return us, nil
+}
+
+func (db *database) AreFriends(a *core.User, b *core.User) (bool, error) {
+	rows, err := db.impl.Query(
+		`SELECT COUNT(*) FROM friend_requests
+         WHERE ((sender = ? AND recipient = ?) OR (sender = ? AND recipient = ?))
+         AND status = ?;`,
+		a.Id, b.Id, b.Id, a.Id,
+		core.FriendRequestAccepted)
+
+	if err != nil || rows == nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count > 0, nil
+}
+
+func (db *database) CountMutualFriends(a *core.User, b *core.User) (int, error) {
+	rows, err := db.impl.Query(
+		`WITH friends(owner, friend) AS (
+             SELECT sender, recipient FROM friend_requests WHERE status = ?
+             UNION
+             SELECT recipient, sender FROM friend_requests WHERE status = ?
+         )
+         SELECT COUNT(*)
+         FROM friends AS fa
+         INNER JOIN friends AS fb
+         ON fa.friend = fb.friend
+         WHERE fa.owner = ? AND fb.owner = ?;`,
+		core.FriendRequestAccepted,
+		core.FriendRequestAccepted,
+		a.Id,
+		b.Id)
+
+	if err != nil || rows == nil {
+		return 0, fmt.Errorf("Failed to count mutual friends of %v and %v due to %v\n", a.Id, b.Id, err)
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count, nil
+}
+
+func (db *database) UpdateUser(u *core.User) error {
+	_, err := db.impl.Exec(
+		`UPDATE users SET password_hash = ?, bio = ?, visibility = ?, message_visibility = ?, email = ?, digest_frequency = ?
+         WHERE id = ?;`,
+		u.PasswordHash,
+		u.Bio,
+		u.Visibility,
+		u.MessageVisibility,
+		u.Email,
+		u.DigestFrequency,
+		u.Id)
+
+	return err
+}
+
+func (db *database) UpdatePostVisibility(p *core.Post, v core.Visibility) error {
+	_, err := db.impl.Exec(
+		"UPDATE posts SET visibility = ? WHERE id = ?;",
+		v,
+		p.Id)
+
+	if err != nil {
+		return err
+	}
+
+	p.Visibility = v
+	return nil
+}
+
+func (db *database) UpdatePostContent(p *core.Post, content []byte) error {
+	_, err := db.impl.Exec(
+		"UPDATE posts SET content = ? WHERE id = ?;",
+		content,
+		p.Id)
+
+	if err != nil {
+		return err
+	}
+
+	p.Content = content
+	return nil
+}
+
+func (db *database) DeletePost(p *core.Post) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM reactions WHERE comment IN (SELECT id FROM comments WHERE commented_post = ?);",
+		"DELETE FROM reactions WHERE post = ?;",
+		"DELETE FROM comments WHERE commented_post = ?;",
+		"DELETE FROM notifications WHERE post = ?;",
+		"DELETE FROM post_tags WHERE post = ?;",
+		"DELETE FROM mentions WHERE post = ?;",
+		"DELETE FROM bookmarks WHERE post = ?;",
+		"DELETE FROM remote_likes WHERE post = ?;",
+		"DELETE FROM remote_notes WHERE post = ?;",
+		"DELETE FROM posts WHERE id = ?;",
+	} {
+		_, err = tx.Exec(query, p.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *database) CountReposts(p *core.Post) (int, error) {
+	rows, err := db.impl.Query(
+		"SELECT COUNT(*) FROM posts WHERE repost_of = ?;",
+		p.Id)
+
+	if err != nil || rows == nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count, nil
+}
+
+func (db *database) Follow(follower *core.User, followee *core.User) error {
+	_, err := db.impl.Exec(
+		"INSERT OR IGNORE INTO follows (follower, followee) VALUES (?, ?);",
+		follower.Id,
+		followee.Id)
+
+	return err
+}
+
+func (db *database) Unfollow(follower *core.User, followee *core.User) error {
+	_, err := db.impl.Exec(
+		"DELETE FROM follows WHERE follower = ? AND followee = ?;",
+		follower.Id,
+		followee.Id)
+
+	return err
+}
+
+func (db *database) IsFollowing(follower *core.User, followee *core.User) (bool, error) {
+	rows, err := db.impl.Query(
+		"SELECT COUNT(*) FROM follows WHERE follower = ? AND followee = ?;",
+		follower.Id,
+		followee.Id)
+
+	if err != nil || rows == nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count > 0, nil
+}
+
+func (db *database) CountFollowers(u *core.User) (int, error) {
+	rows, err := db.impl.Query(
+		"SELECT COUNT(*) FROM follows WHERE followee = ?;",
+		u.Id)
+
+	if err != nil || rows == nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count, nil
+}
+
 func (db *database) Close() {
 	db.impl.Close()
 }
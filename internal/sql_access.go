@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"github.com/JouleJ/socnet/core"
+)
+
+// canSeeClause is the SQL form of the visibility switch of CanSee, for the
+// visibility in column of something owned by the user with the id in owner.
+func canSeeClause(column string, owner string, viewer *core.User) (string, []any) {
+	clause := `(` + column + ` = ?
+         OR (` + column + ` = ? AND EXISTS (SELECT 1 FROM follows WHERE follower = ? AND followee = ` + owner + `))
+         OR (` + column + ` IN (?, ?) AND EXISTS (
+             SELECT 1 FROM friend_requests
+             WHERE ((sender = ? AND recipient = ` + owner + `) OR (sender = ` + owner + ` AND recipient = ?))
+             AND status = ?)))`
+
+	return clause, []any{
+		core.VisibilityPublic,
+		core.VisibilityFollowers, viewer.Id,
+		core.VisibilityFollowers, core.VisibilityFriends, viewer.Id, viewer.Id, core.FriendRequestAccepted,
+	}
+}
+
+// visibleProfileClause is the SQL form of CanViewProfile for users aliased
+// u. It must be kept in line with CanSee.
+func visibleProfileClause(viewer *core.User) (string, []any) {
+	if viewer == nil {
+		return `(u.suspended = 0 AND u.visibility = ?)`, []any{core.VisibilityPublic}
+	}
+
+	see, seeArgs := canSeeClause("u.visibility", "u.id", viewer)
+	clause := `(u.id = ? OR (
+         NOT EXISTS (SELECT 1 FROM blocks WHERE owner = u.id AND target = ? AND kind = ?)
+         AND (u.suspended = 0 OR ?) AND ` + see + `))`
+	args := []any{viewer.Id, viewer.Id, core.BlockKindBlock, Can(viewer, core.PermissionModerate)}
+
+	return clause, append(args, seeArgs...)
+}
+
+// visiblePostsClause is the SQL form of CanViewPost, and of Hides if hides
+// is set, for posts aliased p written by users aliased u. Lists of posts
+// filter with it so that they can page in SQL instead of checking every
+// post of the table.
+func visiblePostsClause(viewer *core.User, hides bool) (string, []any) {
+	clause, args := visibleProfileClause(viewer)
+
+	if viewer == nil {
+		return `(` + clause + ` AND p.visibility = ?)`, append(args, core.VisibilityPublic)
+	}
+
+	see, seeArgs := canSeeClause("p.visibility", "u.id", viewer)
+	clause += ` AND (u.id = ? OR ` + see + `)`
+	args = append(append(args, viewer.Id), seeArgs...)
+
+	if hides {
+		hidden, hiddenArgs := hidesClause("u.id", viewer)
+		clause += ` AND NOT ` + hidden
+		args = append(args, hiddenArgs...)
+	}
+
+	return `(` + clause + `)`, args
+}
+
+// hidesClause is the SQL form of Hides for the author in column, viewer must
+// not be nil.
+func hidesClause(column string, viewer *core.User) (string, []any) {
+	return `(` + column + ` != ? AND EXISTS (
+             SELECT 1 FROM blocks
+             WHERE (owner = ? AND target = ` + column + `)
+             OR (owner = ` + column + ` AND target = ? AND kind = ?)))`,
+		[]any{viewer.Id, viewer.Id, viewer.Id, core.BlockKindBlock}
+}
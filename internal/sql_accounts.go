@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) SetPasswordHash(u *core.User, passwordHash uint64) error {
+	_, err := db.impl.Exec("UPDATE users SET password_hash = ? WHERE id = ?;", passwordHash, u.Id)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = passwordHash
+	return nil
+}
+
+func (db *database) SetPasswordResetRequired(u *core.User, required bool) error {
+	_, err := db.impl.Exec("UPDATE users SET password_reset_required = ? WHERE id = ?;", required, u.Id)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordResetRequired = required
+	return nil
+}
+
+func (db *database) DeleteUser(u *core.User) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const posts = `(SELECT id FROM posts WHERE author = ?1)`
+	const comments = `(SELECT id FROM comments WHERE author = ?1)`
+
+	for _, query := range []string{
+		// The posts of u go as DeletePost deletes a post.
+		"DELETE FROM reactions WHERE comment IN (SELECT id FROM comments WHERE commented_post IN " + posts + ");",
+		"DELETE FROM reactions WHERE post IN " + posts + ";",
+		"DELETE FROM comments WHERE commented_post IN " + posts + ";",
+		"DELETE FROM notifications WHERE post IN " + posts + ";",
+		"DELETE FROM post_tags WHERE post IN " + posts + ";",
+		"DELETE FROM mentions WHERE post IN " + posts + ";",
+		"DELETE FROM bookmarks WHERE post IN " + posts + ";",
+		"DELETE FROM remote_likes WHERE post IN " + posts + ";",
+		"DELETE FROM remote_notes WHERE post IN " + posts + ";",
+		"DELETE FROM posts WHERE author = ?1;",
+
+		// Replies to comments of u on other posts move to the top level.
+		"UPDATE comments SET parent_comment = 0 WHERE parent_comment IN " + comments + ";",
+		"DELETE FROM reactions WHERE comment IN " + comments + ";",
+		"DELETE FROM notifications WHERE comment IN " + comments + ";",
+		"DELETE FROM mentions WHERE comment IN " + comments + ";",
+		"DELETE FROM comments WHERE author = ?1;",
+
+		"DELETE FROM reactions WHERE author = ?1;",
+		"DELETE FROM notifications WHERE recipient = ?1 OR actor = ?1;",
+		"DELETE FROM notification_optouts WHERE user = ?1;",
+		"DELETE FROM mentions WHERE user = ?1 OR author = ?1;",
+		"DELETE FROM bookmarks WHERE owner = ?1;",
+		"DELETE FROM bookmark_collections WHERE owner = ?1;",
+		"DELETE FROM blocks WHERE owner = ?1 OR target = ?1;",
+		"DELETE FROM friend_requests WHERE sender = ?1 OR recipient = ?1;",
+		"DELETE FROM follows WHERE follower = ?1 OR followee = ?1;",
+		"DELETE FROM messages WHERE author = ?1;",
+		"DELETE FROM conversation_members WHERE user = ?1;",
+		"DELETE FROM reports WHERE reporter = ?1 OR target_user = ?1;",
+		"DELETE FROM sessions WHERE user = ?1;",
+		"DELETE FROM access_tokens WHERE user = ?1;",
+		"DELETE FROM webhook_deliveries WHERE webhook IN (SELECT id FROM webhooks WHERE owner = ?1);",
+		"DELETE FROM webhooks WHERE owner = ?1;",
+		"DELETE FROM remote_follows WHERE followee = ?1;",
+		"DELETE FROM federation_deliveries WHERE sender = ?1;",
+		"DELETE FROM actor_keys WHERE user = ?1;",
+		"DELETE FROM users WHERE id = ?1;",
+	} {
+		_, err = tx.Exec(query, u.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *database) FindUsers(query string, count int) ([]core.User, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+userColumns+`
+         FROM users AS u
+         WHERE instr(lower(u.login), lower(?)) > 0
+         ORDER BY u.login
+         LIMIT ?;`,
+		query,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to find users like %v due to %v\n", query, err)
+	}
+	defer rows.Close()
+
+	us := []core.User{}
+	for rows.Next() {
+		u := core.User{}
+		rows.Scan(userFields(&u)...)
+
+		us = append(us, u)
+	}
+
+	return us, nil
+}
+
+func (db *database) GetDailyStats(days int) ([]core.DayStats, error) {
+	const day = 24 * 60 * 60
+
+	today := time.Now().Unix() / day
+	since := (today - int64(days) + 1) * day
+
+	stats := make([]core.DayStats, days)
+	for i := range stats {
+		stats[i].Day = time.Unix((today-int64(i))*day, 0).UTC()
+	}
+
+	for _, table := range []string{"users", "posts", "comments"} {
+		rows, err := db.impl.Query(
+			`SELECT created_at / ?, COUNT(*)
+             FROM `+table+`
+             WHERE created_at >= ?
+             GROUP BY 1;`,
+			day,
+			since)
+
+		if err != nil || rows == nil {
+			return nil, fmt.Errorf("Failed to count %v per day due to %v\n", table, err)
+		}
+
+		for rows.Next() {
+			var n int64
+			var count int
+			rows.Scan(&n, &count)
+
+			i := today - n
+			if i < 0 || i >= int64(days) {
+				continue
+			}
+
+			switch table {
+			case "users":
+				stats[i].Users = count
+			case "posts":
+				stats[i].Posts = count
+			case "comments":
+				stats[i].Comments = count
+			}
+		}
+		rows.Close()
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const auditColumns = `id, kind, actor, actor_login, target, target_login, address, user_agent, detail, created_at, prev_hash, hash`
+
+func auditFields(e *core.AuditEvent) []any {
+	return []any{&e.Id, &e.Kind, &e.ActorId, &e.ActorLogin, &e.TargetId, &e.TargetLogin, &e.Address, &e.UserAgent, &e.Detail, unixTime{&e.CreatedAt}, &e.PrevHash, &e.Hash}
+}
+
+// AppendAuditEvent reads the last hash and appends after it in one
+// BEGIN IMMEDIATE transaction, which takes the write lock of the database
+// up front. Commands such as make-admin append from processes of their own,
+// so nothing short of the database lock keeps two appends from chaining to
+// the same hash.
+func (db *database) AppendAuditEvent(e *core.AuditEvent) error {
+	ctx := context.Background()
+	conn, err := db.impl.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to open a connection for the audit log due to %v\n", err)
+	}
+	defer conn.Close()
+
+	// database/sql cannot begin an immediate transaction, so the statements
+	// are issued on one connection by hand.
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE;"); err != nil {
+		return fmt.Errorf("Failed to lock the audit log due to %v\n", err)
+	}
+
+	err = db.appendAuditEvent(ctx, conn, e)
+	if err != nil {
+		conn.ExecContext(ctx, "ROLLBACK;")
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, "COMMIT;"); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK;")
+		return fmt.Errorf("Failed to commit audit event due to %v\n", err)
+	}
+
+	return nil
+}
+
+func (db *database) appendAuditEvent(ctx context.Context, conn *sql.Conn, e *core.AuditEvent) error {
+	lastId, lastHash := 0, ""
+	err := conn.QueryRowContext(ctx, "SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1;").Scan(&lastId, &lastHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Failed to read the end of the audit log due to %v\n", err)
+	}
+
+	e.Id = lastId + 1
+	e.CreatedAt = time.Now()
+	e.PrevHash = lastHash
+	e.Hash = auditHash(e)
+
+	_, err = conn.ExecContext(ctx,
+		`INSERT INTO audit_log (`+auditColumns+`)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		e.Id,
+		e.Kind,
+		e.ActorId,
+		e.ActorLogin,
+		e.TargetId,
+		e.TargetLogin,
+		e.Address,
+		e.UserAgent,
+		e.Detail,
+		e.CreatedAt.Unix(),
+		e.PrevHash,
+		e.Hash)
+
+	return err
+}
+
+func (db *database) GetAuditEvents(f core.AuditFilter, count int) ([]core.AuditEvent, error) {
+	conditions := []string{"1"}
+	args := []any{}
+
+	if f.Kind != nil {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, *f.Kind)
+	}
+	if f.ActorLogin != "" {
+		conditions = append(conditions, "actor_login = ?")
+		args = append(args, f.ActorLogin)
+	}
+	if f.TargetLogin != "" {
+		conditions = append(conditions, "target_login = ?")
+		args = append(args, f.TargetLogin)
+	}
+	if f.BeforeId != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, f.BeforeId)
+	}
+
+	rows, err := db.impl.Query(
+		`SELECT `+auditColumns+` FROM audit_log
+         WHERE `+strings.Join(conditions, " AND ")+`
+         ORDER BY id DESC LIMIT ?;`,
+		append(args, count)...)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list audit events due to %v\n", err)
+	}
+	defer rows.Close()
+
+	es := []core.AuditEvent{}
+	for rows.Next() {
+		e := core.AuditEvent{}
+		rows.Scan(auditFields(&e)...)
+
+		es = append(es, e)
+	}
+
+	return es, nil
+}
+
+func (db *database) ForEachAuditEvent(fn func(e *core.AuditEvent) error) error {
+	rows, err := db.impl.Query(`SELECT ` + auditColumns + ` FROM audit_log ORDER BY id;`)
+	if err != nil || rows == nil {
+		return fmt.Errorf("Failed to read the audit log due to %v\n", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := core.AuditEvent{}
+		rows.Scan(auditFields(&e)...)
+
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) SetBlock(owner *core.User, target *core.User, k core.BlockKind, on bool) error {
+	query := "DELETE FROM blocks WHERE owner = ? AND target = ? AND kind = ?;"
+	if on {
+		query = "INSERT INTO blocks (owner, target, kind) VALUES (?, ?, ?) ON CONFLICT(owner, target, kind) DO NOTHING;"
+	}
+
+	_, err := db.impl.Exec(query, owner.Id, target.Id, k)
+	return err
+}
+
+func (db *database) IsBlocked(owner *core.User, target *core.User, k core.BlockKind) (bool, error) {
+	rows, err := db.impl.Query(
+		"SELECT COUNT(*) FROM blocks WHERE owner = ? AND target = ? AND kind = ?;",
+		owner.Id,
+		target.Id,
+		k)
+
+	if err != nil || rows == nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count > 0, nil
+}
+
+func (db *database) GetBlockedUsers(owner *core.User, k core.BlockKind) ([]core.User, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+userColumns+`
+         FROM blocks AS b
+         INNER JOIN users AS u
+         ON u.id = b.target
+         WHERE b.owner = ? AND b.kind = ?
+         ORDER BY u.login;`,
+		owner.Id,
+		k)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list %v list of user %v due to %v\n", k, owner.Id, err)
+	}
+	defer rows.Close()
+
+	us := []core.User{}
+	for rows.Next() {
+		u := core.User{}
+		rows.Scan(userFields(&u)...)
+
+		us = append(us, u)
+	}
+
+	return us, nil
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) CreateBookmark(b *core.Bookmark) error {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+
+	collectionId := 0
+	if b.Collection != nil {
+		collectionId = b.Collection.Id
+	}
+
+	_, err := db.impl.Exec(
+		`INSERT INTO bookmarks (owner, post, collection, created_at) VALUES (?, ?, ?, ?)
+         ON CONFLICT(owner, post) DO UPDATE SET collection = excluded.collection;`,
+		b.Owner.Id,
+		b.Post.Id,
+		collectionId,
+		b.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	found, err := db.FindBookmark(b.Owner, b.Post)
+	if err != nil || found == nil {
+		return fmt.Errorf("Failed to find bookmark of post %v by %v due to %v\n", b.Post.Id, b.Owner.Id, err)
+	}
+
+	b.Id = found.Id
+	b.CreatedAt = found.CreatedAt
+	return nil
+}
+
+func (db *database) DeleteBookmark(owner *core.User, p *core.Post) error {
+	_, err := db.impl.Exec(
+		"DELETE FROM bookmarks WHERE owner = ? AND post = ?;",
+		owner.Id,
+		p.Id)
+
+	return err
+}
+
+func (db *database) FindBookmark(owner *core.User, p *core.Post) (*core.Bookmark, error) {
+	rows, err := db.impl.Query(
+		"SELECT id, collection, created_at FROM bookmarks WHERE owner = ? AND post = ?;",
+		owner.Id,
+		p.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to find bookmark of post %v by %v due to %v\n", p.Id, owner.Id, err)
+	}
+
+	b := &core.Bookmark{Owner: owner, Post: p}
+	var collectionId int
+	var createdAt int64
+	found := rows.Next()
+	if found {
+		rows.Scan(&b.Id, &collectionId, &createdAt)
+	}
+	rows.Close()
+
+	if !found {
+		return nil, nil
+	}
+
+	b.CreatedAt = time.Unix(createdAt, 0)
+	if collectionId != 0 {
+		b.Collection, err = db.LoadBookmarkCollection(collectionId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func (db *database) GetBookmarks(owner *core.User, c *core.BookmarkCollection, count int) ([]core.Bookmark, error) {
+	collectionId := 0
+	if c != nil {
+		collectionId = c.Id
+	}
+
+	rows, err := db.impl.Query(
+		`SELECT b.id, b.collection, b.created_at, p.id, p.content, p.visibility, p.repost_of, p.hidden, p.created_at, `+userColumns+`
+         FROM bookmarks AS b
+         INNER JOIN posts AS p
+         ON p.id = b.post
+         INNER JOIN users AS u
+         ON u.id = p.author
+         WHERE b.owner = ? AND (? = 0 OR b.collection = ?)
+         ORDER BY b.id DESC;`,
+		owner.Id,
+		collectionId,
+		collectionId)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list bookmarks of user %v due to %v\n", owner.Id, err)
+	}
+
+	bs := make([]core.Bookmark, 0, count)
+	collectionIds := make([]int, 0, count)
+	for len(bs) < count && rows.Next() {
+		b := core.Bookmark{Owner: owner, Post: &core.Post{Author: &core.User{}}}
+		var collectionId int
+		var createdAt int64
+		rows.Scan(withUserFields(b.Post.Author, &b.Id, &collectionId, &createdAt, &b.Post.Id, &b.Post.Content, &b.Post.Visibility, &b.Post.RepostOfId, &b.Post.Hidden, unixTime{&b.Post.CreatedAt})...)
+		b.CreatedAt = time.Unix(createdAt, 0)
+
+		if CanViewPost(owner, b.Post, db) {
+			bs = append(bs, b)
+			collectionIds = append(collectionIds, collectionId)
+		}
+	}
+	rows.Close()
+
+	cs, err := db.GetBookmarkCollections(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range bs {
+		for j := range cs {
+			if cs[j].Id == collectionIds[i] {
+				bs[i].Collection = &cs[j]
+			}
+		}
+	}
+
+	return bs, nil
+}
+
+func (db *database) CreateBookmarkCollection(c *core.BookmarkCollection) error {
+	result, err := db.impl.Exec(
+		"INSERT INTO bookmark_collections (owner, name) VALUES (?, ?);",
+		c.Owner.Id,
+		c.Name)
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	c.Id = int(lastInsertId)
+	return nil
+}
+
+func (db *database) LoadBookmarkCollection(id int) (*core.BookmarkCollection, error) {
+	rows, err := db.impl.Query(
+		`SELECT c.name, `+userColumns+`
+         FROM bookmark_collections AS c
+         INNER JOIN users AS u
+         ON u.id = c.owner
+         WHERE c.id = ?;`,
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := &core.BookmarkCollection{Id: id, Owner: &core.User{}}
+	if !rows.Next() {
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+	rows.Scan(withUserFields(c.Owner, &c.Name)...)
+
+	return c, nil
+}
+
+func (db *database) GetBookmarkCollections(owner *core.User) ([]core.BookmarkCollection, error) {
+	rows, err := db.impl.Query(
+		"SELECT id, name FROM bookmark_collections WHERE owner = ? ORDER BY name;",
+		owner.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list bookmark collections of user %v due to %v\n", owner.Id, err)
+	}
+	defer rows.Close()
+
+	cs := []core.BookmarkCollection{}
+	for rows.Next() {
+		c := core.BookmarkCollection{Owner: owner}
+		rows.Scan(&c.Id, &c.Name)
+
+		cs = append(cs, c)
+	}
+
+	return cs, nil
+}
+
+func (db *database) DeleteBookmarkCollection(c *core.BookmarkCollection) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE bookmarks SET collection = 0 WHERE collection = ?;", c.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM bookmark_collections WHERE id = ?;", c.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
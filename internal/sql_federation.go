@@ -0,0 +1,381 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) CreateActorKey(k *core.ActorKey) error {
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+
+	_, err := db.impl.Exec(
+		`INSERT INTO actor_keys (user, private_key, public_key, created_at)
+         VALUES (?, ?, ?, ?)
+         ON CONFLICT(user) DO NOTHING;`,
+		k.User.Id,
+		k.PrivateKeyPem,
+		k.PublicKeyPem,
+		k.CreatedAt.Unix())
+
+	return err
+}
+
+func (db *database) GetActorKey(u *core.User) (*core.ActorKey, error) {
+	rows, err := db.impl.Query(
+		"SELECT private_key, public_key, created_at FROM actor_keys WHERE user = ?;",
+		u.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to load key of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	k := &core.ActorKey{User: u}
+	if rows.Next() {
+		rows.Scan(&k.PrivateKeyPem, &k.PublicKeyPem, unixTime{&k.CreatedAt})
+	} else {
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return k, nil
+}
+
+// remoteActorColumns lists the columns of remote_actors aliased as a in the
+// order expected by remoteActorFields.
+const remoteActorColumns = `a.id, a.uri, a.username, a.url, a.inbox, a.shared_inbox, a.key_id, a.public_key, a.fetched_at`
+
+func remoteActorFields(a *core.RemoteActor) []any {
+	return []any{&a.Id, &a.Uri, &a.Username, &a.Url, &a.Inbox, &a.SharedInbox, &a.PublicKeyId, &a.PublicKeyPem, unixTime{&a.FetchedAt}}
+}
+
+func (db *database) StoreRemoteActor(a *core.RemoteActor) error {
+	if a.FetchedAt.IsZero() {
+		a.FetchedAt = time.Now()
+	}
+
+	rows, err := db.impl.Query(
+		`INSERT INTO remote_actors (uri, username, url, inbox, shared_inbox, key_id, public_key, fetched_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+         ON CONFLICT(uri) DO UPDATE SET
+             username = excluded.username,
+             url = excluded.url,
+             inbox = excluded.inbox,
+             shared_inbox = excluded.shared_inbox,
+             key_id = excluded.key_id,
+             public_key = excluded.public_key,
+             fetched_at = excluded.fetched_at
+         RETURNING id;`,
+		a.Uri,
+		a.Username,
+		a.Url,
+		a.Inbox,
+		a.SharedInbox,
+		a.PublicKeyId,
+		a.PublicKeyPem,
+		a.FetchedAt.Unix())
+
+	if err != nil || rows == nil {
+		return fmt.Errorf("Failed to store remote actor %v due to %v\n", a.Uri, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return rows.Scan(&a.Id)
+}
+
+func (db *database) FindRemoteActor(uri string) (*core.RemoteActor, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+remoteActorColumns+` FROM remote_actors AS a WHERE a.uri = ?;`,
+		uri)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to find remote actor %v due to %v\n", uri, err)
+	}
+	defer rows.Close()
+
+	a := &core.RemoteActor{}
+	if rows.Next() {
+		rows.Scan(remoteActorFields(a)...)
+	} else {
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return a, nil
+}
+
+func (db *database) CreateRemoteFollow(f *core.RemoteFollow) error {
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now()
+	}
+
+	rows, err := db.impl.Query(
+		`INSERT INTO remote_follows (actor, followee, activity, created_at)
+         VALUES (?, ?, ?, ?)
+         ON CONFLICT(actor, followee) DO UPDATE SET activity = excluded.activity
+         RETURNING id;`,
+		f.Actor.Id,
+		f.Followee.Id,
+		f.ActivityUri,
+		f.CreatedAt.Unix())
+
+	if err != nil || rows == nil {
+		return fmt.Errorf("Failed to store follow of %v by %v due to %v\n", f.Followee.Id, f.Actor.Uri, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return rows.Scan(&f.Id)
+}
+
+func (db *database) DeleteRemoteFollow(actor *core.RemoteActor, followee *core.User) error {
+	_, err := db.impl.Exec("DELETE FROM remote_follows WHERE actor = ? AND followee = ?;", actor.Id, followee.Id)
+	return err
+}
+
+func (db *database) GetRemoteFollowers(u *core.User) ([]core.RemoteFollow, error) {
+	rows, err := db.impl.Query(
+		`SELECT f.id, f.activity, f.created_at, `+remoteActorColumns+`
+         FROM remote_follows AS f
+         INNER JOIN remote_actors AS a
+         ON a.id = f.actor
+         WHERE f.followee = ?
+         ORDER BY f.id;`,
+		u.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list remote followers of %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	fs := []core.RemoteFollow{}
+	for rows.Next() {
+		f := core.RemoteFollow{Actor: &core.RemoteActor{}, Followee: u}
+		rows.Scan(append([]any{&f.Id, &f.ActivityUri, unixTime{&f.CreatedAt}}, remoteActorFields(f.Actor)...)...)
+
+		fs = append(fs, f)
+	}
+
+	return fs, nil
+}
+
+func (db *database) CreateRemoteLike(l *core.RemoteLike) error {
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+
+	rows, err := db.impl.Query(
+		`INSERT INTO remote_likes (actor, post, activity, created_at)
+         VALUES (?, ?, ?, ?)
+         ON CONFLICT(actor, post) DO UPDATE SET activity = excluded.activity
+         RETURNING id;`,
+		l.Actor.Id,
+		l.Post.Id,
+		l.ActivityUri,
+		l.CreatedAt.Unix())
+
+	if err != nil || rows == nil {
+		return fmt.Errorf("Failed to store like of post %v by %v due to %v\n", l.Post.Id, l.Actor.Uri, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return rows.Scan(&l.Id)
+}
+
+func (db *database) DeleteRemoteLike(actor *core.RemoteActor, p *core.Post) error {
+	_, err := db.impl.Exec("DELETE FROM remote_likes WHERE actor = ? AND post = ?;", actor.Id, p.Id)
+	return err
+}
+
+func (db *database) CountRemoteLikes(p *core.Post) (int, error) {
+	rows, err := db.impl.Query("SELECT COUNT(*) FROM remote_likes WHERE post = ?;", p.Id)
+	if err != nil || rows == nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count, nil
+}
+
+func (db *database) CreateRemoteNote(n *core.RemoteNote) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+
+	rows, err := db.impl.Query(
+		`INSERT INTO remote_notes (uri, actor, post, url, content, activity, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?)
+         ON CONFLICT(uri) DO UPDATE SET
+             url = excluded.url,
+             content = excluded.content,
+             activity = excluded.activity
+         RETURNING id;`,
+		n.Uri,
+		n.Actor.Id,
+		n.Post.Id,
+		n.Url,
+		n.Content,
+		n.ActivityUri,
+		n.CreatedAt.Unix())
+
+	if err != nil || rows == nil {
+		return fmt.Errorf("Failed to store remote note %v due to %v\n", n.Uri, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return rows.Scan(&n.Id)
+}
+
+func (db *database) GetRemoteNotes(p *core.Post) ([]core.RemoteNote, error) {
+	rows, err := db.impl.Query(
+		`SELECT n.id, n.uri, n.url, n.content, n.activity, n.created_at, `+remoteActorColumns+`
+         FROM remote_notes AS n
+         INNER JOIN remote_actors AS a
+         ON a.id = n.actor
+         WHERE n.post = ?
+         ORDER BY n.id;`,
+		p.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list remote replies to post %v due to %v\n", p.Id, err)
+	}
+	defer rows.Close()
+
+	ns := []core.RemoteNote{}
+	for rows.Next() {
+		n := core.RemoteNote{Actor: &core.RemoteActor{}, Post: p}
+		rows.Scan(append([]any{&n.Id, &n.Uri, &n.Url, &n.Content, &n.ActivityUri, unixTime{&n.CreatedAt}}, remoteActorFields(n.Actor)...)...)
+
+		ns = append(ns, n)
+	}
+
+	return ns, nil
+}
+
+func (db *database) UndoRemoteActivity(actor *core.RemoteActor, uri string) (bool, error) {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var undone int64
+	for _, query := range []string{
+		"DELETE FROM remote_follows WHERE actor = ? AND activity = ?;",
+		"DELETE FROM remote_likes WHERE actor = ? AND activity = ?;",
+		"DELETE FROM remote_notes WHERE actor = ? AND (activity = ?2 OR uri = ?2);",
+	} {
+		result, err := tx.Exec(query, actor.Id, uri)
+		if err != nil {
+			return false, fmt.Errorf("Failed to undo %v of %v due to %v\n", uri, actor.Uri, err)
+		}
+
+		count, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+
+		undone += count
+	}
+
+	return undone != 0, tx.Commit()
+}
+
+func (db *database) CreateFederationDelivery(d *core.FederationDelivery) error {
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+
+	if d.NextAttemptAt.IsZero() {
+		d.NextAttemptAt = d.CreatedAt
+	}
+
+	result, err := db.impl.Exec(
+		`INSERT INTO federation_deliveries (sender, inbox, payload, status, next_attempt_at, created_at)
+         VALUES (?, ?, ?, ?, ?, ?);`,
+		d.Sender.Id,
+		d.Inbox,
+		d.Payload,
+		d.Status,
+		d.NextAttemptAt.Unix(),
+		d.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	d.Id = int(lastInsertId)
+	return nil
+}
+
+func (db *database) UpdateFederationDelivery(d *core.FederationDelivery) error {
+	_, err := db.impl.Exec(
+		`UPDATE federation_deliveries
+         SET status = ?, attempts = ?, next_attempt_at = ?, error = ?, delivered_at = ?
+         WHERE id = ?;`,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt.Unix(),
+		d.Error,
+		storedTime(d.DeliveredAt),
+		d.Id)
+
+	return err
+}
+
+func (db *database) GetDueFederationDeliveries(now time.Time, count int) ([]core.FederationDelivery, error) {
+	rows, err := db.impl.Query(
+		`SELECT d.id, d.inbox, d.payload, d.status, d.attempts, d.next_attempt_at, d.error, d.created_at, d.delivered_at, `+userColumns+`
+         FROM federation_deliveries AS d
+         INNER JOIN users AS u
+         ON u.id = d.sender
+         WHERE d.status = ? AND d.next_attempt_at <= ?
+         ORDER BY d.next_attempt_at, d.id
+         LIMIT ?;`,
+		core.DeliveryPending,
+		now.Unix(),
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list due federation deliveries due to %v\n", err)
+	}
+	defer rows.Close()
+
+	ds := []core.FederationDelivery{}
+	for rows.Next() {
+		d := core.FederationDelivery{Sender: &core.User{}}
+		rows.Scan(withUserFields(d.Sender, &d.Id, &d.Inbox, &d.Payload, &d.Status, &d.Attempts, unixTime{&d.NextAttemptAt},
+			&d.Error, unixTime{&d.CreatedAt}, unixTime{&d.DeliveredAt})...)
+
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
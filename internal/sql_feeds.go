@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) GetFeedPosts(author *core.User, tag string, count int) ([]core.Post, error) {
+	authorId := 0
+	if author != nil {
+		authorId = author.Id
+	}
+
+	visible, args := visiblePostsClause(nil, false)
+	rows, err := db.impl.Query(
+		`SELECT p.id, p.content, p.visibility, p.repost_of, p.hidden, p.created_at, `+userColumns+`
+         FROM posts AS p
+         INNER JOIN users AS u
+         ON u.id = p.author
+         WHERE `+visible+` AND p.hidden = 0
+         AND (? = 0 OR p.author = ?)
+         AND (? = '' OR p.id IN (
+             SELECT pt.post FROM post_tags AS pt
+             INNER JOIN tags AS t
+             ON t.id = pt.tag
+             WHERE t.name = ?))
+         ORDER BY p.id DESC
+         LIMIT ?;`,
+		append(args, authorId, authorId, tag, tag, count)...)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list %v feed posts due to %v\n", count, err)
+	}
+	defer rows.Close()
+
+	ps := make([]core.Post, 0, count)
+	for rows.Next() {
+		p := core.Post{Author: &core.User{}}
+		rows.Scan(withUserFields(p.Author, &p.Id, &p.Content, &p.Visibility, &p.RepostOfId, &p.Hidden, unixTime{&p.CreatedAt})...)
+
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func TestFriendRequestsAreUniquePerPair(t *testing.T) {
+	db := newTestDatabase(t)
+
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+
+	fr := &core.FriendRequest{From: alice, To: bob, Status: core.FriendRequestPending}
+	if err := db.CreateFriendRequest(fr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dup := range []*core.FriendRequest{
+		{From: alice, To: bob, Status: core.FriendRequestPending},
+		{From: bob, To: alice, Status: core.FriendRequestPending},
+	} {
+		if err := db.CreateFriendRequest(dup); err == nil {
+			t.Errorf("Second request from %v to %v was created", dup.From.Login, dup.To.Login)
+		}
+	}
+
+	if err := db.UpdateFriendRequestStatus(fr, core.FriendRequestAccepted); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateFriendRequest(&core.FriendRequest{From: bob, To: alice, Status: core.FriendRequestPending}); err == nil {
+		t.Errorf("Request between friends was created")
+	}
+
+	// Once the friendship is cancelled the two may ask again.
+	if err := db.UpdateFriendRequestStatus(fr, core.FriendRequestCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateFriendRequest(&core.FriendRequest{From: bob, To: alice, Status: core.FriendRequestPending}); err != nil {
+		t.Errorf("Request after cancelling was refused: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) SetMentions(author *core.User, postId int, commentId int, users []*core.User) ([]*core.User, error) {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT user FROM mentions WHERE post = ? AND comment = ?;",
+		postId,
+		commentId)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list mentions in %v/%v due to %v\n", postId, commentId, err)
+	}
+
+	before := map[int]bool{}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		before[id] = true
+	}
+	rows.Close()
+
+	added := []*core.User{}
+	after := map[int]bool{}
+	for _, u := range users {
+		after[u.Id] = true
+		if before[u.Id] {
+			continue
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO mentions (user, author, post, comment, created_at) VALUES (?, ?, ?, ?, ?);",
+			u.Id,
+			author.Id,
+			postId,
+			commentId,
+			time.Now().Unix())
+
+		if err != nil {
+			return nil, err
+		}
+
+		added = append(added, u)
+	}
+
+	for id := range before {
+		if after[id] {
+			continue
+		}
+
+		_, err = tx.Exec(
+			"DELETE FROM mentions WHERE post = ? AND comment = ? AND user = ?;",
+			postId,
+			commentId,
+			id)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+func (db *database) GetMentionedUsers(postId int, commentId int) ([]core.User, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+userColumns+`
+         FROM mentions AS m
+         INNER JOIN users AS u
+         ON u.id = m.user
+         WHERE m.post = ? AND m.comment = ?;`,
+		postId,
+		commentId)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list users mentioned in %v/%v due to %v\n", postId, commentId, err)
+	}
+	defer rows.Close()
+
+	us := []core.User{}
+	for rows.Next() {
+		u := core.User{}
+		rows.Scan(userFields(&u)...)
+
+		us = append(us, u)
+	}
+
+	return us, nil
+}
+
+func (db *database) GetMentionsOf(u *core.User, count int) ([]core.Mention, error) {
+	visible, args := visiblePostsClause(u, true)
+	hidden, hiddenArgs := hidesClause("m.author", u)
+
+	// The post is matched in a subquery, u is the author of the mention.
+	rows, err := db.impl.Query(
+		`SELECT m.id, m.post, m.comment, m.created_at, `+userColumns+`
+         FROM mentions AS m
+         INNER JOIN users AS u
+         ON u.id = m.author
+         WHERE m.user = ? AND NOT `+hidden+`
+         AND (m.comment = 0 OR EXISTS (SELECT 1 FROM comments WHERE id = m.comment AND hidden = 0))
+         AND EXISTS (
+             SELECT 1 FROM posts AS p
+             INNER JOIN users AS u
+             ON u.id = p.author
+             WHERE p.id = m.post AND p.hidden = 0 AND `+visible+`)
+         ORDER BY m.id DESC
+         LIMIT ?;`,
+		append(append(append([]any{u.Id}, hiddenArgs...), args...), count)...)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list mentions of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	ms := make([]core.Mention, 0, count)
+	for rows.Next() {
+		m := core.Mention{User: u, Author: &core.User{}}
+		var createdAt int64
+		rows.Scan(withUserFields(m.Author, &m.Id, &m.PostId, &m.CommentId, &createdAt)...)
+		m.CreatedAt = time.Unix(createdAt, 0)
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
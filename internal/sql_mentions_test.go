@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func TestMentionsLeaveOutHiddenContent(t *testing.T) {
+	db := newTestDatabase(t)
+
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	carol := createTestUser(t, db, "carol")
+
+	mention := func(author *core.User) *core.Post {
+		t.Helper()
+
+		p := &core.Post{Author: author, Content: []byte("Hi @alice"), Visibility: core.VisibilityPublic}
+		if err := db.CreatePost(p); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.SetMentions(author, p.Id, 0, []*core.User{alice}); err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	authors := func() []string {
+		t.Helper()
+
+		ms, err := db.GetMentionsOf(alice, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		logins := []string{}
+		for _, m := range ms {
+			logins = append(logins, m.Author.Login)
+		}
+
+		return logins
+	}
+
+	byBob := mention(bob)
+	mention(carol)
+	mention(carol)
+
+	if logins := authors(); len(logins) != 3 {
+		t.Fatalf("Mentions are by %v", logins)
+	}
+
+	if ms, err := db.GetMentionsOf(alice, 2); err != nil || len(ms) != 2 || ms[0].Author.Id != carol.Id {
+		t.Errorf("Two newest mentions are %+v: %v", ms, err)
+	}
+
+	if err := db.SetBlock(alice, carol, core.BlockKindMute, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins := authors(); len(logins) != 1 || logins[0] != "bob" {
+		t.Errorf("Mentions with carol muted are by %v", logins)
+	}
+
+	if err := db.SetPostHidden(byBob, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins := authors(); len(logins) != 0 {
+		t.Errorf("Mentions with the post of bob hidden are by %v", logins)
+	}
+
+	if err := db.SetBlock(alice, carol, core.BlockKindMute, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetBlock(carol, alice, core.BlockKindBlock, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins := authors(); len(logins) != 0 {
+		t.Errorf("Mentions with alice blocked by carol are by %v", logins)
+	}
+}
@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) CreateConversation(c *core.Conversation) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if c.LastActivity.IsZero() {
+		c.LastActivity = time.Now()
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO conversations (title, last_activity) VALUES (?, ?);",
+		c.Title,
+		c.LastActivity.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range c.Members {
+		_, err = tx.Exec(
+			"INSERT INTO conversation_members (conversation, user, last_read_message) VALUES (?, ?, ?);",
+			lastInsertId,
+			member.User.Id,
+			member.LastReadMessageId)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	c.Id = int(lastInsertId)
+	return nil
+}
+
+func (db *database) loadConversationMembers(c *core.Conversation) error {
+	rows, err := db.impl.Query(
+		`SELECT cm.last_read_message, `+userColumns+`
+         FROM conversation_members AS cm
+         INNER JOIN users AS u
+         ON u.id = cm.user
+         WHERE cm.conversation = ?
+         ORDER BY u.login;`,
+		c.Id)
+
+	if err != nil || rows == nil {
+		return fmt.Errorf("Failed to list members of conversation %v due to %v\n", c.Id, err)
+	}
+	defer rows.Close()
+
+	c.Members = []core.ConversationMember{}
+	for rows.Next() {
+		member := core.ConversationMember{User: &core.User{}}
+		rows.Scan(withUserFields(member.User, &member.LastReadMessageId)...)
+
+		c.Members = append(c.Members, member)
+	}
+
+	return nil
+}
+
+func (db *database) LoadConversation(id int) (*core.Conversation, error) {
+	rows, err := db.impl.Query(
+		"SELECT title, last_activity FROM conversations WHERE id = ?;",
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+
+	c := &core.Conversation{Id: id}
+	var lastActivity int64
+	if rows.Next() {
+		rows.Scan(&c.Title, &lastActivity)
+		rows.Close()
+	} else {
+		rows.Close()
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	c.LastActivity = time.Unix(lastActivity, 0)
+
+	err = db.loadConversationMembers(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (db *database) FindDirectConversation(a *core.User, b *core.User) (*core.Conversation, error) {
+	rows, err := db.impl.Query(
+		`SELECT c.id FROM conversations AS c
+         WHERE (SELECT COUNT(*) FROM conversation_members WHERE conversation = c.id) = 2
+         AND EXISTS (SELECT 1 FROM conversation_members WHERE conversation = c.id AND user = ?)
+         AND EXISTS (SELECT 1 FROM conversation_members WHERE conversation = c.id AND user = ?)
+         ORDER BY c.id;`,
+		a.Id,
+		b.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to find conversation of %v and %v due to %v\n", a.Id, b.Id, err)
+	}
+
+	var id int
+	found := rows.Next()
+	if found {
+		rows.Scan(&id)
+	}
+	rows.Close()
+
+	if !found {
+		return nil, nil
+	}
+
+	return db.LoadConversation(id)
+}
+
+func (db *database) GetConversations(u *core.User) ([]core.Conversation, error) {
+	rows, err := db.impl.Query(
+		`SELECT c.id, c.title, c.last_activity,
+             (SELECT COUNT(*) FROM messages AS m
+              WHERE m.conversation = c.id AND m.id > cm.last_read_message AND m.author != cm.user)
+         FROM conversations AS c
+         INNER JOIN conversation_members AS cm
+         ON cm.conversation = c.id
+         WHERE cm.user = ?
+         ORDER BY c.last_activity DESC, c.id DESC;`,
+		u.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list conversations of user %v due to %v\n", u.Id, err)
+	}
+
+	cs := []core.Conversation{}
+	for rows.Next() {
+		c := core.Conversation{}
+		var lastActivity int64
+		rows.Scan(&c.Id, &c.Title, &lastActivity, &c.Unread)
+		c.LastActivity = time.Unix(lastActivity, 0)
+
+		cs = append(cs, c)
+	}
+	rows.Close()
+
+	for i := range cs {
+		err = db.loadConversationMembers(&cs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cs, nil
+}
+
+func (db *database) CreateMessage(m *core.Message) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO messages (conversation, author, content, created_at) VALUES (?, ?, ?, ?);",
+		m.Conversation.Id,
+		m.Author.Id,
+		m.Content,
+		m.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE conversations SET last_activity = ? WHERE id = ?;",
+		m.CreatedAt.Unix(),
+		m.Conversation.Id)
+
+	if err != nil {
+		return err
+	}
+
+	// Authors have obviously seen their own messages.
+	_, err = tx.Exec(
+		"UPDATE conversation_members SET last_read_message = ? WHERE conversation = ? AND user = ?;",
+		lastInsertId,
+		m.Conversation.Id,
+		m.Author.Id)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Id = int(lastInsertId)
+	m.Conversation.LastActivity = m.CreatedAt
+	if member := m.Conversation.FindMember(m.Author); member != nil {
+		member.LastReadMessageId = m.Id
+	}
+
+	return nil
+}
+
+func (db *database) GetMessages(c *core.Conversation, beforeId int, count int) ([]core.Message, error) {
+	rows, err := db.impl.Query(
+		`SELECT m.id, m.content, m.created_at, `+userColumns+`
+         FROM messages AS m
+         INNER JOIN users AS u
+         ON u.id = m.author
+         WHERE m.conversation = ? AND (? = 0 OR m.id < ?)
+         ORDER BY m.id DESC
+         LIMIT ?;`,
+		c.Id,
+		beforeId,
+		beforeId,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list messages of conversation %v due to %v\n", c.Id, err)
+	}
+	defer rows.Close()
+
+	ms := make([]core.Message, 0, count)
+	for rows.Next() {
+		m := core.Message{Conversation: c, Author: &core.User{}}
+		var createdAt int64
+		rows.Scan(withUserFields(m.Author, &m.Id, &m.Content, &createdAt)...)
+		m.CreatedAt = time.Unix(createdAt, 0)
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
+
+func (db *database) MarkConversationRead(c *core.Conversation, u *core.User, messageId int) error {
+	_, err := db.impl.Exec(
+		`UPDATE conversation_members SET last_read_message = MAX(last_read_message, ?)
+         WHERE conversation = ? AND user = ?;`,
+		messageId,
+		c.Id,
+		u.Id)
+
+	if err != nil {
+		return err
+	}
+
+	if member := c.FindMember(u); member != nil && member.LastReadMessageId < messageId {
+		member.LastReadMessageId = messageId
+	}
+
+	return nil
+}
+
+func (db *database) GetMessagesSince(u *core.User, afterId int, count int) ([]core.Message, error) {
+	rows, err := db.impl.Query(
+		`SELECT m.id, m.conversation, m.content, m.created_at, `+userColumns+`
+         FROM messages AS m
+         INNER JOIN conversation_members AS cm
+         ON cm.conversation = m.conversation AND cm.user = ?
+         INNER JOIN users AS u
+         ON u.id = m.author
+         WHERE m.id > ?
+         ORDER BY m.id
+         LIMIT ?;`,
+		u.Id,
+		afterId,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list messages of user %v since %v due to %v\n", u.Id, afterId, err)
+	}
+	defer rows.Close()
+
+	ms := make([]core.Message, 0, count)
+	for rows.Next() {
+		m := core.Message{Conversation: &core.Conversation{}, Author: &core.User{}}
+		var createdAt int64
+		rows.Scan(withUserFields(m.Author, &m.Id, &m.Conversation.Id, &m.Content, &createdAt)...)
+		m.CreatedAt = time.Unix(createdAt, 0)
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// reportTargetIds returns the post, comment and account ids stored for r.
+func reportTargetIds(r *core.Report) (int, int, int) {
+	switch {
+	case r.Post != nil:
+		return r.Post.Id, 0, 0
+	case r.Comment != nil:
+		return 0, r.Comment.Id, 0
+	case r.User != nil:
+		return 0, 0, r.User.Id
+	}
+
+	return 0, 0, 0
+}
+
+func (db *database) CreateReport(r *core.Report) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+
+	postId, commentId, userId := reportTargetIds(r)
+	result, err := db.impl.Exec(
+		`INSERT INTO reports (reporter, post, comment, target_user, reason, status, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		r.Reporter.Id,
+		postId,
+		commentId,
+		userId,
+		r.Reason,
+		r.Status,
+		r.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	r.Id = int(lastInsertId)
+	return nil
+}
+
+// reportRow holds the ids of a report row until its users and targets are
+// loaded, which needs the rows to be closed first.
+type reportRow struct {
+	report                                       core.Report
+	reporterId, postId, commentId, userId, modId int
+	modLogin                                     string
+	createdAt, resolvedAt                        int64
+}
+
+func (db *database) loadReportRow(row *reportRow) (*core.Report, error) {
+	r := &row.report
+	r.CreatedAt = time.Unix(row.createdAt, 0)
+	if row.resolvedAt != 0 {
+		r.ResolvedAt = time.Unix(row.resolvedAt, 0)
+	}
+
+	var err error
+	r.Reporter, err = db.LoadUser(row.reporterId)
+	if err != nil {
+		return nil, err
+	}
+
+	if row.modId != 0 {
+		// Moderators can be demoted and deleted, their login stays.
+		r.ResolvedBy, err = db.LoadUser(row.modId)
+		if err != nil {
+			r.ResolvedBy = &core.User{Login: row.modLogin}
+		}
+	}
+
+	// Targets deleted since the report are left nil.
+	switch {
+	case row.postId != 0:
+		r.Post, _ = db.LoadPost(row.postId)
+	case row.commentId != 0:
+		r.Comment, _ = db.LoadComment(row.commentId)
+	case row.userId != 0:
+		r.User, _ = db.LoadUser(row.userId)
+	}
+
+	return r, nil
+}
+
+const reportColumns = `id, reporter, post, comment, target_user, reason, status, created_at, resolved_by, resolved_by_login, resolved_at`
+
+func reportFields(row *reportRow) []any {
+	r := &row.report
+	return []any{&r.Id, &row.reporterId, &row.postId, &row.commentId, &row.userId, &r.Reason, &r.Status, &row.createdAt, &row.modId, &row.modLogin, &row.resolvedAt}
+}
+
+func (db *database) LoadReport(id int) (*core.Report, error) {
+	rows, err := db.impl.Query(
+		"SELECT "+reportColumns+" FROM reports WHERE id = ?;",
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+
+	row := &reportRow{}
+	if rows.Next() {
+		rows.Scan(reportFields(row)...)
+		rows.Close()
+	} else {
+		rows.Close()
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return db.loadReportRow(row)
+}
+
+func (db *database) GetOpenReports(count int) ([]core.Report, error) {
+	rows, err := db.impl.Query(
+		"SELECT "+reportColumns+" FROM reports WHERE status = ? ORDER BY id LIMIT ?;",
+		core.ReportOpen,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list open reports due to %v\n", err)
+	}
+
+	return db.collectReports(rows)
+}
+
+func (db *database) GetReportsAbout(u *core.User, count int) ([]core.Report, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+reportColumns+` FROM reports
+         WHERE target_user = ?
+         OR post IN (SELECT id FROM posts WHERE author = ?)
+         OR comment IN (SELECT id FROM comments WHERE author = ?)
+         ORDER BY id DESC LIMIT ?;`,
+		u.Id,
+		u.Id,
+		u.Id,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list reports about user %v due to %v\n", u.Id, err)
+	}
+
+	return db.collectReports(rows)
+}
+
+// collectReports reads and closes rows of reportColumns, then loads the
+// users and targets of the reports.
+func (db *database) collectReports(rows *sql.Rows) ([]core.Report, error) {
+	reportRows := []*reportRow{}
+	for rows.Next() {
+		row := &reportRow{}
+		rows.Scan(reportFields(row)...)
+
+		reportRows = append(reportRows, row)
+	}
+	rows.Close()
+
+	rs := make([]core.Report, 0, len(reportRows))
+	for _, row := range reportRows {
+		r, err := db.loadReportRow(row)
+		if err != nil {
+			return nil, err
+		}
+
+		rs = append(rs, *r)
+	}
+
+	return rs, nil
+}
+
+func (db *database) ResolveReports(r *core.Report, status core.ReportStatus, moderator *core.User) error {
+	now := time.Now()
+
+	// Targets are compared by the stored ids, which stay set when the
+	// target is deleted.
+	_, err := db.impl.Exec(
+		`UPDATE reports SET status = ?, resolved_by = ?, resolved_by_login = ?, resolved_at = ?
+         WHERE id = ? OR (status = ? AND (post, comment, target_user) =
+             (SELECT post, comment, target_user FROM reports WHERE id = ?));`,
+		status,
+		moderator.Id,
+		moderator.Login,
+		now.Unix(),
+		r.Id,
+		core.ReportOpen,
+		r.Id)
+
+	if err != nil {
+		return err
+	}
+
+	r.Status = status
+	r.ResolvedBy = moderator
+	r.ResolvedAt = now
+	return nil
+}
+
+func (db *database) SetPostHidden(p *core.Post, hidden bool) error {
+	_, err := db.impl.Exec("UPDATE posts SET hidden = ? WHERE id = ?;", hidden, p.Id)
+	if err != nil {
+		return err
+	}
+
+	p.Hidden = hidden
+	return nil
+}
+
+func (db *database) SetCommentHidden(c *core.Comment, hidden bool) error {
+	_, err := db.impl.Exec("UPDATE comments SET hidden = ? WHERE id = ?;", hidden, c.Id)
+	if err != nil {
+		return err
+	}
+
+	c.Hidden = hidden
+	return nil
+}
+
+func (db *database) SetUserSuspended(u *core.User, suspended bool) error {
+	_, err := db.impl.Exec("UPDATE users SET suspended = ? WHERE id = ?;", suspended, u.Id)
+	if err != nil {
+		return err
+	}
+
+	u.Suspended = suspended
+	return nil
+}
+
+func (db *database) CreateModerationAction(a *core.ModerationAction) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+
+	result, err := db.impl.Exec(
+		`INSERT INTO moderation_actions (moderator, moderator_login, action, report, post, comment, target_user, reason, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		a.Moderator.Id,
+		a.Moderator.Login,
+		a.Kind,
+		a.ReportId,
+		a.PostId,
+		a.CommentId,
+		a.UserId,
+		a.Reason,
+		a.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	a.Id = int(lastInsertId)
+	return nil
+}
+
+func (db *database) GetModerationActions(count int) ([]core.ModerationAction, error) {
+	rows, err := db.impl.Query(
+		`SELECT a.id, a.action, a.report, a.post, a.comment, a.target_user, a.reason, a.created_at,
+         COALESCE(u.id, 0), COALESCE(u.login, a.moderator_login)
+         FROM moderation_actions AS a
+         LEFT JOIN users AS u
+         ON u.id = a.moderator
+         ORDER BY a.id DESC
+         LIMIT ?;`,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list moderation actions due to %v\n", err)
+	}
+	defer rows.Close()
+
+	as := make([]core.ModerationAction, 0, count)
+	for rows.Next() {
+		a := core.ModerationAction{Moderator: &core.User{}}
+		var createdAt int64
+		rows.Scan(&a.Id, &a.Kind, &a.ReportId, &a.PostId, &a.CommentId, &a.UserId, &a.Reason, &createdAt, &a.Moderator.Id, &a.Moderator.Login)
+		a.CreatedAt = time.Unix(createdAt, 0)
+
+		as = append(as, a)
+	}
+
+	return as, nil
+}
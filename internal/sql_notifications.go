@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) CreateNotification(n *core.Notification) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+
+	result, err := db.impl.Exec(
+		`INSERT INTO notifications (recipient, actor, kind, post, comment, conversation, created_at, read)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+		n.Recipient.Id,
+		n.Actor.Id,
+		n.Kind,
+		n.PostId,
+		n.CommentId,
+		n.ConversationId,
+		n.CreatedAt.Unix(),
+		n.Read)
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	n.Id = int(lastInsertId)
+	return err
+}
+
+func (db *database) GetNotifications(u *core.User, count int) ([]core.Notification, error) {
+	rows, err := db.impl.Query(
+		`SELECT n.id, n.kind, n.post, n.comment, n.conversation, n.created_at, n.read, `+userColumns+`
+         FROM notifications AS n
+         INNER JOIN users AS u
+         ON u.id = n.actor
+         WHERE n.recipient = ?
+         ORDER BY n.id DESC
+         LIMIT ?;`,
+		u.Id,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list notifications of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	ns := make([]core.Notification, 0, count)
+	for rows.Next() {
+		n := core.Notification{Recipient: u, Actor: &core.User{}}
+		var createdAt int64
+		rows.Scan(withUserFields(n.Actor, &n.Id, &n.Kind, &n.PostId, &n.CommentId, &n.ConversationId, &createdAt, &n.Read)...)
+		n.CreatedAt = time.Unix(createdAt, 0)
+
+		ns = append(ns, n)
+	}
+
+	return ns, nil
+}
+
+func (db *database) CountUnreadNotifications(u *core.User) (int, error) {
+	rows, err := db.impl.Query(
+		"SELECT COUNT(*) FROM notifications WHERE recipient = ? AND read = 0;",
+		u.Id)
+
+	if err != nil || rows == nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		rows.Scan(&count)
+	}
+
+	return count, nil
+}
+
+func (db *database) MarkNotificationsRead(u *core.User, id int) error {
+	_, err := db.impl.Exec(
+		"UPDATE notifications SET read = 1 WHERE recipient = ? AND (? = 0 OR id = ?);",
+		u.Id,
+		id,
+		id)
+
+	return err
+}
+
+func (db *database) GetNotificationOptOuts(u *core.User) ([]core.NotificationKind, error) {
+	rows, err := db.impl.Query(
+		"SELECT kind FROM notification_optouts WHERE user = ?;",
+		u.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list notification opt-outs of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	ks := []core.NotificationKind{}
+	for rows.Next() {
+		var k core.NotificationKind
+		rows.Scan(&k)
+
+		ks = append(ks, k)
+	}
+
+	return ks, nil
+}
+
+func (db *database) SetNotificationOptOut(u *core.User, k core.NotificationKind, optOut bool) error {
+	query := "DELETE FROM notification_optouts WHERE user = ? AND kind = ?;"
+	if optOut {
+		query = "INSERT OR IGNORE INTO notification_optouts (user, kind) VALUES (?, ?);"
+	}
+
+	_, err := db.impl.Exec(query, u.Id, k)
+	return err
+}
+
+func (db *database) GetDueDigestUsers(f core.DigestFrequency, sentBefore time.Time) ([]core.User, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+userColumns+`
+         FROM users AS u
+         WHERE u.digest_frequency = ? AND u.email != '' AND u.last_digest_at < ?;`,
+		f,
+		sentBefore.Unix())
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list %v digest users due to %v\n", f, err)
+	}
+	defer rows.Close()
+
+	us := []core.User{}
+	for rows.Next() {
+		u := core.User{}
+		rows.Scan(userFields(&u)...)
+
+		us = append(us, u)
+	}
+
+	return us, nil
+}
+
+func (db *database) MarkDigestSent(u *core.User, at time.Time) error {
+	_, err := db.impl.Exec(
+		"UPDATE users SET last_digest_at = ? WHERE id = ?;",
+		at.Unix(),
+		u.Id)
+
+	return err
+}
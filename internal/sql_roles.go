@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) SetUserRole(u *core.User, role core.Role) error {
+	_, err := db.impl.Exec("UPDATE users SET role = ? WHERE id = ?;", role, u.Id)
+	if err != nil {
+		return err
+	}
+
+	u.Role = role
+	return nil
+}
+
+func (db *database) GetStaff() ([]core.User, error) {
+	rows, err := db.impl.Query(
+		`SELECT ` + userColumns + `
+         FROM users AS u
+         WHERE u.role != 0
+         ORDER BY u.role DESC, u.login;`)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list staff due to %v\n", err)
+	}
+	defer rows.Close()
+
+	us := []core.User{}
+	for rows.Next() {
+		u := core.User{}
+		rows.Scan(userFields(&u)...)
+
+		us = append(us, u)
+	}
+
+	return us, nil
+}
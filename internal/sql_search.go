@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// snippetTokens is how many tokens around the match snippets show.
+const snippetTokens = 12
+
+// ftsQuery turns what a user typed into an FTS5 query matching documents
+// containing all the words, the last one also as a prefix. Every word is
+// quoted so FTS5 operators and syntax errors cannot be typed in.
+func ftsQuery(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+
+	if len(words) != 0 {
+		words[len(words)-1] += "*"
+	}
+
+	return strings.Join(words, " ")
+}
+
+func (db *database) Search(viewer *core.User, kind core.SearchKind, query string, offset int, count int) ([]core.SearchHit, int, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return []core.SearchHit{}, 0, nil
+	}
+
+	// Hits viewer may not see are left out in SQL, authors Hides from viewer
+	// too. One more row than asked tells whether there is a next page.
+	hidden, hiddenArgs := `0`, []any{}
+	if viewer != nil {
+		hidden, hiddenArgs = hidesClause("u.id", viewer)
+	}
+
+	var rows *sql.Rows
+	var err error
+
+	switch kind {
+	case core.SearchUsers:
+		// Logins are public, bios only match if the profile is visible.
+		visible, visibleArgs := visibleProfileClause(viewer)
+		loginMatched := `f.rowid IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?)`
+		login := "login : (" + match + ")"
+
+		args := []any{core.SnippetOpen, core.SnippetClose, core.SnippetOpen, core.SnippetClose, snippetTokens, login}
+		args = append(append(args, visibleArgs...), match, login)
+		args = append(append(args, visibleArgs...), hiddenArgs...)
+
+		rows, err = db.impl.Query(
+			`SELECT highlight(users_fts, 0, ?, ?), snippet(users_fts, 1, ?, ?, '...', ?),
+                 `+loginMatched+`, `+visible+`, `+userColumns+`
+             FROM users_fts AS f
+             INNER JOIN users AS u
+             ON u.id = f.rowid
+             WHERE users_fts MATCH ? AND (`+loginMatched+` OR `+visible+`) AND NOT `+hidden+`
+             ORDER BY bm25(users_fts, 10.0, 1.0)
+             LIMIT ? OFFSET ?;`,
+			append(args, count+1, offset)...)
+	case core.SearchPosts:
+		visible, visibleArgs := visiblePostsClause(viewer, true)
+
+		rows, err = db.impl.Query(
+			`SELECT snippet(posts_fts, 0, ?, ?, '...', ?), p.id, p.content, p.visibility, p.repost_of, p.hidden, p.created_at, `+userColumns+`
+             FROM posts_fts AS f
+             INNER JOIN posts AS p
+             ON p.id = f.rowid
+             INNER JOIN users AS u
+             ON u.id = p.author
+             WHERE posts_fts MATCH ? AND p.hidden = 0 AND `+visible+`
+             ORDER BY bm25(posts_fts)
+             LIMIT ? OFFSET ?;`,
+			append(append([]any{core.SnippetOpen, core.SnippetClose, snippetTokens, match}, visibleArgs...), count+1, offset)...)
+	case core.SearchComments:
+		// The post is matched in a subquery, u is the author of the comment.
+		visible, visibleArgs := visiblePostsClause(viewer, false)
+
+		args := append([]any{core.SnippetOpen, core.SnippetClose, snippetTokens, match}, hiddenArgs...)
+		args = append(append(args, visibleArgs...), count+1, offset)
+
+		rows, err = db.impl.Query(
+			`SELECT snippet(comments_fts, 0, ?, ?, '...', ?), c.id, c.commented_post, c.content, c.parent_comment, c.hidden, c.created_at, `+userColumns+`
+             FROM comments_fts AS f
+             INNER JOIN comments AS c
+             ON c.id = f.rowid
+             INNER JOIN users AS u
+             ON u.id = c.author
+             WHERE comments_fts MATCH ? AND c.hidden = 0 AND NOT `+hidden+`
+             AND EXISTS (
+                 SELECT 1 FROM posts AS p
+                 INNER JOIN users AS u
+                 ON u.id = p.author
+                 WHERE p.id = c.commented_post AND p.hidden = 0 AND `+visible+`)
+             ORDER BY bm25(comments_fts)
+             LIMIT ? OFFSET ?;`,
+			args...)
+	default:
+		return nil, 0, fmt.Errorf("Cannot search %v\n", kind)
+	}
+
+	if err != nil || rows == nil {
+		return nil, 0, fmt.Errorf("Failed to search %v for %v due to %v\n", kind, query, err)
+	}
+	defer rows.Close()
+
+	hits := make([]core.SearchHit, 0, count)
+	for rows.Next() {
+		if len(hits) == count {
+			return hits, offset + count, nil
+		}
+
+		hit := core.SearchHit{}
+		switch kind {
+		case core.SearchUsers:
+			var loginSnippet, bioSnippet string
+			var loginMatched, visible bool
+			hit.User = &core.User{}
+			rows.Scan(withUserFields(hit.User, &loginSnippet, &bioSnippet, &loginMatched, &visible)...)
+
+			hit.Snippet = loginSnippet
+			if visible && !loginMatched {
+				hit.Snippet = bioSnippet
+			}
+		case core.SearchPosts:
+			hit.Post = &core.Post{Author: &core.User{}}
+			rows.Scan(withUserFields(hit.Post.Author, &hit.Snippet, &hit.Post.Id, &hit.Post.Content, &hit.Post.Visibility, &hit.Post.RepostOfId, &hit.Post.Hidden, unixTime{&hit.Post.CreatedAt})...)
+		case core.SearchComments:
+			hit.Comment = &core.Comment{Author: &core.User{}, CommentedPost: &core.Post{}}
+			rows.Scan(withUserFields(hit.Comment.Author, &hit.Snippet, &hit.Comment.Id, &hit.Comment.CommentedPost.Id, &hit.Comment.Content, &hit.Comment.ParentId, &hit.Comment.Hidden, unixTime{&hit.Comment.CreatedAt})...)
+		}
+
+		hits = append(hits, hit)
+	}
+
+	return hits, 0, nil
+}
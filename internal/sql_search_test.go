@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func TestSearchLeavesOutWhatViewerMayNotSee(t *testing.T) {
+	db := newTestDatabase(t)
+	if _, err := db.(*database).impl.Exec("SELECT 1 FROM posts_fts LIMIT 1;"); err != nil {
+		t.Skip("Search needs go test -tags sqlite_fts5")
+	}
+
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	eve := createTestUser(t, db, "eve")
+
+	bob.Bio = []byte("hello from a private profile")
+	bob.Visibility = core.VisibilityFriends
+	if err := db.UpdateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(author *core.User, v core.Visibility) *core.Post {
+		t.Helper()
+
+		p := &core.Post{Author: author, Content: []byte("hello world"), Visibility: v}
+		if err := db.CreatePost(p); err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	search := func(viewer *core.User, kind core.SearchKind, offset int, count int) ([]core.SearchHit, int) {
+		t.Helper()
+
+		hits, next, err := db.Search(viewer, kind, "hello", offset, count)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return hits, next
+	}
+
+	public := post(alice, core.VisibilityPublic)
+	post(alice, core.VisibilityPublic)
+	post(alice, core.VisibilityPublic)
+	if err := db.SetPostHidden(post(alice, core.VisibilityPublic), true); err != nil {
+		t.Fatal(err)
+	}
+	private := post(bob, core.VisibilityPublic)
+
+	c := &core.Comment{Author: alice, CommentedPost: private, Content: []byte("hello bob")}
+	if err := db.CreateComment(c); err != nil {
+		t.Fatal(err)
+	}
+	c = &core.Comment{Author: eve, CommentedPost: public, Content: []byte("hello alice")}
+	if err := db.CreateComment(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages stop at count, the hidden post and the posts of the private
+	// profile of bob are left out.
+	hits, next := search(nil, core.SearchPosts, 0, 2)
+	if len(hits) != 2 || next != 2 {
+		t.Errorf("First page has %v posts and next %v", len(hits), next)
+	}
+
+	hits, next = search(nil, core.SearchPosts, 2, 2)
+	if len(hits) != 1 || next != 0 || hits[0].Post.Author.Id != alice.Id {
+		t.Errorf("Last page has %+v and next %v", hits, next)
+	}
+
+	hits, _ = search(bob, core.SearchPosts, 0, 10)
+	if len(hits) != 4 {
+		t.Errorf("Bob finds %v posts", len(hits))
+	}
+
+	hits, _ = search(nil, core.SearchComments, 0, 10)
+	if len(hits) != 1 || hits[0].Comment.Author.Id != eve.Id || hits[0].Comment.CommentedPost.Id != public.Id {
+		t.Errorf("Comments found are %+v", hits)
+	}
+
+	// Bios of private profiles do not match, logins do.
+	if hits, _ := search(nil, core.SearchUsers, 0, 10); len(hits) != 0 {
+		t.Errorf("The private bio of bob matched: %+v", hits)
+	}
+	if hits, _, err := db.Search(nil, core.SearchUsers, "bob", 0, 10); err != nil || len(hits) != 1 {
+		t.Errorf("The login of bob did not match: %+v", hits)
+	}
+
+	// Muted authors are left out.
+	if err := db.SetBlock(eve, alice, core.BlockKindMute, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits, _ := search(eve, core.SearchPosts, 0, 10); len(hits) != 0 {
+		t.Errorf("Eve finds muted posts of alice: %+v", hits)
+	}
+
+	// The own comment of eve on a post of alice is still found.
+	if hits, _ := search(eve, core.SearchComments, 0, 10); len(hits) != 1 {
+		t.Errorf("Eve finds %v comments", len(hits))
+	}
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) CreateSession(s *core.Session) error {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	s.LastSeenAt = s.CreatedAt
+
+	result, err := db.impl.Exec(
+		`INSERT INTO sessions (user, address, user_agent, created_at, last_seen_at)
+         VALUES (?, ?, ?, ?, ?);`,
+		s.User.Id,
+		s.Address,
+		s.UserAgent,
+		s.CreatedAt.Unix(),
+		s.LastSeenAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	s.Id = int(lastInsertId)
+	return nil
+}
+
+const sessionColumns = `s.id, s.address, s.user_agent, s.created_at, s.last_seen_at, s.revoked`
+
+func sessionFields(s *core.Session) []any {
+	return []any{&s.Id, &s.Address, &s.UserAgent, unixTime{&s.CreatedAt}, unixTime{&s.LastSeenAt}, &s.Revoked}
+}
+
+func (db *database) LoadSession(id int) (*core.Session, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+sessionColumns+`, `+userColumns+`
+         FROM sessions AS s
+         INNER JOIN users AS u
+         ON u.id = s.user
+         WHERE s.id = ?;`,
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s := &core.Session{User: &core.User{}}
+	if rows.Next() {
+		rows.Scan(append(sessionFields(s), userFields(s.User)...)...)
+	} else {
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return s, nil
+}
+
+func (db *database) TouchSession(s *core.Session) error {
+	now := time.Now()
+	_, err := db.impl.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?;", now.Unix(), s.Id)
+	if err != nil {
+		return err
+	}
+
+	s.LastSeenAt = now
+	return nil
+}
+
+func (db *database) RevokeSession(s *core.Session) error {
+	_, err := db.impl.Exec("UPDATE sessions SET revoked = 1 WHERE id = ?;", s.Id)
+	if err != nil {
+		return err
+	}
+
+	s.Revoked = true
+	return nil
+}
+
+func (db *database) RevokeSessions(u *core.User) error {
+	_, err := db.impl.Exec("UPDATE sessions SET revoked = 1 WHERE user = ?;", u.Id)
+	return err
+}
+
+func (db *database) GetSessions(u *core.User) ([]core.Session, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+sessionColumns+`
+         FROM sessions AS s
+         WHERE s.user = ? AND s.revoked = 0
+         ORDER BY s.last_seen_at DESC;`,
+		u.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list sessions of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	ss := []core.Session{}
+	for rows.Next() {
+		s := core.Session{User: u}
+		rows.Scan(sessionFields(&s)...)
+
+		ss = append(ss, s)
+	}
+
+	return ss, nil
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func (db *database) SetPostTags(p *core.Post, tags []string, at time.Time) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tagIds := []interface{}{p.Id}
+	for _, tag := range tags {
+		_, err = tx.Exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT(name) DO NOTHING;", tag)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO post_tags (post, tag, created_at)
+             SELECT ?, id, ? FROM tags WHERE name = ?
+             ON CONFLICT(post, tag) DO NOTHING;`,
+			p.Id,
+			at.Unix(),
+			tag)
+
+		if err != nil {
+			return err
+		}
+
+		tagIds = append(tagIds, tag)
+	}
+
+	placeholders := ""
+	for range tags {
+		placeholders += ", ?"
+	}
+
+	// Tags removed by an edit are dropped, "" never names a tag.
+	_, err = tx.Exec(
+		`DELETE FROM post_tags WHERE post = ? AND tag NOT IN
+             (SELECT id FROM tags WHERE name IN (''`+placeholders+`));`,
+		tagIds...)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *database) GetPostTags(p *core.Post) ([]string, error) {
+	rows, err := db.impl.Query(
+		`SELECT t.name FROM post_tags AS pt
+         INNER JOIN tags AS t
+         ON t.id = pt.tag
+         WHERE pt.post = ?
+         ORDER BY t.name;`,
+		p.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list tags of post %v due to %v\n", p.Id, err)
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		rows.Scan(&tag)
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (db *database) GetPostsByTag(viewer *core.User, tag string, count int) ([]core.Post, error) {
+	visible, args := visiblePostsClause(viewer, true)
+	rows, err := db.impl.Query(
+		`SELECT p.id, p.content, p.visibility, p.repost_of, p.hidden, p.created_at, `+userColumns+`
+         FROM post_tags AS pt
+         INNER JOIN tags AS t
+         ON t.id = pt.tag
+         INNER JOIN posts AS p
+         ON p.id = pt.post
+         INNER JOIN users AS u
+         ON u.id = p.author
+         WHERE t.name = ? AND `+visible+`
+         ORDER BY p.id DESC
+         LIMIT ?;`,
+		append(append([]any{tag}, args...), count)...)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list posts tagged %v due to %v\n", tag, err)
+	}
+	defer rows.Close()
+
+	ps := make([]core.Post, 0, count)
+	for rows.Next() {
+		p := core.Post{Author: &core.User{}}
+		rows.Scan(withUserFields(p.Author, &p.Id, &p.Content, &p.Visibility, &p.RepostOfId, &p.Hidden, unixTime{&p.CreatedAt})...)
+
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
+
+func (db *database) GetTrendingTags(since time.Time, halfLife time.Duration, count int) ([]core.TrendingTag, error) {
+	// Only posts anyone may see count, so trending tags leak nothing, and
+	// moderators taking a post or its author down takes its tags down too.
+	rows, err := db.impl.Query(
+		`SELECT t.name, pt.created_at
+         FROM post_tags AS pt
+         INNER JOIN tags AS t
+         ON t.id = pt.tag
+         INNER JOIN posts AS p
+         ON p.id = pt.post
+         INNER JOIN users AS u
+         ON u.id = p.author
+         WHERE pt.created_at >= ? AND p.visibility = ? AND u.visibility = ?
+         AND p.hidden = 0 AND u.suspended = 0;`,
+		since.Unix(),
+		core.VisibilityPublic,
+		core.VisibilityPublic)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list tags used since %v due to %v\n", since, err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	byName := map[string]*core.TrendingTag{}
+	for rows.Next() {
+		var name string
+		var createdAt int64
+		rows.Scan(&name, &createdAt)
+
+		t, ok := byName[name]
+		if !ok {
+			t = &core.TrendingTag{Name: name}
+			byName[name] = t
+		}
+
+		age := now.Sub(time.Unix(createdAt, 0))
+		t.Posts++
+		t.Score += math.Pow(0.5, float64(age)/float64(halfLife))
+	}
+
+	ts := make([]core.TrendingTag, 0, len(byName))
+	for _, t := range byName {
+		ts = append(ts, *t)
+	}
+
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Score != ts[j].Score {
+			return ts[i].Score > ts[j].Score
+		}
+		return ts[i].Name < ts[j].Name
+	})
+
+	if len(ts) > count {
+		ts = ts[:count]
+	}
+
+	return ts, nil
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+	"github.com/JouleJ/socnet/internal/testdb"
+)
+
+// newTestDatabase opens a new database until the end of t.
+func newTestDatabase(t *testing.T) core.Database {
+	t.Helper()
+
+	testdb.Create(t)
+	db := NewDatabase()
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+// createTestUser signs up login with testdb.Password.
+func createTestUser(t *testing.T, db core.Database, login string) *core.User {
+	t.Helper()
+
+	return testdb.CreateUser(t, db, login, GetHash([]byte(testdb.Password)))
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func formatScopes(scopes []core.Scope) string {
+	names := []string{}
+	for _, s := range scopes {
+		names = append(names, s.String())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func parseScopes(s string) []core.Scope {
+	scopes := []core.Scope{}
+	for _, name := range strings.Split(s, ",") {
+		if name == "" {
+			continue
+		}
+
+		scope, err := core.ParseScope(name)
+		if err != nil {
+			log.Printf("Ignoring stored scope: %v\n", err)
+			continue
+		}
+
+		scopes = append(scopes, scope)
+	}
+
+	return scopes
+}
+
+func (db *database) CreateAccessToken(t *core.AccessToken, hash string) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+
+	result, err := db.impl.Exec(
+		`INSERT INTO access_tokens (user, name, token_hash, scopes, created_at, expires_at)
+         VALUES (?, ?, ?, ?, ?, ?);`,
+		t.User.Id,
+		t.Name,
+		hash,
+		formatScopes(t.Scopes),
+		t.CreatedAt.Unix(),
+		storedTime(t.ExpiresAt))
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	t.Id = int(lastInsertId)
+	return nil
+}
+
+const accessTokenColumns = `t.id, t.name, t.scopes, t.created_at, t.expires_at, t.last_used_at, t.revoked`
+
+// scanAccessToken scans the accessTokenColumns of rows, and more into more.
+func scanAccessToken(rows interface{ Scan(...any) error }, t *core.AccessToken, more ...any) error {
+	scopes := ""
+	fields := []any{&t.Id, &t.Name, &scopes, unixTime{&t.CreatedAt}, unixTime{&t.ExpiresAt}, unixTime{&t.LastUsedAt}, &t.Revoked}
+
+	if err := rows.Scan(append(fields, more...)...); err != nil {
+		return err
+	}
+
+	t.Scopes = parseScopes(scopes)
+	return nil
+}
+
+func (db *database) loadAccessToken(where string, arg any) (*core.AccessToken, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+accessTokenColumns+`, `+userColumns+`
+         FROM access_tokens AS t
+         INNER JOIN users AS u
+         ON u.id = t.user
+         WHERE `+where+`;`,
+		arg)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := &core.AccessToken{User: &core.User{}}
+	if rows.Next() {
+		scanAccessToken(rows, t, userFields(t.User)...)
+	} else {
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return t, nil
+}
+
+func (db *database) LoadAccessToken(id int) (*core.AccessToken, error) {
+	return db.loadAccessToken("t.id = ?", id)
+}
+
+func (db *database) FindAccessToken(hash string) (*core.AccessToken, error) {
+	return db.loadAccessToken("t.token_hash = ?", hash)
+}
+
+func (db *database) TouchAccessToken(t *core.AccessToken) error {
+	now := time.Now()
+	_, err := db.impl.Exec("UPDATE access_tokens SET last_used_at = ? WHERE id = ?;", now.Unix(), t.Id)
+	if err != nil {
+		return err
+	}
+
+	t.LastUsedAt = now
+	return nil
+}
+
+func (db *database) RevokeAccessToken(t *core.AccessToken) error {
+	_, err := db.impl.Exec("UPDATE access_tokens SET revoked = 1 WHERE id = ?;", t.Id)
+	if err != nil {
+		return err
+	}
+
+	t.Revoked = true
+	return nil
+}
+
+func (db *database) RevokeAccessTokens(u *core.User) error {
+	_, err := db.impl.Exec("UPDATE access_tokens SET revoked = 1 WHERE user = ?;", u.Id)
+	return err
+}
+
+func (db *database) GetAccessTokens(u *core.User) ([]core.AccessToken, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+accessTokenColumns+`
+         FROM access_tokens AS t
+         WHERE t.user = ? AND t.revoked = 0
+         ORDER BY t.id DESC;`,
+		u.Id)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list access tokens of user %v due to %v\n", u.Id, err)
+	}
+	defer rows.Close()
+
+	ts := []core.AccessToken{}
+	for rows.Next() {
+		t := core.AccessToken{User: u}
+		scanAccessToken(rows, &t)
+
+		ts = append(ts, t)
+	}
+
+	return ts, nil
+}
@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+func formatWebhookEvents(events []core.WebhookEvent) string {
+	names := []string{}
+	for _, e := range events {
+		names = append(names, e.String())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func parseWebhookEvents(s string) []core.WebhookEvent {
+	events := []core.WebhookEvent{}
+	for _, name := range strings.Split(s, ",") {
+		if name == "" {
+			continue
+		}
+
+		e, err := core.ParseWebhookEvent(name)
+		if err != nil {
+			log.Printf("Ignoring stored webhook event: %v\n", err)
+			continue
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func (db *database) CreateWebhook(h *core.Webhook) error {
+	if h.CreatedAt.IsZero() {
+		h.CreatedAt = time.Now()
+	}
+
+	result, err := db.impl.Exec(
+		`INSERT INTO webhooks (owner, url, secret, events, created_at)
+         VALUES (?, ?, ?, ?, ?);`,
+		h.Owner.Id,
+		h.Url,
+		h.Secret,
+		formatWebhookEvents(h.Events),
+		h.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	h.Id = int(lastInsertId)
+	return nil
+}
+
+const webhookColumns = `h.id, h.url, h.secret, h.events, h.failures, h.disabled, h.created_at`
+
+// scanWebhook scans the columns before, then the webhookColumns and the
+// userColumns of rows into h and its owner.
+func scanWebhook(rows interface{ Scan(...any) error }, h *core.Webhook, before ...any) error {
+	events := ""
+	fields := append(before, &h.Id, &h.Url, &h.Secret, &events, &h.Failures, &h.Disabled, unixTime{&h.CreatedAt})
+
+	if err := rows.Scan(append(fields, userFields(h.Owner)...)...); err != nil {
+		return err
+	}
+
+	h.Events = parseWebhookEvents(events)
+	return nil
+}
+
+func (db *database) LoadWebhook(id int) (*core.Webhook, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+webhookColumns+`, `+userColumns+`
+         FROM webhooks AS h
+         INNER JOIN users AS u
+         ON u.id = h.owner
+         WHERE h.id = ?;`,
+		id)
+
+	if err != nil || rows == nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := &core.Webhook{Owner: &core.User{}}
+	if rows.Next() {
+		scanWebhook(rows, h)
+	} else {
+		return nil, fmt.Errorf("Failed to scan rows\n")
+	}
+
+	return h, nil
+}
+
+func (db *database) GetWebhooks(owner *core.User) ([]core.Webhook, error) {
+	ownerId := 0
+	if owner != nil {
+		ownerId = owner.Id
+	}
+
+	rows, err := db.impl.Query(
+		`SELECT `+webhookColumns+`, `+userColumns+`
+         FROM webhooks AS h
+         INNER JOIN users AS u
+         ON u.id = h.owner
+         WHERE ?1 = 0 OR h.owner = ?1
+         ORDER BY h.id DESC;`,
+		ownerId)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list webhooks of user %v due to %v\n", ownerId, err)
+	}
+	defer rows.Close()
+
+	hs := []core.Webhook{}
+	for rows.Next() {
+		h := core.Webhook{Owner: &core.User{}}
+		scanWebhook(rows, &h)
+
+		hs = append(hs, h)
+	}
+
+	return hs, nil
+}
+
+func (db *database) SetWebhookState(h *core.Webhook) error {
+	_, err := db.impl.Exec("UPDATE webhooks SET failures = ?, disabled = ? WHERE id = ?;", h.Failures, h.Disabled, h.Id)
+	return err
+}
+
+func (db *database) DeleteWebhook(h *core.Webhook) error {
+	tx, err := db.impl.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM webhook_deliveries WHERE webhook = ?;",
+		"DELETE FROM webhooks WHERE id = ?;",
+	} {
+		if _, err := tx.Exec(query, h.Id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to delete webhook %v due to %v\n", h.Id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *database) CreateWebhookDelivery(d *core.WebhookDelivery) error {
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+
+	if d.NextAttemptAt.IsZero() {
+		d.NextAttemptAt = d.CreatedAt
+	}
+
+	result, err := db.impl.Exec(
+		`INSERT INTO webhook_deliveries (webhook, event, payload, status, next_attempt_at, created_at)
+         VALUES (?, ?, ?, ?, ?, ?);`,
+		d.Webhook.Id,
+		d.Event,
+		d.Payload,
+		d.Status,
+		d.NextAttemptAt.Unix(),
+		d.CreatedAt.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	d.Id = int(lastInsertId)
+	return nil
+}
+
+func (db *database) UpdateWebhookDelivery(d *core.WebhookDelivery) error {
+	_, err := db.impl.Exec(
+		`UPDATE webhook_deliveries
+         SET status = ?, attempts = ?, next_attempt_at = ?, response_code = ?, error = ?, delivered_at = ?
+         WHERE id = ?;`,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt.Unix(),
+		d.ResponseCode,
+		d.Error,
+		storedTime(d.DeliveredAt),
+		d.Id)
+
+	return err
+}
+
+const webhookDeliveryColumns = `d.id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.response_code, d.error, d.created_at, d.delivered_at`
+
+func webhookDeliveryFields(d *core.WebhookDelivery) []any {
+	return []any{
+		&d.Id, &d.Event, &d.Payload, &d.Status, &d.Attempts, unixTime{&d.NextAttemptAt},
+		&d.ResponseCode, &d.Error, unixTime{&d.CreatedAt}, unixTime{&d.DeliveredAt},
+	}
+}
+
+func (db *database) GetDueWebhookDeliveries(now time.Time, count int) ([]core.WebhookDelivery, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+webhookDeliveryColumns+`, `+webhookColumns+`, `+userColumns+`
+         FROM webhook_deliveries AS d
+         INNER JOIN webhooks AS h
+         ON h.id = d.webhook
+         INNER JOIN users AS u
+         ON u.id = h.owner
+         WHERE d.status = ? AND d.next_attempt_at <= ? AND d.event != ?
+         ORDER BY d.next_attempt_at, d.id
+         LIMIT ?;`,
+		core.DeliveryPending,
+		now.Unix(),
+		core.WebhookTest,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list due webhook deliveries due to %v\n", err)
+	}
+	defer rows.Close()
+
+	ds := []core.WebhookDelivery{}
+	for rows.Next() {
+		d := core.WebhookDelivery{Webhook: &core.Webhook{Owner: &core.User{}}}
+		scanWebhook(rows, d.Webhook, webhookDeliveryFields(&d)...)
+
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
+
+func (db *database) GetWebhookDeliveries(h *core.Webhook, count int) ([]core.WebhookDelivery, error) {
+	rows, err := db.impl.Query(
+		`SELECT `+webhookDeliveryColumns+`
+         FROM webhook_deliveries AS d
+         WHERE d.webhook = ?
+         ORDER BY d.id DESC
+         LIMIT ?;`,
+		h.Id,
+		count)
+
+	if err != nil || rows == nil {
+		return nil, fmt.Errorf("Failed to list deliveries of webhook %v due to %v\n", h.Id, err)
+	}
+	defer rows.Close()
+
+	ds := []core.WebhookDelivery{}
+	for rows.Next() {
+		d := core.WebhookDelivery{Webhook: h}
+		rows.Scan(webhookDeliveryFields(&d)...)
+
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
@@ -0,0 +1,17 @@
+package internal
+
+import (
+	"log"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// TagPost stores the hashtags of p after it was created or edited. Like
+// notifications, failures are only logged.
+func TagPost(db core.Database, p *core.Post) {
+	err := db.SetPostTags(p, core.ExtractHashtags(p.Content), time.Now())
+	if err != nil {
+		log.Printf("Failed to tag post %v: %v\n", p.Id, err)
+	}
+}
@@ -0,0 +1,68 @@
+// Package testdb makes the databases the tests of the other packages run
+// against.
+package testdb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/JouleJ/socnet/core"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Password is the password of the users of CreateUser.
+const Password = "password"
+
+// searchSchemaStart starts the part of create_tables.txt that needs FTS5,
+// which plain go test builds of the driver do not have.
+const searchSchemaStart = "-- Full-text search indexes"
+
+// Create points VOLUME_PATH at a new database made from create_tables.txt
+// until the end of t, for NewDatabase to open.
+func Create(t testing.TB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("VOLUME_PATH", dir)
+	// The driver refuses to store hashes with the high bit set, which this
+	// salt keeps clear for Password.
+	t.Setenv("SALT", "salt")
+
+	_, source, _, _ := runtime.Caller(0)
+	schema, err := os.ReadFile(filepath.Join(filepath.Dir(source), "..", "..", "create_tables.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "database.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tables, search, _ := strings.Cut(string(schema), searchSchemaStart)
+	if _, err := db.Exec(tables); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	if _, err := db.Exec(searchSchemaStart + search); err != nil && !strings.Contains(err.Error(), "fts5") {
+		t.Fatalf("Failed to create search indexes: %v", err)
+	}
+}
+
+// CreateUser signs up login in db, passwordHash must be the hash of
+// Password.
+func CreateUser(t testing.TB, db core.Database, login string, passwordHash uint64) *core.User {
+	t.Helper()
+
+	u := &core.User{Login: login, PasswordHash: passwordHash, Bio: []byte("Bio of " + login)}
+	if err := db.CreateUser(u); err != nil {
+		t.Fatalf("Failed to create user %v: %v", login, err)
+	}
+
+	return u
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// accessTokenPrefix starts every personal access token, which tells them
+// from session tokens and makes them easy to find in leaked text.
+const accessTokenPrefix = "socnet_pat_"
+
+// NewAccessTokenSecret returns a new random personal access token.
+func NewAccessTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate access token due to %v\n", err)
+	}
+
+	return accessTokenPrefix + hex.EncodeToString(b), nil
+}
+
+// HashAccessToken returns the hash secret is stored as. Secrets are random,
+// so they need neither salt nor a slow hash.
+func HashAccessToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAccessTokenSecret(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+// loadAccessToken returns the personal access token of secret if it is
+// still valid.
+func loadAccessToken(secret string, db core.Database) (*core.AccessToken, error) {
+	t, err := db.FindAccessToken(HashAccessToken(secret))
+	if err != nil {
+		return nil, fmt.Errorf("Unknown access token: %v", err)
+	}
+
+	if t.Revoked {
+		return nil, fmt.Errorf("Access token %v is revoked", t.Id)
+	}
+
+	if t.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("Access token %v expired at %v", t.Id, t.ExpiresAt)
+	}
+
+	if t.User.Suspended {
+		return nil, fmt.Errorf("User %v is suspended", t.User.Id)
+	}
+
+	if time.Since(t.LastUsedAt) > sessionTouchInterval {
+		if err := db.TouchAccessToken(t); err != nil {
+			log.Printf("Failed to touch access token %v: %v\n", t.Id, err)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+const (
+	// webhookMaxAttempts is how many times a delivery is tried before it
+	// is given up.
+	webhookMaxAttempts = 6
+	// webhookRetryDelay is the wait before the second attempt, each later
+	// attempt waits twice as long as the one before.
+	webhookRetryDelay = 30 * time.Second
+	// webhookFailureLimit is how many attempts in a row may fail before
+	// the webhook is disabled.
+	webhookFailureLimit = 10
+	webhookTimeout      = 10 * time.Second
+	webhookBatchSize    = 100
+	// maxWebhookResponseSize is how much of a response is read, only to
+	// let the connection be reused.
+	maxWebhookResponseSize = 64 << 10
+)
+
+// WebhookClient sends the requests of webhook deliveries. *http.Client is
+// one, the client of an httptest.Server can stand in for it.
+type WebhookClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// NewWebhookClient returns the client delivering webhooks. Unless
+// WEBHOOK_ALLOW_PRIVATE is set, it refuses to connect to loopback and
+// private addresses, so webhooks cannot reach into the network of the
+// server.
+func NewWebhookClient() WebhookClient {
+	return newOutboundClient(os.Getenv("WEBHOOK_ALLOW_PRIVATE") != "", webhookTimeout)
+}
+
+// newOutboundClient returns a client for addresses given by users or other
+// servers, refusing loopback and private addresses unless allowPrivate.
+func newOutboundClient(allowPrivate bool, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return fmt.Errorf("Refusing to connect to private address %v", host)
+			}
+
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+}
+
+// ValidateWebhookUrl tells why s cannot be the address of a webhook.
+func ValidateWebhookUrl(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("Invalid webhook URL %q: %v", s, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Webhook URL %q is not an absolute http or https URL", s)
+	}
+
+	return nil
+}
+
+// NewWebhookSecret returns a new random key to sign deliveries with.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate webhook secret due to %v\n", err)
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhook returns the X-Socnet-Signature of body sent at timestamp, a
+// hex HMAC-SHA256 keyed by secret of the timestamp, a dot and the body.
+// Signing the timestamp lets receivers refuse replayed deliveries.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%v.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%v,v1=%v", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// webhookPayload is the body of every delivery, Data is shown as the API
+// shows it to the owner of the webhook.
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// queueWebhooks queues a delivery of data to every enabled webhook of owner
+// subscribing to event. Failures are only logged: a webhook must never break
+// the operation that caused it.
+func queueWebhooks(db core.Database, owner *core.User, event core.WebhookEvent, data any) {
+	hs, err := db.GetWebhooks(owner)
+	if err != nil {
+		log.Printf("Failed to load webhooks of %v: %v\n", owner.Id, err)
+		return
+	}
+
+	for i := range hs {
+		h := &hs[i]
+		if h.Disabled || !h.SubscribesTo(event) {
+			continue
+		}
+
+		if _, err := queueWebhookDelivery(db, h, event, data); err != nil {
+			log.Printf("Failed to queue %v for webhook %v: %v\n", event, h.Id, err)
+		}
+	}
+}
+
+func queueWebhookDelivery(db core.Database, h *core.Webhook, event core.WebhookEvent, data any) (*core.WebhookDelivery, error) {
+	now := time.Now()
+	payload, err := json.Marshal(webhookPayload{Event: event.String(), CreatedAt: now.UTC(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &core.WebhookDelivery{Webhook: h, Event: event, Payload: payload, Status: core.DeliveryPending, CreatedAt: now}
+	return d, db.CreateWebhookDelivery(d)
+}
+
+// HookPost tells the webhooks of the author of p about it.
+func HookPost(db core.Database, p *core.Post) {
+	ap, err := NewApiPost(p, p.Author, db)
+	if err != nil {
+		log.Printf("Failed to show post %v to webhooks: %v\n", p.Id, err)
+		return
+	}
+
+	queueWebhooks(db, p.Author, core.WebhookPost, ap)
+}
+
+// HookComment tells the webhooks of the author of the post of c about it,
+// unless they wrote c or hide its author.
+func HookComment(db core.Database, c *core.Comment) {
+	owner := c.CommentedPost.Author
+	if owner.Id == c.Author.Id || Hides(owner, c.Author, db) {
+		return
+	}
+
+	ac, err := NewApiComment(c, owner, db)
+	if err != nil {
+		log.Printf("Failed to show comment %v to webhooks: %v\n", c.Id, err)
+		return
+	}
+
+	queueWebhooks(db, owner, core.WebhookComment, ac)
+}
+
+// HookFollow tells the webhooks of followee about follower.
+func HookFollow(db core.Database, follower *core.User, followee *core.User) {
+	if Hides(followee, follower, db) {
+		return
+	}
+
+	queueWebhooks(db, followee, core.WebhookFollower, NewApiUser(follower, followee, db))
+}
+
+// HookMessage tells the webhooks of the members of the conversation of m
+// other than its author about it.
+func HookMessage(db core.Database, m *core.Message) {
+	for _, member := range m.Conversation.Members {
+		if member.User.Id == m.Author.Id || Hides(member.User, m.Author, db) {
+			continue
+		}
+
+		queueWebhooks(db, member.User, core.WebhookMessage, NewApiMessage(m, member.User, db))
+	}
+}
+
+// SendTestWebhook delivers a test event to h right away, once. The
+// dispatcher never picks up test deliveries, so it cannot send this one
+// a second time while it is pending.
+func SendTestWebhook(db core.Database, client WebhookClient, h *core.Webhook) (*core.WebhookDelivery, error) {
+	d, err := queueWebhookDelivery(db, h, core.WebhookTest, map[string]any{"webhook_id": h.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, DeliverWebhook(db, client, d, time.Now())
+}
+
+// postWebhook sends d to its webhook and returns the status of the answer.
+func postWebhook(client WebhookClient, d *core.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.Webhook.Url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "socnet-webhooks")
+	req.Header.Set("X-Socnet-Event", d.Event.String())
+	req.Header.Set("X-Socnet-Delivery", fmt.Sprint(d.Id))
+	req.Header.Set("X-Socnet-Signature", SignWebhook(d.Webhook.Secret, now.Unix(), d.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseSize))
+	return resp.StatusCode, nil
+}
+
+// DeliverWebhook makes an attempt at d and stores how it went. Failed
+// deliveries are retried with exponential backoff, except tests, and too
+// many failures in a row disable the webhook.
+func DeliverWebhook(db core.Database, client WebhookClient, d *core.WebhookDelivery, now time.Time) error {
+	h := d.Webhook
+	d.Attempts++
+
+	if h.Disabled && d.Event != core.WebhookTest {
+		d.Status = core.DeliveryFailed
+		d.Error = "The webhook is disabled"
+		return db.UpdateWebhookDelivery(d)
+	}
+
+	code, err := postWebhook(client, d, now)
+	if err == nil && (code < 200 || code > 299) {
+		err = fmt.Errorf("The receiver answered %v", code)
+	}
+
+	d.ResponseCode = code
+	d.Error = ""
+
+	if err == nil {
+		d.Status = core.DeliveryDelivered
+		d.DeliveredAt = now
+		h.Failures = 0
+	} else {
+		log.Printf("Failed to deliver %v to webhook %v: %v\n", d.Id, h.Id, err)
+
+		d.Error = err.Error()
+		if d.Event == core.WebhookTest || d.Attempts >= webhookMaxAttempts {
+			d.Status = core.DeliveryFailed
+		} else {
+			d.NextAttemptAt = now.Add(webhookRetryDelay << (d.Attempts - 1))
+		}
+
+		h.Failures++
+		if h.Failures >= webhookFailureLimit && !h.Disabled {
+			log.Printf("Disabling webhook %v after %v failures\n", h.Id, h.Failures)
+			h.Disabled = true
+		}
+	}
+
+	if err := db.UpdateWebhookDelivery(d); err != nil {
+		return err
+	}
+
+	return db.SetWebhookState(h)
+}
+
+// DeliverWebhooks makes an attempt at every delivery due by now.
+func DeliverWebhooks(db core.Database, client WebhookClient, now time.Time) {
+	ds, err := db.GetDueWebhookDeliveries(now, webhookBatchSize)
+	if err != nil {
+		log.Printf("Failed to load due webhook deliveries: %v\n", err)
+		return
+	}
+
+	// Deliveries to one webhook share it, so the failures of one count
+	// for the others.
+	hooks := map[int]*core.Webhook{}
+	for i := range ds {
+		d := &ds[i]
+		if h, found := hooks[d.Webhook.Id]; found {
+			d.Webhook = h
+		} else {
+			hooks[d.Webhook.Id] = d.Webhook
+		}
+
+		if err := DeliverWebhook(db, client, d, now); err != nil {
+			log.Printf("Failed to store delivery %v: %v\n", d.Id, err)
+		}
+	}
+}
+
+// RunWebhookDispatcher delivers due webhooks with client every interval.
+func RunWebhookDispatcher(client WebhookClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		db := NewDatabase()
+		DeliverWebhooks(db, client, now)
+		db.Close()
+	}
+}
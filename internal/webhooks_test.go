@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JouleJ/socnet/core"
+)
+
+// webhookReceiver is an httptest server standing in for the receiver of
+// webhooks, answering status to every request it keeps.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	rec := &webhookReceiver{status: status}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rec.mutex.Lock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, body)
+		status := rec.status
+		rec.mutex.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rec.Close)
+
+	return rec
+}
+
+func (rec *webhookReceiver) count() int {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	return len(rec.requests)
+}
+
+// newTestWebhook stores a webhook of a new user to rec for every event.
+func newTestWebhook(t *testing.T, db core.Database, rec *webhookReceiver) *core.Webhook {
+	t.Helper()
+
+	h := &core.Webhook{
+		Owner:  createTestUser(t, db, "owner"),
+		Url:    rec.URL + "/hook",
+		Secret: "whsec_test",
+		Events: core.WebhookEvents,
+	}
+	if err := db.CreateWebhook(h); err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func newTestDelivery(t *testing.T, db core.Database, h *core.Webhook) *core.WebhookDelivery {
+	t.Helper()
+
+	d, err := queueWebhookDelivery(db, h, core.WebhookPost, map[string]any{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestWebhookSignature(t *testing.T) {
+	db := newTestDatabase(t)
+	rec := newWebhookReceiver(t, http.StatusNoContent)
+	h := newTestWebhook(t, db, rec)
+	d := newTestDelivery(t, db, h)
+
+	now := time.Unix(1700000000, 0)
+	if err := DeliverWebhook(db, rec.Client(), d, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.count() != 1 {
+		t.Fatalf("The receiver got %v requests, not 1", rec.count())
+	}
+
+	r, body := rec.requests[0], rec.bodies[0]
+	if r.Header.Get("X-Socnet-Event") != "post.created" || r.Header.Get("X-Socnet-Delivery") != fmt.Sprint(d.Id) {
+		t.Errorf("Wrong event headers: %v", r.Header)
+	}
+
+	// Receivers check the signature as the documentation tells them to.
+	mac := hmac.New(sha256.New, []byte(h.Secret))
+	mac.Write([]byte(fmt.Sprintf("%v.", now.Unix())))
+	mac.Write(body)
+	expected := fmt.Sprintf("t=%v,v1=%v", now.Unix(), hex.EncodeToString(mac.Sum(nil)))
+	if signature := r.Header.Get("X-Socnet-Signature"); signature != expected {
+		t.Errorf("Signature %q, expected %q", signature, expected)
+	}
+
+	if d.Status != core.DeliveryDelivered || d.ResponseCode != http.StatusNoContent || !d.DeliveredAt.Equal(now) {
+		t.Errorf("Delivery is %v with %v at %v", d.Status, d.ResponseCode, d.DeliveredAt)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	db := newTestDatabase(t)
+	rec := newWebhookReceiver(t, http.StatusInternalServerError)
+	h := newTestWebhook(t, db, rec)
+	d := newTestDelivery(t, db, h)
+
+	now := time.Unix(1700000000, 0)
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if err := DeliverWebhook(db, rec.Client(), d, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Attempts != attempt || d.ResponseCode != http.StatusInternalServerError {
+			t.Fatalf("Attempt %v stored as %v answered %v", attempt, d.Attempts, d.ResponseCode)
+		}
+
+		if attempt == webhookMaxAttempts {
+			break
+		}
+
+		if d.Status != core.DeliveryPending {
+			t.Fatalf("Delivery is %v after attempt %v", d.Status, attempt)
+		}
+
+		delay := webhookRetryDelay << (attempt - 1)
+		if !d.NextAttemptAt.Equal(now.Add(delay)) {
+			t.Errorf("Attempt %v retries at %v, not %v later", attempt, d.NextAttemptAt, delay)
+		}
+
+		due, err := db.GetDueWebhookDeliveries(d.NextAttemptAt.Add(-time.Second), webhookBatchSize)
+		if err != nil || len(due) != 0 {
+			t.Errorf("Delivery is due before its retry: %v %v", due, err)
+		}
+
+		now = d.NextAttemptAt
+	}
+
+	if d.Status != core.DeliveryFailed {
+		t.Errorf("Delivery is %v after %v attempts", d.Status, webhookMaxAttempts)
+	}
+
+	due, err := db.GetDueWebhookDeliveries(now.Add(time.Hour), webhookBatchSize)
+	if err != nil || len(due) != 0 {
+		t.Errorf("Failed delivery is still due: %v %v", due, err)
+	}
+
+	if rec.count() != webhookMaxAttempts {
+		t.Errorf("The receiver got %v requests, not %v", rec.count(), webhookMaxAttempts)
+	}
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	db := newTestDatabase(t)
+	rec := newWebhookReceiver(t, http.StatusBadGateway)
+	h := newTestWebhook(t, db, rec)
+
+	now := time.Unix(1700000000, 0)
+	for i := 1; i <= webhookFailureLimit; i++ {
+		if h.Disabled {
+			t.Fatalf("Webhook disabled after %v failures", i-1)
+		}
+
+		if err := DeliverWebhook(db, rec.Client(), newTestDelivery(t, db, h), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := db.LoadWebhook(h.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored.Disabled || stored.Failures != webhookFailureLimit {
+		t.Fatalf("Webhook stored as disabled=%v with %v failures", stored.Disabled, stored.Failures)
+	}
+
+	// Deliveries pending when it was disabled fail without a request.
+	d := newTestDelivery(t, db, stored)
+	if err := DeliverWebhook(db, rec.Client(), d, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Status != core.DeliveryFailed || rec.count() != webhookFailureLimit {
+		t.Errorf("Disabled webhook delivery is %v after %v requests", d.Status, rec.count())
+	}
+}
+
+func TestWebhookSuccessForgivesFailures(t *testing.T) {
+	db := newTestDatabase(t)
+	rec := newWebhookReceiver(t, http.StatusInternalServerError)
+	h := newTestWebhook(t, db, rec)
+
+	now := time.Unix(1700000000, 0)
+	for i := 1; i < webhookFailureLimit; i++ {
+		DeliverWebhook(db, rec.Client(), newTestDelivery(t, db, h), now)
+	}
+
+	rec.mutex.Lock()
+	rec.status = http.StatusOK
+	rec.mutex.Unlock()
+
+	DeliverWebhook(db, rec.Client(), newTestDelivery(t, db, h), now)
+
+	stored, err := db.LoadWebhook(h.Id)
+	if err != nil || stored.Disabled || stored.Failures != 0 {
+		t.Errorf("Webhook stored as %+v after a success: %v", stored, err)
+	}
+}
+
+func TestTestWebhookIsSentOnce(t *testing.T) {
+	db := newTestDatabase(t)
+	rec := newWebhookReceiver(t, http.StatusInternalServerError)
+	h := newTestWebhook(t, db, rec)
+
+	d, err := SendTestWebhook(db, rec.Client(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Status != core.DeliveryFailed || d.Attempts != 1 {
+		t.Errorf("Failed test delivery is %v after %v attempts", d.Status, d.Attempts)
+	}
+
+	// Neither a pending nor a failed test is picked up by the dispatcher.
+	DeliverWebhooks(db, rec.Client(), time.Now().Add(time.Hour))
+	if rec.count() != 1 {
+		t.Errorf("The receiver got %v requests, not 1", rec.count())
+	}
+}
+
+func TestDispatcherSkipsPendingTestWebhooks(t *testing.T) {
+	db := newTestDatabase(t)
+	rec := newWebhookReceiver(t, http.StatusOK)
+	h := newTestWebhook(t, db, rec)
+
+	// What SendTestWebhook has stored before it delivers.
+	if _, err := queueWebhookDelivery(db, h, core.WebhookTest, map[string]any{"webhook_id": h.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := db.GetDueWebhookDeliveries(time.Now().Add(time.Hour), webhookBatchSize)
+	if err != nil || len(due) != 0 {
+		t.Errorf("Pending test delivery is due: %v %v", due, err)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	rec := newWebhookReceiver(t, http.StatusOK)
+
+	req, err := http.NewRequest(http.MethodPost, rec.URL, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newOutboundClient(false, time.Second).Do(req)
+	if err == nil || !strings.Contains(err.Error(), "Refusing to connect to private address 127.0.0.1") {
+		t.Errorf("Request to %v was not refused: %v", rec.URL, err)
+	}
+
+	if rec.count() != 0 {
+		t.Errorf("The receiver got %v requests", rec.count())
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, rec.URL, strings.NewReader("{}"))
+	resp, err := newOutboundClient(true, time.Second).Do(req)
+	if err != nil {
+		t.Fatalf("Allowed request was refused: %v", err)
+	}
+	resp.Body.Close()
+
+	if rec.count() != 1 {
+		t.Errorf("The receiver got %v requests, not 1", rec.count())
+	}
+}
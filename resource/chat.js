@@ -0,0 +1,96 @@
+(function () {
+    var table = document.getElementById("messages");
+    if (!table) {
+        return;
+    }
+
+    var conversation = Number(table.dataset.conversation);
+    var lastId = Number(table.dataset.last);
+    var typing = document.getElementById("typing");
+    var content = document.getElementById("content");
+    var typingTimer = null;
+    var lastTyping = 0;
+
+    function appendMessage(m) {
+        if (m.id <= lastId) {
+            return;
+        }
+
+        lastId = m.id;
+        if (m.conversation !== conversation) {
+            return;
+        }
+
+        var row = table.insertRow(-1);
+        row.id = "message-" + m.id;
+
+        var author = row.insertCell(0);
+        author.className = "rowname";
+        var link = document.createElement("a");
+        link.href = "/user?id=" + m.author.id;
+        link.textContent = m.author.login;
+        author.appendChild(link);
+
+        var body = row.insertCell(1);
+        body.className = "post";
+        var pre = document.createElement("pre");
+        pre.textContent = m.content;
+        body.appendChild(pre);
+
+        typing.textContent = "";
+        fetch("/do_read_conversation?id=" + conversation + "&message=" + m.id, { method: "POST" });
+    }
+
+    function showTyping(t) {
+        if (t.conversation !== conversation) {
+            return;
+        }
+
+        typing.textContent = t.user.login + " is typing...";
+        clearTimeout(typingTimer);
+        typingTimer = setTimeout(function () {
+            typing.textContent = "";
+        }, 5000);
+    }
+
+    function poll() {
+        fetch("/events/poll?after=" + lastId)
+            .then(function (response) { return response.json(); })
+            .then(function (ms) { ms.forEach(appendMessage); })
+            .finally(function () { setTimeout(poll, 5000); });
+    }
+
+    if (window.EventSource) {
+        var source = new EventSource("/events?last=" + lastId);
+        var failures = 0;
+
+        source.addEventListener("open", function () {
+            failures = 0;
+        });
+        source.addEventListener("message", function (e) {
+            appendMessage(JSON.parse(e.data));
+        });
+        source.addEventListener("typing", function (e) {
+            showTyping(JSON.parse(e.data));
+        });
+        source.onerror = function () {
+            // The browser reconnects by itself and resumes from the last
+            // event id; give up on streaming only if that keeps failing.
+            failures++;
+            if (failures >= 3) {
+                source.close();
+                poll();
+            }
+        };
+    } else {
+        poll();
+    }
+
+    content.addEventListener("input", function () {
+        var now = Date.now();
+        if (now - lastTyping > 3000) {
+            lastTyping = now;
+            fetch("/do_typing?id=" + conversation, { method: "POST" });
+        }
+    });
+})();